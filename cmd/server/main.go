@@ -1,18 +1,36 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"shorturl-platform/internal/account"
+	"shorturl-platform/internal/apikey"
+	"shorturl-platform/internal/bootstrap"
+	"shorturl-platform/internal/clicks"
 	"shorturl-platform/internal/config"
 	"shorturl-platform/internal/handler"
+	"shorturl-platform/internal/loginguard"
+	"shorturl-platform/internal/mfa"
 	"shorturl-platform/internal/middleware"
 	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/ratelimit"
+	"shorturl-platform/internal/session"
 	"shorturl-platform/internal/shortcode" // 导入新的 shortcode 包
+	"shorturl-platform/internal/sweeper"
+	"shorturl-platform/internal/visitors"
+	"shorturl-platform/internal/workspace"
 	"shorturl-platform/pkg/database"
+	"shorturl-platform/pkg/geoip"
 	auth "shorturl-platform/pkg/jwt"
 	"shorturl-platform/pkg/logger"
+	"shorturl-platform/pkg/mailer"
+	"shorturl-platform/pkg/oidc"
 	"shorturl-platform/pkg/redis"
+	"syscall"
 	"time"
 
 	_ "shorturl-platform/docs"
@@ -22,7 +40,6 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 // ... (swagger 注释保持不变)
@@ -47,7 +64,8 @@ func main() {
 	}
 	sugaredLogger.Info("✅ 数据库连接成功")
 
-	err = db.AutoMigrate(&model.User{}, &model.ShortLink{})
+	err = db.AutoMigrate(&model.User{}, &model.ShortLink{}, &model.ClickRecord{}, &model.RefreshToken{}, &model.APIKey{}, &model.UserIdentity{}, &model.RecoveryCode{},
+		&model.Workspace{}, &model.WorkspaceMember{}, &model.CodeSequence{})
 	if err != nil {
 		sugaredLogger.Fatalf("数据库迁移失败: %v", err)
 	}
@@ -70,18 +88,100 @@ func main() {
 		}
 	}
 
-	// 初始化并启动短码生成器
-	shortcodeGenerator := shortcode.NewGenerator(db, sugaredLogger)
+	// 初始化并启动短码生成器，生成策略见 config.yaml 的 shortcode
+	codeSecret := cfg.ShortCode.Secret
+	if codeSecret == "" {
+		if codeSecret, err = shortcode.DeriveSecret(cfg.Auth.Secret); err != nil {
+			sugaredLogger.Fatalf("派生短码密钥失败: %v", err)
+		}
+	}
+	var codeFilter shortcode.CodeFilter
+	if cfg.ShortCode.Filter.Enabled {
+		codeFilter, err = shortcode.NewFilter(context.Background(), rdb, cfg.ShortCode.Filter.Store,
+			cfg.ShortCode.Filter.Capacity, cfg.ShortCode.Filter.FalsePositiveRate, sugaredLogger)
+		if err != nil {
+			sugaredLogger.Fatalf("短码过滤器配置无效: %v", err)
+		}
+	}
+	codeRegistry := shortcode.NewRegistry(db, codeFilter, sugaredLogger)
+	// 过滤器在后台加载，加载完成之前查重直接访问数据库
+	go func() {
+		if err := codeRegistry.Load(context.Background()); err != nil {
+			sugaredLogger.Errorf("加载短码过滤器失败，查重将继续访问数据库: %v", err)
+		}
+	}()
+	codeSource, err := shortcode.NewSource(db, rdb, shortcode.Options{
+		Strategy:     cfg.ShortCode.Strategy,
+		Length:       cfg.ShortCode.Length,
+		Charset:      cfg.ShortCode.Charset,
+		Secret:       codeSecret,
+		SegmentStore: cfg.ShortCode.Segment.Store,
+		SegmentStep:  cfg.ShortCode.Segment.Step,
+		Registry:     codeRegistry,
+	}, sugaredLogger)
+	if err != nil {
+		sugaredLogger.Fatalf("短码生成配置无效: %v", err)
+	}
+	shortcodeGenerator := shortcode.NewGenerator(codeSource, codeRegistry, sugaredLogger)
 	shortcodeGenerator.Start()
 	defer shortcodeGenerator.Stop()
 	sugaredLogger.Info("✅ 短码生成器已启动")
 
-	tokenManager := auth.NewManager(cfg.Auth.Secret, cfg.Auth.Issuer, cfg.Auth.ExpirationHours)
+	// 启动过期链接清理器
+	linkSweeper := sweeper.NewSweeper(db, rdb, time.Duration(cfg.Link.SweepInterval)*time.Second, sugaredLogger)
+	linkSweeper.Start()
+	defer linkSweeper.Stop()
+
+	// 加载 GeoIP 数据库，未配置或加载失败时不解析地理位置
+	var geoLocator geoip.Locator = geoip.NopLocator{}
+	if cfg.GeoIP.Database != "" {
+		fileLocator, err := geoip.NewFileLocator(cfg.GeoIP.Database, cfg.GeoIP.Language,
+			time.Duration(cfg.GeoIP.ReloadInterval)*time.Second, sugaredLogger)
+		if err != nil {
+			sugaredLogger.Warnf("GeoIP 数据库加载失败: %v", err)
+		} else {
+			fileLocator.Start()
+			defer fileLocator.Stop()
+			geoLocator = fileLocator
+			sugaredLogger.Info("✅ GeoIP 数据库加载成功")
+		}
+	}
+
+	// 独立访客统计：Redis 可用时使用 PFADD/PFCOUNT，否则使用进程内的 HyperLogLog
+	visitorCounter := visitors.New(rdb)
+	if memoryCounter, ok := visitorCounter.(*visitors.MemoryCounter); ok {
+		memoryCounter.Start()
+		defer memoryCounter.Stop()
+	}
+
+	// 启动点击写入器，退出时会把队列中剩余的事件写入数据库
+	clickRecorder := clicks.NewRecorder(db, clicks.Options{
+		BufferSize:    cfg.Analytics.BufferSize,
+		BatchSize:     cfg.Analytics.BatchSize,
+		FlushInterval: time.Duration(cfg.Analytics.FlushIntervalMs) * time.Millisecond,
+		Locator:       geoLocator,
+		Visitors:      visitorCounter,
+	}, sugaredLogger)
+	clickRecorder.Start()
+	defer clickRecorder.Stop()
+
+	tokenManager, err := newTokenManager(&cfg.Auth)
+	if err != nil {
+		sugaredLogger.Fatalf("签名密钥加载失败: %v", err)
+	}
+	// 撤销列表在 Redis 可用时多个实例共享，登出后的令牌在所有实例上立即失效
+	denylist := session.NewDenylist(rdb)
+	sessions := session.NewService(db, tokenManager, denylist, cfg.Auth.RefreshTTL(), sugaredLogger)
 	sugaredLogger.Info("✅ 认证管理器初始化成功")
 
-	if err := createAdminUser(db); err != nil {
+	// 没有管理员时创建初始管理员，生成的密码只输出到终端一次
+	bootstrapAdmin := bootstrap.Admin(cfg.Auth.BootstrapAdmin)
+	if _, err := bootstrap.EnsureAdmin(db, bootstrapAdmin, os.Stderr, sugaredLogger); err != nil {
 		sugaredLogger.Errorf("创建管理员失败: %v", err)
 	}
+	if err := bootstrap.CheckDefaultCredentials(db, rdb, cfg.App.Mode == "production", sugaredLogger); err != nil {
+		sugaredLogger.Fatalf("安全检查失败: %v", err)
+	}
 
 	if cfg.App.Mode == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -96,16 +196,67 @@ func main() {
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	authMiddleware := middleware.AuthMiddleware(tokenManager)
-	adminMiddleware := middleware.AdminMiddleware()
-	rateLimitMiddleware := middleware.RateLimit(rdb, &cfg.RateLimit)
-	router.Use(rateLimitMiddleware)
+	apiKeys := apikey.NewService(db, sugaredLogger)
+	authMiddleware := middleware.AuthMiddleware(tokenManager, denylist, apiKeys, cfg.Auth.RequireAdmin2FA)
+	// Redis 可用时多个实例共享限流配额，Redis 故障时降级为进程内限流
+	limiter := ratelimit.New(rdb, sugaredLogger)
+	rateLimit := func(policy string) gin.HandlerFunc {
+		return middleware.RateLimit(limiter, &cfg.RateLimit, policy)
+	}
 
 	// 将生成器注入到 Handler
-	urlHandler := handler.NewShortLinkHandler(db, rdb, shortcodeGenerator)
-	authHandler := handler.NewAuthHandler(db, rdb, tokenManager)
+	// 登录失败计数：Redis 可用时多个实例共享，否则只在当前实例内生效
+	lockout := cfg.Auth.Lockout
+	loginGuard := loginguard.New(rdb, loginguard.Options{
+		MaxAttempts:   lockout.MaxAttempts,
+		IPMaxAttempts: lockout.IPMaxAttempts,
+		Window:        time.Duration(lockout.Window) * time.Second,
+		BaseLockout:   time.Duration(lockout.BaseLockout) * time.Second,
+		MaxLockout:    time.Duration(lockout.MaxLockout) * time.Second,
+	}, sugaredLogger)
 
-	registerRoutes(router, urlHandler, authHandler, authMiddleware, adminMiddleware)
+	// 两步验证，验证器应用中显示的名称使用 auth.issuer
+	mfaService := mfa.NewService(db, rdb, cfg.Auth.Issuer, sugaredLogger)
+
+	// 密码重置和邮箱验证邮件，邮件中的链接使用单独配置的 mail.secret 签名
+	mail, err := newMailer(&cfg.Mail, sugaredLogger)
+	if err != nil {
+		sugaredLogger.Fatalf("邮件初始化失败: %v", err)
+	}
+	accountService := account.NewService(db, mail, cfg.Mail.Secret, cfg.Mail.BaseURL, sugaredLogger)
+	defer accountService.Wait()
+
+	urlHandler := handler.NewShortLinkHandler(db, rdb, shortcodeGenerator, &cfg.Link, clickRecorder, visitorCounter)
+	authHandler := handler.NewAuthHandler(db, rdb, tokenManager, sessions, loginGuard, mfaService, accountService, cfg.Auth.RequireAdmin2FA)
+	adminHandler := handler.NewAdminHandler(db, rdb, sessions, loginGuard)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeys)
+	mfaHandler := handler.NewMFAHandler(db, rdb, mfaService)
+	accountHandler := handler.NewAccountHandler(db, rdb, accountService, sessions)
+	workspaceService := workspace.NewService(db, sugaredLogger)
+	workspaceHandler := handler.NewWorkspaceHandler(workspaceService)
+
+	// OIDC 登录，提供方的发现文档在首次登录时获取
+	var oidcHandler *handler.OIDCHandler
+	if cfg.Auth.OIDC.Enabled {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.Auth.OIDC.Issuer,
+			ClientID:     cfg.Auth.OIDC.ClientID,
+			ClientSecret: cfg.Auth.OIDC.ClientSecret,
+			RedirectURL:  cfg.Auth.OIDC.RedirectURL,
+			Scopes:       cfg.Auth.OIDC.Scopes,
+		}, nil)
+		oidcHandler = handler.NewOIDCHandler(db, provider, sessions, mfaService, &cfg.Auth.OIDC, bootstrapAdmin.Name())
+		sugaredLogger.Infof("✅ OIDC 登录已启用: %s", cfg.Auth.OIDC.Issuer)
+	}
+
+	// 未开启 auth.require_verified_email 时不检查邮箱验证状态
+	var verifiedEmail gin.HandlerFunc = func(c *gin.Context) { c.Next() }
+	if cfg.Auth.RequireVerifiedEmail {
+		verifiedEmail = middleware.RequireVerifiedEmail(accountService.IsVerified)
+	}
+
+	registerRoutes(router, urlHandler, authHandler, adminHandler, apiKeyHandler, mfaHandler, accountHandler, workspaceHandler, oidcHandler,
+		authMiddleware, middleware.AdminMiddleware(), middleware.WorkspaceScope(workspaceService), verifiedEmail, rateLimit)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
@@ -114,60 +265,175 @@ func main() {
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 	}
 
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sugaredLogger.Fatalf("服务启动失败: %v", err)
+		}
+	}()
 	sugaredLogger.Infof("🚀 服务启动成功, 访问 http://localhost:%d", cfg.Server.Port)
 	sugaredLogger.Infof("📚 Swagger 文档地址: http://localhost:%d/swagger/index.html", cfg.Server.Port)
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		sugaredLogger.Fatalf("服务启动失败: %v", err)
+
+	// 等待退出信号，优雅关闭服务；之后 defer 会依次停止后台任务并刷新点击事件
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	sugaredLogger.Info("正在关闭服务...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		sugaredLogger.Errorf("服务关闭失败: %v", err)
 	}
 }
 
-// ... (registerRoutes 和 createAdminUser 函数保持不变)
+// ... (registerRoutes 函数保持不变)
 func registerRoutes(
 	router *gin.Engine,
 	urlHandler *handler.ShortLinkHandler,
 	authHandler *handler.AuthHandler,
-	authMiddleware, adminMiddleware gin.HandlerFunc,
+	adminHandler *handler.AdminHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	mfaHandler *handler.MFAHandler,
+	accountHandler *handler.AccountHandler,
+	workspaceHandler *handler.WorkspaceHandler,
+	oidcHandler *handler.OIDCHandler, // 未启用 OIDC 登录时为 nil
+	authMiddleware gin.HandlerFunc,
+	adminMiddleware gin.HandlerFunc,
+	workspaceScope gin.HandlerFunc, // 解析请求所在的工作区和当前用户的角色
+	verifiedEmail gin.HandlerFunc, // 创建短链接前检查邮箱是否已验证
+	rateLimit func(policy string) gin.HandlerFunc, // 按名称创建限流中间件，策略见 config.yaml 的 rate_limit.policies
 ) {
 	router.GET("/", urlHandler.IndexPage)
 	router.GET("/health", urlHandler.HealthCheck)
-	router.GET("/:code", urlHandler.RedirectToOriginal)
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	router.GET("/:code", rateLimit("redirect"), urlHandler.RedirectToOriginal)
 
 	authGroup := router.Group("/auth")
 	{
-		authGroup.POST("/login", authHandler.Login)
-		authGroup.POST("/register", authHandler.Register)
+		authGroup.POST("/login", rateLimit("auth_login"), authHandler.Login)
+		authGroup.POST("/login/2fa", rateLimit("auth_login"), authHandler.LoginMFA)
+		authGroup.POST("/register", rateLimit("auth_register"), authHandler.Register)
+		authGroup.POST("/refresh", rateLimit("auth_refresh"), authHandler.Refresh)
+		authGroup.POST("/logout", authMiddleware, authHandler.Logout)
+		authGroup.POST("/password/forgot", rateLimit("auth_email"), accountHandler.ForgotPassword)
+		authGroup.POST("/password/reset", rateLimit("auth_login"), accountHandler.ResetPassword)
+		authGroup.POST("/email/verify", rateLimit("auth_login"), accountHandler.VerifyEmail)
+		if oidcHandler != nil {
+			authGroup.GET("/oidc", oidcHandler.Info)
+			authGroup.GET("/oidc/login", rateLimit("auth_login"), oidcHandler.Login)
+			authGroup.GET("/oidc/callback", rateLimit("auth_login"), oidcHandler.Callback)
+		}
 	}
 
+	// 限流在认证之后执行，已认证的请求按 user_id 计数。
+	// 使用 API 密钥访问时，RequireScope 校验密钥的权限范围，JWT 登录的请求不受限制
 	api := router.Group("/api")
-	api.Use(authMiddleware)
+	api.Use(authMiddleware, rateLimit("api"))
 	{
 		api.GET("/me", authHandler.GetCurrentUser)
-		api.POST("/shorten", urlHandler.CreateShortLink)
-		api.GET("/links", urlHandler.GetAllLinks)
-		api.GET("/stats", urlHandler.GetStats)
+		// 链接接口通过 X-Workspace-ID 请求头或 /api/workspaces/:workspace_id 路径指定工作区，都不指定时为个人空间。
+		// 工作区的 viewer 可以查看链接和统计，editor 及以上可以创建、修改和删除链接
+		registerLinkRoutes(api.Group("", workspaceScope), urlHandler, verifiedEmail, rateLimit)
 	}
+	scoped := api.Group("/workspaces/:workspace_id", workspaceScope)
+	registerLinkRoutes(scoped, urlHandler, verifiedEmail, rateLimit)
 
-	admin := api.Group("")
-	admin.Use(adminMiddleware)
+	// API 密钥管理、账户设置、两步验证和管理员接口只能登录后访问，不能用 API 密钥调用
+	me := api.Group("/me")
+	me.Use(middleware.SessionOnly())
 	{
-		admin.PUT("/links/:code", urlHandler.ToggleLink)
-		admin.DELETE("/links/:code", urlHandler.DeleteLink)
+		me.POST("/password", accountHandler.ChangePassword)
+		me.POST("/email/verify", rateLimit("auth_email"), accountHandler.SendVerification)
+	}
+
+	keys := api.Group("/keys")
+	keys.Use(middleware.SessionOnly())
+	{
+		keys.POST("", apiKeyHandler.CreateAPIKey)
+		keys.GET("", apiKeyHandler.ListAPIKeys)
+		keys.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+	}
+
+	twoFactor := api.Group("/me/2fa")
+	twoFactor.Use(middleware.SessionOnly())
+	{
+		twoFactor.GET("", mfaHandler.GetStatus)
+		twoFactor.POST("/setup", mfaHandler.Setup)
+		twoFactor.POST("/enable", mfaHandler.Enable)
+		twoFactor.POST("/disable", mfaHandler.Disable)
+		twoFactor.POST("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
 	}
-}
 
-func createAdminUser(db *gorm.DB) error {
-	var existing model.User
-	if err := db.Where("username = ?", "admin").First(&existing).Error; err == nil {
-		return nil
+	// 工作区和成员管理，所有者可以修改工作区和成员，其他成员可以查看成员列表和退出工作区
+	workspaces := api.Group("/workspaces")
+	workspaces.Use(middleware.SessionOnly())
+	{
+		workspaces.GET("", workspaceHandler.ListWorkspaces)
+		workspaces.POST("", workspaceHandler.CreateWorkspace)
+	}
+	manage := scoped.Group("", middleware.SessionOnly())
+	{
+		owner := middleware.RequireWorkspaceRole(workspace.RoleOwner)
+		manage.PATCH("", owner, workspaceHandler.RenameWorkspace)
+		manage.DELETE("", owner, workspaceHandler.DeleteWorkspace)
+		manage.GET("/members", workspaceHandler.ListMembers)
+		manage.POST("/members", owner, workspaceHandler.AddMember)
+		manage.PATCH("/members/:user_id", owner, workspaceHandler.UpdateMember)
+		manage.DELETE("/members/:user_id", workspaceHandler.RemoveMember)
 	}
 
-	admin := model.User{Username: "admin", Email: "admin@shorturl.com", Role: "admin", IsActive: true}
-	if err := admin.SetPassword("admin"); err != nil {
-		return err
+	admin := api.Group("/admin")
+	admin.Use(middleware.SessionOnly(), adminMiddleware)
+	{
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.PATCH("/users/:id", adminHandler.UpdateUser)
+		admin.DELETE("/users/:id", adminHandler.DeleteUser)
+		admin.POST("/users/:id/reset-password", adminHandler.ResetPassword)
+		admin.POST("/users/:id/unlock", adminHandler.UnlockUser)
+	}
+}
+
+// registerLinkRoutes 注册短链接接口，group 需要先经过 WorkspaceScope 解析工作区
+func registerLinkRoutes(group *gin.RouterGroup, urlHandler *handler.ShortLinkHandler, verifiedEmail gin.HandlerFunc, rateLimit func(policy string) gin.HandlerFunc) {
+	viewer := middleware.RequireWorkspaceRole(workspace.RoleViewer)
+	editor := middleware.RequireWorkspaceRole(workspace.RoleEditor)
+	group.POST("/shorten", middleware.RequireScope(apikey.ScopeLinksWrite), editor, rateLimit("shorten"), verifiedEmail, urlHandler.CreateShortLink)
+	group.GET("/links", middleware.RequireScope(apikey.ScopeLinksRead), viewer, urlHandler.GetAllLinks)
+	group.GET("/stats", middleware.RequireScope(apikey.ScopeStatsRead), viewer, urlHandler.GetStats)
+	group.PUT("/links/:code", middleware.RequireScope(apikey.ScopeLinksWrite), editor, urlHandler.ToggleLink)
+	group.PATCH("/links/:code", middleware.RequireScope(apikey.ScopeLinksWrite), editor, urlHandler.UpdateLink)
+	group.DELETE("/links/:code", middleware.RequireScope(apikey.ScopeLinksWrite), editor, urlHandler.DeleteLink)
+	group.GET("/links/:code/analytics", middleware.RequireScope(apikey.ScopeStatsRead), viewer, urlHandler.GetLinkAnalytics)
+}
+
+// newTokenManager 配置了签名密钥时使用非对称签名，否则使用 HS256
+func newTokenManager(cfg *config.Auth) (*auth.TokenManager, error) {
+	if len(cfg.Signing.Keys) == 0 {
+		return auth.NewManager(cfg.Secret, cfg.Issuer, cfg.AccessTTL()), nil
 	}
-	if err := db.Create(&admin).Error; err != nil {
-		return err
+	keys := make([]*auth.SigningKey, 0, len(cfg.Signing.Keys))
+	for _, k := range cfg.Signing.Keys {
+		key, err := auth.LoadSigningKey(k.ID, k.PrivateKey, k.NotBefore, k.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewKeyManager(cfg.Issuer, cfg.AccessTTL(), keys)
+}
+
+// newMailer 按 mail.driver 创建邮件发送器，默认只写入日志
+func newMailer(cfg *config.Mail, logger *zap.SugaredLogger) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return mailer.NewLogMailer(logger), nil
+	case "file":
+		return mailer.NewFileMailer(cfg.Dir, cfg.From)
+	case "smtp":
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host: cfg.SMTP.Host, Port: cfg.SMTP.Port, Username: cfg.SMTP.Username, Password: cfg.SMTP.Password, From: cfg.From,
+		}), nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件驱动: %s", cfg.Driver)
 	}
-	zap.S().Info("✅ 默认管理员创建成功", "username", "admin")
-	return nil
 }
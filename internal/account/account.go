@@ -0,0 +1,210 @@
+// Package account 实现账户自助操作：修改密码、通过邮件重置密码以及验证邮箱。
+// 邮件中的链接携带签名令牌，不需要在服务端保存。
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/pkg/mailer"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 邮件链接的有效期
+const (
+	ResetTokenTTL  = time.Hour
+	VerifyTokenTTL = 24 * time.Hour
+)
+
+// sendTimeout 是发送一封邮件的超时时间
+const sendTimeout = 30 * time.Second
+
+var (
+	// ErrWrongPassword 当前密码错误
+	ErrWrongPassword = errors.New("当前密码错误")
+	// ErrSamePassword 新密码与当前密码相同
+	ErrSamePassword = errors.New("新密码不能与当前密码相同")
+	// ErrAlreadyVerified 邮箱已经验证过
+	ErrAlreadyVerified = errors.New("邮箱已验证")
+)
+
+// Service 账户服务
+type Service struct {
+	db      *gorm.DB
+	mailer  mailer.Mailer
+	signer  *signer
+	baseURL string
+	logger  *zap.SugaredLogger
+	now     func() time.Time
+	pending sync.WaitGroup
+}
+
+// NewService 创建账户服务。secret 用于签名邮件中的令牌，baseURL 是邮件中链接指向的站点地址
+func NewService(db *gorm.DB, m mailer.Mailer, secret, baseURL string, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		db:      db,
+		mailer:  m,
+		signer:  newSigner(secret),
+		baseURL: strings.TrimRight(baseURL, "/"),
+		logger:  logger.Named("account"),
+		now:     time.Now,
+	}
+}
+
+// Wait 等待后台发送中的邮件完成，退出前调用
+func (s *Service) Wait() {
+	s.pending.Wait()
+}
+
+// ChangePassword 校验当前密码后设置新密码，调用方负责撤销用户已有的会话
+func (s *Service) ChangePassword(ctx context.Context, user *model.User, current, password string) error {
+	if !user.CheckPassword(current) {
+		return ErrWrongPassword
+	}
+	if current == password {
+		return ErrSamePassword
+	}
+	return s.setPassword(ctx, user, password)
+}
+
+// RequestPasswordReset 向邮箱对应的用户发送重置密码邮件。邮箱不存在或用户已被禁用时什么也不做，
+// 邮件在后台发送，这样无论邮箱是否存在响应时间都相同，不会泄露哪些邮箱已经注册
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	var user model.User
+	err := s.db.WithContext(ctx).Where("email = ? AND is_active = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token := s.signer.sign(purposeResetPassword, user.ID, s.now().Add(ResetTokenTTL), user.PasswordHash)
+	s.deliver(mailer.Message{
+		To:      user.Email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了重置密码的请求，请在 %d 分钟内打开下面的链接设置新密码：\n\n%s\n\n"+
+			"如果这不是你本人的操作，请忽略这封邮件，你的密码不会改变。\n",
+			user.Username, int(ResetTokenTTL.Minutes()), s.link("reset-password", token)),
+	})
+	return nil
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码。令牌与当前密码哈希绑定，密码改变后令牌随即失效
+func (s *Service) ResetPassword(ctx context.Context, token, password string) (*model.User, error) {
+	user, err := s.tokenUser(ctx, purposeResetPassword, token, func(u *model.User) string { return u.PasswordHash })
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidToken
+	}
+	if err := s.setPassword(ctx, user, password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SendVerification 向用户的邮箱发送验证邮件
+func (s *Service) SendVerification(ctx context.Context, user *model.User) error {
+	if user.EmailVerified {
+		return ErrAlreadyVerified
+	}
+	token := s.signer.sign(purposeVerifyEmail, user.ID, s.now().Add(VerifyTokenTTL), user.Email)
+	s.deliver(mailer.Message{
+		To:      user.Email,
+		Subject: "验证邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %d 小时内打开下面的链接验证你的邮箱：\n\n%s\n\n"+
+			"如果你没有注册过账户，请忽略这封邮件。\n",
+			user.Username, int(VerifyTokenTTL.Hours()), s.link("verify-email", token)),
+	})
+	return nil
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱。令牌与邮箱地址绑定，邮箱变更后之前的验证链接失效
+func (s *Service) VerifyEmail(ctx context.Context, token string) (*model.User, error) {
+	user, err := s.tokenUser(ctx, purposeVerifyEmail, token, func(u *model.User) string { return u.Email })
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+	now := s.now()
+	err = s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]any{"email_verified": true, "email_verified_at": now}).Error
+	if err != nil {
+		return nil, err
+	}
+	user.EmailVerified, user.EmailVerifiedAt = true, &now
+	return user, nil
+}
+
+// IsVerified 返回用户的邮箱是否已经验证
+func (s *Service) IsVerified(ctx context.Context, userID uint) (bool, error) {
+	var user model.User
+	err := s.db.WithContext(ctx).Select("email_verified").First(&user, userID).Error
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+// setPassword 保存用户自己设置的新密码，同时解除必须修改密码的限制
+func (s *Service) setPassword(ctx context.Context, user *model.User, password string) error {
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	err := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]any{"password_hash": user.PasswordHash, "must_change_password": false}).Error
+	if err != nil {
+		return err
+	}
+	user.MustChangePassword = false
+	return nil
+}
+
+// tokenUser 校验令牌并返回对应的用户，state 返回签名时使用的用户状态
+func (s *Service) tokenUser(ctx context.Context, purpose, token string, state func(*model.User) string) (*model.User, error) {
+	userID, err := s.signer.parse(purpose, token, s.now())
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	err = s.db.WithContext(ctx).First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !s.signer.verify(token, state(&user)) {
+		return nil, ErrInvalidToken
+	}
+	return &user, nil
+}
+
+// link 生成邮件中的链接，令牌放在 URL 片段中，不会出现在服务器和代理的访问日志里
+func (s *Service) link(page, token string) string {
+	return s.baseURL + "/#" + page + "?token=" + url.QueryEscape(token)
+}
+
+// deliver 在后台发送邮件，失败只记录日志
+func (s *Service) deliver(msg mailer.Message) {
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			s.logger.Errorw("发送邮件失败", "to", msg.To, "subject", msg.Subject, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,146 @@
+package account
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/pkg/mailer"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// outbox 记录发出的邮件
+type outbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (o *outbox) Send(_ context.Context, msg mailer.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// lastToken 返回最后一封邮件中链接携带的令牌
+func (o *outbox) lastToken(t *testing.T) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	require.NotEmpty(t, o.messages)
+	m := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(o.messages[len(o.messages)-1].Body)
+	require.NotNil(t, m)
+	token, err := url.QueryUnescape(m[1])
+	require.NoError(t, err)
+	return token
+}
+
+func setupService(t *testing.T, name string) (*Service, *outbox, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	box := &outbox{}
+	return NewService(db, box, "test-secret", "https://s.example.com/", zap.NewNop().Sugar()), box, db
+}
+
+func createUser(t *testing.T, db *gorm.DB, password string) *model.User {
+	user := model.User{Username: "alice", Email: "alice@example.com", Role: "user", IsActive: true}
+	require.NoError(t, user.SetPassword(password))
+	require.NoError(t, db.Create(&user).Error)
+	return &user
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	s, box, db := setupService(t, "account_reset_test")
+	ctx := context.Background()
+	createUser(t, db, "old-password")
+
+	// 未注册的邮箱不发送邮件，也不返回错误
+	require.NoError(t, s.RequestPasswordReset(ctx, "nobody@example.com"))
+	s.Wait()
+	assert.Empty(t, box.messages)
+
+	require.NoError(t, s.RequestPasswordReset(ctx, "alice@example.com"))
+	s.Wait()
+	require.Len(t, box.messages, 1)
+	assert.Equal(t, "alice@example.com", box.messages[0].To)
+	assert.Contains(t, box.messages[0].Body, "https://s.example.com/#reset-password?token=")
+	token := box.lastToken(t)
+
+	// 重置令牌不能用于验证邮箱
+	_, err := s.VerifyEmail(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = s.ResetPassword(ctx, token+"x", "new-password")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	user, err := s.ResetPassword(ctx, token, "new-password")
+	require.NoError(t, err)
+	require.NoError(t, db.First(user, user.ID).Error)
+	assert.True(t, user.CheckPassword("new-password"))
+
+	// 密码改变后同一个令牌不能再次使用
+	_, err = s.ResetPassword(ctx, token, "another-password")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// 过期的令牌无效
+	require.NoError(t, s.RequestPasswordReset(ctx, "alice@example.com"))
+	s.Wait()
+	token = box.lastToken(t)
+	s.now = func() time.Time { return time.Now().Add(ResetTokenTTL + time.Minute) }
+	_, err = s.ResetPassword(ctx, token, "another-password")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestService_VerifyEmail(t *testing.T) {
+	s, box, db := setupService(t, "account_verify_test")
+	ctx := context.Background()
+	user := createUser(t, db, "password")
+
+	verified, err := s.IsVerified(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, verified)
+
+	require.NoError(t, s.SendVerification(ctx, user))
+	s.Wait()
+	token := box.lastToken(t)
+
+	_, err = s.ResetPassword(ctx, token, "new-password")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	got, err := s.VerifyEmail(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, got.EmailVerified)
+	verified, err = s.IsVerified(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, verified)
+	assert.ErrorIs(t, s.SendVerification(ctx, got), ErrAlreadyVerified)
+
+	// 邮箱变更后之前的验证链接失效
+	require.NoError(t, db.Model(user).Updates(map[string]any{"email": "alice@example.org", "email_verified": false}).Error)
+	_, err = s.VerifyEmail(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	s, _, db := setupService(t, "account_change_test")
+	ctx := context.Background()
+	user := createUser(t, db, "old-password")
+
+	assert.ErrorIs(t, s.ChangePassword(ctx, user, "wrong", "new-password"), ErrWrongPassword)
+	require.NoError(t, s.ChangePassword(ctx, user, "old-password", "new-password"))
+
+	var stored model.User
+	require.NoError(t, db.First(&stored, user.ID).Error)
+	assert.True(t, stored.CheckPassword("new-password"))
+}
@@ -0,0 +1,85 @@
+package account
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken 链接中的令牌无效、已过期或已经使用过
+var ErrInvalidToken = errors.New("链接无效或已过期")
+
+// 令牌用途，不同用途的令牌不能互相替代
+const (
+	purposeResetPassword = "reset_password"
+	purposeVerifyEmail   = "verify_email"
+)
+
+// tokenPayload 是令牌中携带的数据
+type tokenPayload struct {
+	Purpose string `json:"p"`
+	UserID  uint   `json:"u"`
+	Expires int64  `json:"e"`
+}
+
+// signer 签发和校验邮件链接中的令牌：payload.签名，签名同时覆盖用户当前的状态（state），
+// 状态变化后之前签发的令牌自动失效，例如重置密码的令牌以密码哈希为状态，只能使用一次
+type signer struct {
+	key []byte
+}
+
+// newSigner 从 mail.secret 派生签名密钥，与访问令牌使用的密钥相互独立
+func newSigner(secret string) *signer {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("shorturl-platform/account-token"))
+	return &signer{key: mac.Sum(nil)}
+}
+
+// sign 签发令牌
+func (s *signer) sign(purpose string, userID uint, expires time.Time, state string) string {
+	raw, _ := json.Marshal(tokenPayload{Purpose: purpose, UserID: userID, Expires: expires.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload, state))
+}
+
+// parse 解码令牌并检查用途和有效期，返回的用户 ID 还需要调用 verify 校验签名
+func (s *signer) parse(purpose, token string, now time.Time) (uint, error) {
+	payload, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	var p tokenPayload
+	if err := json.Unmarshal(raw, &p); err != nil || p.Purpose != purpose || p.UserID == 0 {
+		return 0, ErrInvalidToken
+	}
+	if now.Unix() >= p.Expires {
+		return 0, ErrInvalidToken
+	}
+	return p.UserID, nil
+}
+
+// verify 使用用户当前的状态校验签名
+func (s *signer) verify(token, state string) bool {
+	payload, sig, _ := strings.Cut(token, ".")
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, s.mac(payload, state))
+}
+
+func (s *signer) mac(payload, state string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(state))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,155 @@
+// Package apikey 管理用户的个人 API 密钥，供 CI、CMS 插件等程序化调用使用。
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"shorturl-platform/internal/model"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// KeyPrefix 所有 API 密钥的前缀，用于和 JWT 区分
+const KeyPrefix = "sk_"
+
+// 权限范围
+const (
+	ScopeLinksWrite = "links:write" // 创建、修改、删除链接
+	ScopeLinksRead  = "links:read"  // 查看链接列表
+	ScopeStatsRead  = "stats:read"  // 查看统计和点击分析
+)
+
+// Scopes 所有可用的权限范围
+var Scopes = []string{ScopeLinksWrite, ScopeLinksRead, ScopeStatsRead}
+
+// lastUsedInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const lastUsedInterval = time.Minute
+
+var (
+	// ErrInvalidKey 密钥不存在、已撤销或已过期
+	ErrInvalidKey = errors.New("无效的 API 密钥")
+	// ErrNotFound 密钥不存在或不属于当前用户
+	ErrNotFound = errors.New("API 密钥不存在")
+)
+
+// Service API 密钥服务
+type Service struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+	now    func() time.Time
+}
+
+// NewService 创建 API 密钥服务
+func NewService(db *gorm.DB, logger *zap.SugaredLogger) *Service {
+	return &Service{db: db, logger: logger.Named("apikey"), now: time.Now}
+}
+
+// ValidateScopes 校验并去重权限范围
+func ValidateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("至少需要一个权限范围")
+	}
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("未知的权限范围: %s，可选值为 %s", scope, strings.Join(Scopes, ", "))
+		}
+		if !slices.Contains(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// Create 为用户创建一个密钥，返回的明文密钥只会出现这一次
+func (s *Service) Create(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *model.APIKey, error) {
+	scopes, err := ValidateScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	key := KeyPrefix + hex.EncodeToString(raw)
+	record := &model.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:len(KeyPrefix)+8],
+		KeyHash:   hashKey(key),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+// List 返回用户的所有密钥，包括已撤销的
+func (s *Service) List(ctx context.Context, userID uint) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke 撤销用户的一个密钥
+func (s *Service) Revoke(ctx context.Context, userID, keyID uint) error {
+	result := s.db.WithContext(ctx).Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", s.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate 校验密钥并返回密钥和所属用户，同时记录最近使用时间和 IP
+func (s *Service) Authenticate(ctx context.Context, key, ip string) (*model.APIKey, *model.User, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return nil, nil, ErrInvalidKey
+	}
+	var record model.APIKey
+	if err := s.db.WithContext(ctx).Where("key_hash = ?", hashKey(key)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidKey
+		}
+		return nil, nil, err
+	}
+	now := s.now()
+	if !record.IsUsable(now) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, record.UserID).Error; err != nil || !user.IsActive {
+		return nil, nil, ErrInvalidKey
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedInterval || record.LastUsedIP != ip {
+		record.LastUsedAt = &now
+		record.LastUsedIP = ip
+		if err := s.db.WithContext(ctx).Model(&model.APIKey{}).Where("id = ?", record.ID).
+			Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error; err != nil {
+			s.logger.Warnf("更新 API 密钥使用时间失败: %v", err)
+		}
+	}
+	return &record, &user, nil
+}
+
+// hashKey 计算密钥的摘要，数据库中不保存明文
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
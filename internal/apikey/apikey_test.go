@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T) (*Service, *gorm.DB, *model.User) {
+	db, err := gorm.Open(sqlite.Open("file:apikey_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.APIKey{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	user := &model.User{Username: "ci", Email: "ci@example.com", Role: "user", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	return NewService(db, zap.NewNop().Sugar()), db, user
+}
+
+func TestService_CreateAuthenticateRevoke(t *testing.T) {
+	s, db, user := setupService(t)
+	ctx := context.Background()
+
+	key, record, err := s.Create(ctx, user.ID, "ci", []string{ScopeLinksWrite, ScopeLinksWrite, ScopeStatsRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, KeyPrefix))
+	assert.True(t, strings.HasPrefix(key, record.Prefix))
+	assert.Equal(t, []string{ScopeLinksWrite, ScopeStatsRead}, record.ScopeList())
+
+	// 数据库中只保存摘要
+	var stored model.APIKey
+	require.NoError(t, db.First(&stored, record.ID).Error)
+	assert.NotContains(t, stored.KeyHash, key[len(KeyPrefix):])
+
+	got, owner, err := s.Authenticate(ctx, key, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, record.ID, got.ID)
+	assert.Equal(t, user.ID, owner.ID)
+
+	require.NoError(t, db.First(&stored, record.ID).Error)
+	assert.NotNil(t, stored.LastUsedAt)
+	assert.Equal(t, "10.0.0.1", stored.LastUsedIP)
+
+	_, _, err = s.Authenticate(ctx, key+"x", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// 只能撤销自己的密钥
+	assert.ErrorIs(t, s.Revoke(ctx, user.ID+1, record.ID), ErrNotFound)
+	require.NoError(t, s.Revoke(ctx, user.ID, record.ID))
+	_, _, err = s.Authenticate(ctx, key, "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestService_ExpiredKeyAndScopes(t *testing.T) {
+	s, _, user := setupService(t)
+	ctx := context.Background()
+
+	_, _, err := s.Create(ctx, user.ID, "bad", []string{"links:delete"}, nil)
+	assert.Error(t, err)
+	_, _, err = s.Create(ctx, user.ID, "empty", nil, nil)
+	assert.Error(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	key, _, err := s.Create(ctx, user.ID, "short-lived", []string{ScopeLinksRead}, &expiresAt)
+	require.NoError(t, err)
+
+	s.now = func() time.Time { return expiresAt.Add(time.Second) }
+	_, _, err = s.Authenticate(ctx, key, "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
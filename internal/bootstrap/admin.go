@@ -0,0 +1,159 @@
+// Package bootstrap 在首次启动时创建初始管理员，并检查管理员是否仍在使用默认密码。
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"shorturl-platform/internal/model"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 未配置时初始管理员使用的用户名和邮箱
+const (
+	DefaultUsername = "admin"
+	DefaultEmail    = "admin@shorturl.com"
+)
+
+// generatedPasswordLength 是生成的初始密码长度
+const generatedPasswordLength = 20
+
+// passwordAlphabet 去掉了容易混淆的 0/O、1/l/I
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// defaultPasswords 是视为默认凭据的密码，另外与用户名相同的密码也视为默认凭据
+var defaultPasswords = []string{"admin", "password", "123456", "admin123"}
+
+// ErrDefaultCredentials 管理员仍在使用默认密码
+var ErrDefaultCredentials = errors.New("管理员仍在使用默认密码")
+
+// Admin 初始管理员的账户信息
+type Admin struct {
+	Username string
+	Email    string
+	Password string // 为空时生成随机密码
+}
+
+// Name 返回初始管理员的用户名，未配置时为 DefaultUsername
+func (a Admin) Name() string {
+	if a.Username == "" {
+		return DefaultUsername
+	}
+	return a.Username
+}
+
+// EnsureAdmin 在数据库中没有管理员时创建初始管理员，返回是否创建。
+// 未配置密码时生成随机密码写入 out，密码只输出这一次，不写入日志；初始管理员首次登录后必须修改密码
+func EnsureAdmin(db *gorm.DB, admin Admin, out io.Writer, logger *zap.SugaredLogger) (bool, error) {
+	var count int64
+	if err := db.Model(&model.User{}).Where("role = ?", "admin").Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	admin.Username = admin.Name()
+	if admin.Email == "" {
+		admin.Email = DefaultEmail
+	}
+	password, generated := admin.Password, admin.Password == ""
+	if generated {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			return false, err
+		}
+	}
+
+	user := model.User{
+		Username: admin.Username, Email: admin.Email, Role: "admin", IsActive: true,
+		EmailVerified: true, MustChangePassword: true,
+	}
+	if err := user.SetPassword(password); err != nil {
+		return false, err
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return false, fmt.Errorf("创建初始管理员 %s 失败: %w", admin.Username, err)
+	}
+
+	logger.Infow("✅ 初始管理员创建成功，首次登录后需要修改密码", "username", user.Username, "generated_password", generated)
+	if generated {
+		fmt.Fprintf(out, "\n%[1]s\n 初始管理员已创建\n 用户名: %[2]s\n 密码:   %[3]s\n 密码只显示这一次，请妥善保存，首次登录后需要修改密码\n%[1]s\n\n",
+			strings.Repeat("=", 60), user.Username, password)
+	}
+	return true, nil
+}
+
+// CheckDefaultCredentials 检查是否有管理员仍在使用默认密码（例如旧版本创建的 admin/admin）。
+// production 为 true 时返回 ErrDefaultCredentials 拒绝启动，否则将这些账户标记为必须修改密码并记录警告。
+// rdb 不为空时同时删除这些账户在登录时使用的用户缓存，否则缓存过期前登录不会要求修改密码
+func CheckDefaultCredentials(db *gorm.DB, rdb *redis.Client, production bool, logger *zap.SugaredLogger) error {
+	var admins []model.User
+	if err := db.Where("role = ? AND is_active = ?", "admin", true).Find(&admins).Error; err != nil {
+		return err
+	}
+
+	var ids []uint
+	var usernames []string
+	for _, admin := range admins {
+		if usesDefaultPassword(&admin) {
+			ids = append(ids, admin.ID)
+			usernames = append(usernames, admin.Username)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if production {
+		return fmt.Errorf("%w: %s，请修改密码后再以 production 模式启动", ErrDefaultCredentials, strings.Join(usernames, ", "))
+	}
+
+	if err := db.Model(&model.User{}).Where("id IN ?", ids).Update("must_change_password", true).Error; err != nil {
+		return err
+	}
+	if rdb != nil {
+		keys := make([]string, len(usernames))
+		for i, username := range usernames {
+			keys[i] = "user:" + username
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := rdb.Del(ctx, keys...).Err(); err != nil {
+			logger.Warnf("删除用户缓存失败: %v", err)
+		}
+	}
+	logger.Warnw("管理员仍在使用默认密码，登录后必须先修改密码，production 模式下将拒绝启动", "usernames", usernames)
+	return nil
+}
+
+// usesDefaultPassword 判断用户的密码是否为默认密码或与用户名相同
+func usesDefaultPassword(user *model.User) bool {
+	for _, password := range append([]string{user.Username}, defaultPasswords...) {
+		if user.CheckPassword(password) {
+			return true
+		}
+	}
+	return false
+}
+
+// generatePassword 生成随机的初始密码
+func generatePassword() (string, error) {
+	b := make([]byte, generatedPasswordLength)
+	limit := big.NewInt(int64(len(passwordAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
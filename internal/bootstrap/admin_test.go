@@ -0,0 +1,96 @@
+package bootstrap
+
+import (
+	"bytes"
+	"regexp"
+	"shorturl-platform/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestEnsureAdmin_GeneratedPassword(t *testing.T) {
+	db := setupDB(t, "bootstrap_generated_test")
+	logger := zap.NewNop().Sugar()
+
+	var out bytes.Buffer
+	created, err := EnsureAdmin(db, Admin{}, &out, logger)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	m := regexp.MustCompile(`密码:\s+(\S+)`).FindStringSubmatch(out.String())
+	require.NotNil(t, m)
+	assert.Len(t, m[1], generatedPasswordLength)
+
+	var admin model.User
+	require.NoError(t, db.Where("username = ?", DefaultUsername).First(&admin).Error)
+	assert.Equal(t, "admin", admin.Role)
+	assert.True(t, admin.MustChangePassword)
+	assert.True(t, admin.CheckPassword(m[1]))
+	assert.False(t, admin.CheckPassword("admin"))
+
+	// 已有管理员时不再创建，也不再输出密码
+	out.Reset()
+	created, err = EnsureAdmin(db, Admin{Username: "root"}, &out, logger)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Empty(t, out.String())
+}
+
+func TestEnsureAdmin_ConfiguredPassword(t *testing.T) {
+	db := setupDB(t, "bootstrap_configured_test")
+
+	var out bytes.Buffer
+	created, err := EnsureAdmin(db, Admin{Username: "root", Email: "root@example.com", Password: "s3cret-from-env"}, &out, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Empty(t, out.String(), "配置的密码不输出")
+
+	var admin model.User
+	require.NoError(t, db.Where("username = ?", "root").First(&admin).Error)
+	assert.True(t, admin.CheckPassword("s3cret-from-env"))
+	assert.True(t, admin.MustChangePassword)
+}
+
+func TestCheckDefaultCredentials(t *testing.T) {
+	db := setupDB(t, "bootstrap_default_credentials_test")
+	logger := zap.NewNop().Sugar()
+
+	// 旧版本创建的 admin/admin
+	legacy := model.User{Username: "admin", Email: "admin@shorturl.com", Role: "admin", IsActive: true}
+	require.NoError(t, legacy.SetPassword("admin"))
+	require.NoError(t, db.Create(&legacy).Error)
+	other := model.User{Username: "ops", Email: "ops@example.com", Role: "admin", IsActive: true}
+	require.NoError(t, other.SetPassword("a-strong-password"))
+	require.NoError(t, db.Create(&other).Error)
+
+	err := CheckDefaultCredentials(db, nil, true, logger)
+	assert.ErrorIs(t, err, ErrDefaultCredentials)
+	assert.Contains(t, err.Error(), "admin")
+	assert.NotContains(t, err.Error(), "ops")
+
+	// 非 production 模式只要求修改密码
+	require.NoError(t, CheckDefaultCredentials(db, nil, false, logger))
+	require.NoError(t, db.First(&legacy, legacy.ID).Error)
+	assert.True(t, legacy.MustChangePassword)
+	require.NoError(t, db.First(&other, other.ID).Error)
+	assert.False(t, other.MustChangePassword)
+
+	require.NoError(t, db.Model(&legacy).Update("is_active", false).Error)
+	assert.NoError(t, CheckDefaultCredentials(db, nil, true, logger))
+}
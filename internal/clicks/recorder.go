@@ -0,0 +1,259 @@
+package clicks
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/visitors"
+	"shorturl-platform/pkg/geoip"
+	"shorturl-platform/pkg/useragent"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultBufferSize 是事件队列的默认容量
+	DefaultBufferSize = 10000
+	// DefaultBatchSize 是每批写入数据库的默认事件数
+	DefaultBatchSize = 200
+	// DefaultFlushInterval 是未攒满一批时的默认刷新间隔
+	DefaultFlushInterval = time.Second
+	// flushRetryDelay 是写入数据库失败后重试前的等待时间
+	flushRetryDelay = 500 * time.Millisecond
+)
+
+// Event 描述一次短链接点击
+type Event struct {
+	ShortLinkID uint
+	IPAddress   string
+	UserAgent   string
+	Referer     string
+	CreatedAt   time.Time
+}
+
+// Options 是 Recorder 的可选参数，零值字段使用默认值
+type Options struct {
+	BufferSize    int
+	BatchSize     int
+	FlushInterval time.Duration
+	Locator       geoip.Locator    // 用于解析点击 IP 的地理位置，为空时不解析
+	Visitors      visitors.Counter // 用于统计独立访客，为空时不统计
+}
+
+// Recorder 是一个有界、批量的异步点击写入器。
+// Record 永远不会阻塞重定向请求：队列已满时事件会被丢弃并计数；
+// 写入数据库失败时重试一次，仍然失败的事件同样会被丢弃并单独计数。
+type Recorder struct {
+	db            *gorm.DB
+	events        chan Event
+	batchSize     int
+	flushInterval time.Duration
+	retryDelay    time.Duration
+	locator       geoip.Locator
+	visitors      visitors.Counter
+	dropped       atomic.Uint64
+	failed        atomic.Uint64
+	stopChan      chan struct{}
+	done          chan struct{}
+	stopOnce      sync.Once
+	logger        *zap.SugaredLogger
+}
+
+// NewRecorder 创建一个新的点击写入器实例
+func NewRecorder(db *gorm.DB, opts Options, logger *zap.SugaredLogger) *Recorder {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.Locator == nil {
+		opts.Locator = geoip.NopLocator{}
+	}
+	return &Recorder{
+		db:            db,
+		events:        make(chan Event, opts.BufferSize),
+		batchSize:     opts.BatchSize,
+		flushInterval: opts.FlushInterval,
+		retryDelay:    flushRetryDelay,
+		locator:       opts.Locator,
+		visitors:      opts.Visitors,
+		stopChan:      make(chan struct{}),
+		done:          make(chan struct{}),
+		logger:        logger.Named("click_recorder"),
+	}
+}
+
+// Start 启动后台批量写入任务
+func (r *Recorder) Start() {
+	r.logger.Infof("启动点击写入器，队列容量 %d，批量大小 %d", cap(r.events), r.batchSize)
+	go r.run()
+}
+
+// Stop 停止写入器，并在返回前把队列中剩余的事件写入数据库
+func (r *Recorder) Stop() {
+	r.stopOnce.Do(func() {
+		r.logger.Info("正在停止点击写入器...")
+		close(r.stopChan)
+		<-r.done
+	})
+}
+
+// Record 提交一个点击事件，队列已满或写入器已停止时丢弃事件并返回 false
+func (r *Recorder) Record(e Event) bool {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	select {
+	case <-r.stopChan:
+		r.dropped.Add(1)
+		return false
+	default:
+	}
+	select {
+	case r.events <- e:
+		return true
+	default:
+		r.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped 返回因背压而丢弃的事件总数
+func (r *Recorder) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Failed 返回因写入数据库失败（重试后仍然失败）而丢弃的事件总数
+func (r *Recorder) Failed() uint64 {
+	return r.failed.Load()
+}
+
+// Pending 返回队列中尚未写入的事件数
+func (r *Recorder) Pending() int {
+	return len(r.events)
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, r.batchSize)
+	var reportedDropped uint64
+	for {
+		select {
+		case e := <-r.events:
+			batch = append(batch, e)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+			if dropped := r.Dropped(); dropped > reportedDropped {
+				r.logger.Warnf("点击队列已满，最近丢弃 %d 个事件，累计丢弃 %d 个", dropped-reportedDropped, dropped)
+				reportedDropped = dropped
+			}
+		case <-r.stopChan:
+			// 排空队列中剩余的事件
+			for {
+				select {
+				case e := <-r.events:
+					batch = append(batch, e)
+					if len(batch) >= r.batchSize {
+						r.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					if len(batch) > 0 {
+						r.flush(batch)
+					}
+					r.logger.Infof("点击写入器已停止，累计丢弃 %d 个事件，写入失败 %d 个。", r.Dropped(), r.Failed())
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 将一批事件写入 click_records，合并累加各链接的 click_count，并记录独立访客
+func (r *Recorder) flush(batch []Event) {
+	records := make([]model.ClickRecord, 0, len(batch))
+	counts := make(map[uint]int64)
+	visits := make([]visitors.Visit, 0, len(batch))
+	for _, e := range batch {
+		// 地理位置和 User-Agent 在后台解析，不占用重定向请求的时间
+		loc := r.locator.Lookup(e.IPAddress)
+		ua := useragent.Parse(e.UserAgent)
+		records = append(records, model.ClickRecord{
+			ShortLinkID: e.ShortLinkID,
+			IPAddress:   e.IPAddress,
+			UserAgent:   e.UserAgent,
+			Referer:     e.Referer,
+			Country:     loc.Country,
+			City:        loc.City,
+			Browser:     ua.Browser,
+			OS:          ua.OS,
+			DeviceType:  ua.Device,
+			IsBot:       ua.IsBot,
+			CreatedAt:   e.CreatedAt,
+		})
+		if !ua.IsBot {
+			counts[e.ShortLinkID]++
+		}
+		if !ua.IsBot {
+			visits = append(visits, visitors.Visit{
+				LinkID:      e.ShortLinkID,
+				Fingerprint: visitors.Fingerprint(e.IPAddress, e.UserAgent),
+				Time:        e.CreatedAt,
+			})
+		}
+	}
+
+	if r.visitors != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := r.visitors.Add(ctx, visits); err != nil {
+			r.logger.Errorf("记录 %d 个独立访客失败: %v", len(visits), err)
+		}
+		cancel()
+	}
+
+	// 写入在一个事务中完成，失败时整体回滚，重试不会重复累加 click_count
+	err := r.write(records, counts)
+	if err != nil {
+		r.logger.Warnf("写入 %d 个点击事件失败，%v 后重试: %v", len(batch), r.retryDelay, err)
+		time.Sleep(r.retryDelay)
+		err = r.write(records, counts)
+	}
+	if err != nil {
+		r.failed.Add(uint64(len(batch)))
+		r.logger.Errorf("重试后写入 %d 个点击事件仍然失败，已丢弃，累计写入失败 %d 个: %v", len(batch), r.Failed(), err)
+	}
+}
+
+// write 在一个事务中写入点击记录并累加各链接的 click_count
+func (r *Recorder) write(records []model.ClickRecord, counts map[uint]int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(records, r.batchSize).Error; err != nil {
+			return err
+		}
+		for linkID, n := range counts {
+			if err := tx.Model(&model.ShortLink{}).Where("id = ?", linkID).
+				Update("click_count", gorm.Expr("click_count + ?", n)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package clicks
+
+import (
+	"errors"
+	"shorturl-platform/internal/model"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRecorder_DropsUnderBackpressure(t *testing.T) {
+	// 未启动的写入器不会消费队列，可以稳定地模拟队列已满
+	r := NewRecorder(nil, Options{BufferSize: 2}, zap.NewNop().Sugar())
+
+	assert.True(t, r.Record(Event{ShortLinkID: 1}))
+	assert.True(t, r.Record(Event{ShortLinkID: 1}))
+	assert.False(t, r.Record(Event{ShortLinkID: 1}), "队列已满时应丢弃事件")
+	assert.Equal(t, uint64(1), r.Dropped())
+	assert.Equal(t, 2, r.Pending())
+}
+
+func TestRecorder_RetriesFailedFlush(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ShortLink{}, &model.ClickRecord{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	link := model.ShortLink{ShortCode: "retry", OriginalURL: "https://example.com", IsActive: true}
+	require.NoError(t, db.Create(&link).Error)
+
+	// 前 failures 次写入点击记录时返回错误
+	var failures atomic.Int32
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("test:fail", func(tx *gorm.DB) {
+		if tx.Statement.Table == "click_records" && failures.Add(-1) >= 0 {
+			tx.AddError(errors.New("database is unavailable"))
+		}
+	}))
+
+	flush := func(n int) *Recorder {
+		r := NewRecorder(db, Options{}, zap.NewNop().Sugar())
+		r.retryDelay = 0
+		batch := make([]Event, n)
+		for i := range batch {
+			batch[i] = Event{ShortLinkID: link.ID, IPAddress: "10.0.0.1", CreatedAt: time.Now()}
+		}
+		r.flush(batch)
+		return r
+	}
+
+	// 第一次失败后重试成功，click_count 只累加一次
+	failures.Store(1)
+	assert.Zero(t, flush(2).Failed())
+	require.NoError(t, db.First(&link, link.ID).Error)
+	assert.Equal(t, int64(2), link.ClickCount)
+
+	// 重试后仍然失败时丢弃，并计入 Failed
+	failures.Store(2)
+	assert.Equal(t, uint64(3), flush(3).Failed())
+	require.NoError(t, db.First(&link, link.ID).Error)
+	assert.Equal(t, int64(2), link.ClickCount)
+	var records int64
+	db.Model(&model.ClickRecord{}).Count(&records)
+	assert.Equal(t, int64(2), records)
+}
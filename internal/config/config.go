@@ -1,19 +1,27 @@
 package config
 
 import (
+	"errors"
 	"io/ioutil"
+	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // 主配置结构 - 简化命名
 type Config struct {
-	App       App    `yaml:"app"`
-	Server    Server `yaml:"server"`
-	Database  DB     `yaml:"database"`
-	Cache     Cache  `yaml:"cache"`
-	Auth      Auth   `yaml:"auth"`
-	RateLimit Limit  `yaml:"rate_limit"`
+	App       App       `yaml:"app"`
+	Server    Server    `yaml:"server"`
+	Database  DB        `yaml:"database"`
+	Cache     Cache     `yaml:"cache"`
+	Auth      Auth      `yaml:"auth"`
+	RateLimit Limit     `yaml:"rate_limit"`
+	Link      Link      `yaml:"link"`
+	ShortCode ShortCode `yaml:"shortcode"`
+	Analytics Analytics `yaml:"analytics"`
+	GeoIP     GeoIP     `yaml:"geoip"`
+	Mail      Mail      `yaml:"mail"`
 }
 
 // 应用配置
@@ -50,17 +58,159 @@ type Cache struct {
 
 // 认证配置
 type Auth struct {
-	Secret          string `yaml:"secret"`
-	Issuer          string `yaml:"issuer"`
-	ExpirationHours int    `yaml:"expiration_hours"`
+	Secret               string  `yaml:"secret"`
+	Issuer               string  `yaml:"issuer"`
+	ExpirationHours      int     `yaml:"expiration_hours"`       // 未配置 access_token_minutes 时访问令牌的有效期
+	AccessMinutes        int     `yaml:"access_token_minutes"`   // 访问令牌有效期，单位分钟
+	RefreshDays          int     `yaml:"refresh_token_days"`     // 刷新令牌有效期，单位天
+	RequireAdmin2FA      bool    `yaml:"require_admin_2fa"`      // 管理员必须通过两步验证登录才拥有管理员权限
+	RequireVerifiedEmail bool    `yaml:"require_verified_email"` // 未验证邮箱的用户不能创建短链接
+	BootstrapAdmin       Admin   `yaml:"bootstrap_admin"`
+	Lockout              Lockout `yaml:"lockout"`
+	Signing              Signing `yaml:"signing"`
+	OIDC                 OIDC    `yaml:"oidc"`
 }
 
-// 限流配置
-type Limit struct {
-	Enabled   bool     `yaml:"enabled"`
-	Requests  int64    `yaml:"requests_per_minute"`
-	Burst     int64    `yaml:"burst"`
-	SkipPaths []string `yaml:"skip_paths"`
+// 初始管理员配置，只在数据库中没有管理员时使用。环境变量 SHORTURL_ADMIN_USERNAME、
+// SHORTURL_ADMIN_EMAIL、SHORTURL_ADMIN_PASSWORD 优先于配置文件
+type Admin struct {
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"` // 为空时生成随机密码，只在启动时输出一次
+}
+
+// OIDC 登录配置，启用后用户可以使用企业身份提供方登录，首次登录时自动创建本地用户
+type OIDC struct {
+	Enabled       bool              `yaml:"enabled"`
+	Name          string            `yaml:"name"` // 登录按钮上显示的名称
+	Issuer        string            `yaml:"issuer"`
+	ClientID      string            `yaml:"client_id"`
+	ClientSecret  string            `yaml:"client_secret"`
+	RedirectURL   string            `yaml:"redirect_url"` // 需要在提供方登记，形如 https://s.example.com/auth/oidc/callback
+	Scopes        []string          `yaml:"scopes"`
+	UsernameClaim string            `yaml:"username_claim"` // 新用户的用户名来源，默认 preferred_username
+	RoleClaim     string            `yaml:"role_claim"`     // 用于角色映射的声明，如 groups，为空时新用户使用默认角色且不再同步
+	RoleMapping   map[string]string `yaml:"role_mapping"`   // 声明值到本地角色的映射
+	DefaultRole   string            `yaml:"default_role"`   // 没有匹配的映射时使用的角色，默认 user
+}
+
+// 非对称签名配置，未配置密钥时使用 secret 进行 HS256 签名
+type Signing struct {
+	Keys []SigningKey `yaml:"keys"`
+}
+
+// 签名密钥及其轮换计划：生效时间最晚的可用密钥用于签名，其他未过期的密钥继续用于验证
+type SigningKey struct {
+	ID         string    `yaml:"kid"`
+	PrivateKey string    `yaml:"private_key"` // PEM 私钥文件路径，支持 RSA (RS256) 和 Ed25519 (EdDSA)
+	NotBefore  time.Time `yaml:"not_before"`  // 开始用于签名的时间，为空时立即生效
+	ExpiresAt  time.Time `yaml:"expires_at"`  // 停止验证的时间，为空时永不过期
+}
+
+// AccessTTL 返回访问令牌的有效期
+func (a Auth) AccessTTL() time.Duration {
+	if a.AccessMinutes > 0 {
+		return time.Duration(a.AccessMinutes) * time.Minute
+	}
+	if a.ExpirationHours > 0 {
+		return time.Duration(a.ExpirationHours) * time.Hour
+	}
+	return 15 * time.Minute
+}
+
+// RefreshTTL 返回刷新令牌的有效期，每次刷新都会签发新的刷新令牌并重新计时
+func (a Auth) RefreshTTL() time.Duration {
+	if a.RefreshDays > 0 {
+		return time.Duration(a.RefreshDays) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// 登录失败锁定配置，未配置的项使用默认值
+type Lockout struct {
+	MaxAttempts   int `yaml:"max_attempts"`    // 同一用户名在统计窗口内允许的失败次数，默认 5
+	IPMaxAttempts int `yaml:"ip_max_attempts"` // 同一 IP 在统计窗口内允许的失败次数，默认 20
+	Window        int `yaml:"window"`          // 失败次数统计窗口，单位秒，默认 900
+	BaseLockout   int `yaml:"base_lockout"`    // 首次锁定时长，单位秒，之后每次翻倍，默认 60
+	MaxLockout    int `yaml:"max_lockout"`     // 锁定时长上限，单位秒，默认 3600
+}
+
+// 短链接生命周期配置
+type Link struct {
+	FallbackURL   string `yaml:"fallback_url"`   // 过期链接的跳转地址，为空时返回 410 Gone
+	SweepInterval int    `yaml:"sweep_interval"` // 过期链接清理间隔，单位秒
+}
+
+// 短码生成配置，字段为空时使用默认值
+type ShortCode struct {
+	Strategy string  `yaml:"strategy"` // random（随机生成并查重，默认）、feistel（计数器 + Feistel 置换）或 hashids
+	Length   int     `yaml:"length"`   // 短码长度，默认 7；hashids 策略下为最小长度
+	Charset  string  `yaml:"charset"`  // 短码字符集，默认 base62，只能使用字母、数字、'-' 和 '_'
+	Secret   string  `yaml:"secret"`   // feistel 和 hashids 打乱编号的密钥，为空时由 auth.secret 派生；上线后不要修改
+	Segment  Segment `yaml:"segment"`
+	Filter   Filter  `yaml:"filter"`
+}
+
+// 号段配置，feistel 和 hashids 策略按号段预留编号，多个实例分配到的编号互不重叠
+type Segment struct {
+	Store string `yaml:"store"` // db（code_sequences 表，默认）或 redis（INCRBY，需要开启持久化）
+	Step  int    `yaml:"step"`  // 每次预留的编号数量，默认 1000
+}
+
+// 短码过滤器配置，查重时先查询布隆过滤器，判断为不存在的短码不再访问数据库
+type Filter struct {
+	Enabled           bool    `yaml:"enabled"`
+	Store             string  `yaml:"store"`               // memory（进程内可扩展布隆过滤器，默认）或 redis（RedisBloom，多实例共享）
+	Capacity          uint64  `yaml:"capacity"`            // 第一层的容量，超出后自动扩展，默认 100000
+	FalsePositiveRate float64 `yaml:"false_positive_rate"` // 目标误判率，默认 0.001
+}
+
+// 点击统计配置
+type Analytics struct {
+	BufferSize      int `yaml:"buffer_size"`       // 点击事件队列容量
+	BatchSize       int `yaml:"batch_size"`        // 每批写入的事件数
+	FlushIntervalMs int `yaml:"flush_interval_ms"` // 未攒满一批时的刷新间隔，单位毫秒
+}
+
+// GeoIP 配置，Database 为空时不解析点击的地理位置
+type GeoIP struct {
+	Database       string `yaml:"database"`        // 本地 MaxMind 格式 (MMDB) 数据库文件路径
+	Language       string `yaml:"language"`        // 城市名称的语言，默认 en
+	ReloadInterval int    `yaml:"reload_interval"` // 检查数据库文件变更的间隔，单位秒
+}
+
+// 邮件配置，用于发送密码重置和邮箱验证邮件
+type Mail struct {
+	Driver  string `yaml:"driver"`   // log（写入日志，默认）、file（保存为 .eml 文件）或 smtp
+	From    string `yaml:"from"`     // 发件人地址
+	BaseURL string `yaml:"base_url"` // 邮件中链接指向的站点地址，如 https://s.example.com
+	Dir     string `yaml:"dir"`      // driver 为 file 时邮件保存的目录
+	SMTP    SMTP   `yaml:"smtp"`
+	// Secret 是签名密码重置和邮箱验证链接的密钥，必须单独配置，不能与 auth.secret 相同。
+	// 也可以通过环境变量 SHORTURL_MAIL_SECRET 设置，修改后已发出的链接全部失效
+	Secret string `yaml:"secret"`
+}
+
+// MailSecretPlaceholder 是配置文件示例中的 mail.secret，使用它时拒绝启动
+const MailSecretPlaceholder = "your-mail-token-secret-change-in-production"
+
+// validate 检查邮件链接的签名密钥，authSecret 为访问令牌使用的 auth.secret
+func (m *Mail) validate(authSecret string) error {
+	switch m.Secret {
+	case "", MailSecretPlaceholder:
+		return errors.New("必须配置 mail.secret（或环境变量 SHORTURL_MAIL_SECRET），用于签名密码重置和邮箱验证链接")
+	case authSecret:
+		return errors.New("mail.secret 不能与 auth.secret 相同")
+	}
+	return nil
+}
+
+// SMTP 服务器配置，端口 465 使用隐式 TLS，其他端口在服务器支持时使用 STARTTLS
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
 // 加载配置
@@ -74,6 +224,28 @@ func Load(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.RateLimit.validate(); err != nil {
+		return nil, err
+	}
+	cfg.applyEnv()
+	if err := cfg.Mail.validate(cfg.Auth.Secret); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
+
+// applyEnv 使用环境变量覆盖配置，密码等敏感信息可以不写入配置文件
+func (c *Config) applyEnv() {
+	overrides := map[string]*string{
+		"SHORTURL_ADMIN_USERNAME": &c.Auth.BootstrapAdmin.Username,
+		"SHORTURL_ADMIN_EMAIL":    &c.Auth.BootstrapAdmin.Email,
+		"SHORTURL_ADMIN_PASSWORD": &c.Auth.BootstrapAdmin.Password,
+		"SHORTURL_MAIL_SECRET":    &c.Mail.Secret,
+	}
+	for name, field := range overrides {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			*field = value
+		}
+	}
+}
@@ -1 +1,67 @@
 package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// 限流配置
+type Limit struct {
+	Enabled   bool     `yaml:"enabled"`
+	Requests  int64    `yaml:"requests_per_minute"` // 默认策略：每分钟允许的请求数
+	Burst     int64    `yaml:"burst"`               // 默认策略：瞬时允许的最大请求数
+	SkipPaths []string `yaml:"skip_paths"`
+	// Policies 是按名称配置的限流策略，在 registerRoutes 中挂载到对应的路由组，
+	// 未配置的策略名称会使用上面的默认策略
+	Policies map[string]LimitPolicy `yaml:"policies"`
+}
+
+// 命名限流策略
+type LimitPolicy struct {
+	Requests int64  `yaml:"requests"` // 每个窗口允许的请求数
+	Window   string `yaml:"window"`   // 窗口长度，例如 "1m"、"1h"，也可写作 "minute"、"hour"
+	Burst    int64  `yaml:"burst"`    // 瞬时允许的最大请求数，默认等于 requests
+}
+
+// WindowDuration 解析窗口长度
+func (p LimitPolicy) WindowDuration() (time.Duration, error) {
+	switch p.Window {
+	case "", "minute":
+		return time.Minute, nil
+	case "second":
+		return time.Second, nil
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(p.Window)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("窗口长度必须大于 0")
+	}
+	return d, nil
+}
+
+// Policy 返回指定名称的策略，未配置时返回由 requests_per_minute 和 burst 组成的默认策略
+func (l *Limit) Policy(name string) LimitPolicy {
+	if p, ok := l.Policies[name]; ok {
+		return p
+	}
+	return LimitPolicy{Requests: l.Requests, Window: "minute", Burst: l.Burst}
+}
+
+// validate 校验所有命名策略
+func (l *Limit) validate() error {
+	for name, p := range l.Policies {
+		if p.Requests <= 0 {
+			return fmt.Errorf("限流策略 %s 的 requests 必须大于 0", name)
+		}
+		if _, err := p.WindowDuration(); err != nil {
+			return fmt.Errorf("限流策略 %s 的 window 无效: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"shorturl-platform/internal/account"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AccountHandler 包含修改密码、重置密码和邮箱验证的处理器
+type AccountHandler struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	accounts *account.Service
+	sessions *session.Service
+}
+
+// NewAccountHandler 创建一个新的 AccountHandler
+func NewAccountHandler(db *gorm.DB, redis *redis.Client, accounts *account.Service, sessions *session.Service) *AccountHandler {
+	return &AccountHandler{db: db, redis: redis, accounts: accounts, sessions: sessions}
+}
+
+// ChangePasswordRequest 定义了修改密码请求的结构体
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6" example:"new-password123"`
+}
+
+// ForgotPasswordRequest 定义了找回密码请求的结构体
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+}
+
+// ResetPasswordByTokenRequest 定义了通过邮件链接重置密码请求的结构体
+type ResetPasswordByTokenRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6" example:"new-password123"`
+}
+
+// VerifyEmailRequest 定义了验证邮箱请求的结构体
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangePassword godoc
+// @Summary 修改密码
+// @Description 校验当前密码后设置新密码，新密码不能与当前密码相同。修改后该用户的所有会话都会被撤销，响应中返回当前设备的新令牌
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   ChangePasswordRequest  true  "当前密码和新密码"
+// @Success 200 {object} AuthResponse "成功响应"
+// @Failure 400 {object} gin.H "请求无效、当前密码错误或新密码与当前密码相同"
+// @Router /api/me/password [post]
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	var user model.User
+	if err := h.db.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	err := h.accounts.ChangePassword(c.Request.Context(), &user, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, account.ErrWrongPassword) || errors.Is(err, account.ErrSamePassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		zap.S().Errorf("修改密码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+	if !h.passwordChanged(c, &user) {
+		return
+	}
+
+	// 其他设备上的会话已全部撤销，当前设备沿用本次登录的认证方式开启新的会话
+	var amr []string
+	if claims, ok := c.Get("claims"); ok {
+		amr = claims.(*auth.Claims).AMR
+	}
+	pair, err := h.sessions.Issue(c.Request.Context(), &user, clientInfo(c), amr)
+	if err != nil {
+		zap.S().Errorf("修改密码后生成令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码已修改，请重新登录"})
+		return
+	}
+	c.JSON(http.StatusOK, newAuthResponse(pair))
+}
+
+// ForgotPassword godoc
+// @Summary 找回密码
+// @Description 向邮箱发送重置密码的链接，链接 1 小时内有效。无论邮箱是否注册都返回相同的响应
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   ForgotPasswordRequest  true  "注册邮箱"
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Router /auth/password/forgot [post]
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	if err := h.accounts.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		zap.S().Errorf("发送重置密码邮件失败: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，重置密码的邮件已发送"})
+}
+
+// ResetPassword godoc
+// @Summary 重置密码
+// @Description 使用重置密码邮件中的令牌设置新密码，令牌只能使用一次。重置后该用户的所有会话都会被撤销
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   ResetPasswordByTokenRequest  true  "令牌和新密码"
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 400 {object} gin.H "请求无效或链接已过期"
+// @Router /auth/password/reset [post]
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordByTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, err := h.accounts.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	if errors.Is(err, account.ErrInvalidToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		zap.S().Errorf("重置密码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+	if !h.passwordChanged(c, user) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+// SendVerification godoc
+// @Summary 发送验证邮件
+// @Description 向当前用户的邮箱重新发送验证链接，链接 24 小时内有效
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce  json
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 409 {object} gin.H "邮箱已验证"
+// @Router /api/me/email/verify [post]
+func (h *AccountHandler) SendVerification(c *gin.Context) {
+	var user model.User
+	if err := h.db.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	err := h.accounts.SendVerification(c.Request.Context(), &user)
+	if errors.Is(err, account.ErrAlreadyVerified) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		zap.S().Errorf("发送验证邮件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送验证邮件失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "验证邮件已发送"})
+}
+
+// VerifyEmail godoc
+// @Summary 验证邮箱
+// @Description 提交验证邮件中的令牌完成邮箱验证，不需要登录
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   VerifyEmailRequest  true  "令牌"
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 400 {object} gin.H "请求无效或链接已过期"
+// @Router /auth/email/verify [post]
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, err := h.accounts.VerifyEmail(c.Request.Context(), req.Token)
+	if errors.Is(err, account.ErrInvalidToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		zap.S().Errorf("验证邮箱失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证邮箱失败"})
+		return
+	}
+	invalidateUserCache(h.redis, user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "邮箱验证成功"})
+}
+
+// passwordChanged 密码变更后清除登录缓存并撤销该用户的所有会话，失败时已写入响应并返回 false
+func (h *AccountHandler) passwordChanged(c *gin.Context, user *model.User) bool {
+	invalidateUserCache(h.redis, user.Username)
+	if err := h.sessions.RevokeUser(c.Request.Context(), user.ID); err != nil {
+		zap.S().Errorf("撤销会话失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码已修改，但撤销已有会话失败，请重试"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"shorturl-platform/internal/account"
+	"shorturl-platform/internal/loginguard"
+	"shorturl-platform/internal/mfa"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+	"shorturl-platform/pkg/mailer"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// outbox 记录发出的邮件
+type outbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (o *outbox) Send(_ context.Context, msg mailer.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// token 返回最后一封邮件中链接携带的令牌
+func (o *outbox) token(t *testing.T) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	require.NotEmpty(t, o.messages)
+	m := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(o.messages[len(o.messages)-1].Body)
+	require.NotNil(t, m)
+	token, err := url.QueryUnescape(m[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestAccountHandler_PasswordAndEmailFlows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:account_handler_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RefreshToken{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	logger := zap.NewNop().Sugar()
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	sessions := session.NewService(db, tokens, session.NewDenylist(nil), time.Hour, logger)
+	box := &outbox{}
+	accounts := account.NewService(db, box, "test-secret", "http://localhost:8080", logger)
+	authHandler := NewAuthHandler(db, nil, tokens, sessions, loginguard.New(nil, loginguard.Options{}, logger),
+		mfa.NewService(db, nil, "test", logger), accounts, false)
+	h := NewAccountHandler(db, nil, accounts, sessions)
+
+	router := gin.New()
+	router.Use(testIdentity())
+	router.POST("/auth/register", authHandler.Register)
+	router.POST("/auth/login", authHandler.Login)
+	router.POST("/auth/password/forgot", h.ForgotPassword)
+	router.POST("/auth/password/reset", h.ResetPassword)
+	router.POST("/auth/email/verify", h.VerifyEmail)
+	router.POST("/api/me/password", h.ChangePassword)
+	router.POST("/api/me/email/verify", h.SendVerification)
+
+	// 注册后发送验证邮件
+	w := doRequest(router, http.MethodPost, "/auth/register", "", "",
+		RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "password1"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	// 邮箱已被使用（包括已删除的用户）时返回 400 而不是 500
+	w = doRequest(router, http.MethodPost, "/auth/register", "", "",
+		RegisterRequest{Username: "alice2", Email: "alice@example.com", Password: "password1"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	accounts.Wait()
+	var user model.User
+	require.NoError(t, db.Where("username = ?", "alice").First(&user).Error)
+	assert.False(t, user.EmailVerified)
+	uid := strconv.Itoa(int(user.ID))
+
+	w = doRequest(router, http.MethodPost, "/auth/email/verify", "", "", VerifyEmailRequest{Token: "forged"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(router, http.MethodPost, "/auth/email/verify", "", "", VerifyEmailRequest{Token: box.token(t)})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, http.MethodPost, "/api/me/email/verify", uid, "user", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 修改密码：当前密码错误时拒绝，成功后旧会话失效并返回新令牌
+	old, err := sessions.Issue(t.Context(), &user, session.Client{}, nil)
+	require.NoError(t, err)
+	w = doRequest(router, http.MethodPost, "/api/me/password", uid, "user",
+		ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "password2"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(router, http.MethodPost, "/api/me/password", uid, "user",
+		ChangePasswordRequest{CurrentPassword: "password1", NewPassword: "password2"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var changed AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &changed))
+	assert.NotEmpty(t, changed.RefreshToken)
+	_, err = sessions.Refresh(t.Context(), old.RefreshToken, session.Client{})
+	assert.Error(t, err)
+
+	// 找回密码：未注册的邮箱返回相同的响应
+	sent := len(box.messages)
+	w = doRequest(router, http.MethodPost, "/auth/password/forgot", "", "", ForgotPasswordRequest{Email: "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	accounts.Wait()
+	assert.Len(t, box.messages, sent)
+
+	w = doRequest(router, http.MethodPost, "/auth/password/forgot", "", "", ForgotPasswordRequest{Email: "alice@example.com"})
+	require.Equal(t, http.StatusOK, w.Code)
+	accounts.Wait()
+	token := box.token(t)
+	reset := ResetPasswordByTokenRequest{Token: token, NewPassword: "password3"}
+	w = doRequest(router, http.MethodPost, "/auth/password/reset", "", "", reset)
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err = sessions.Refresh(t.Context(), changed.RefreshToken, session.Client{})
+	assert.Error(t, err, "重置密码后所有会话失效")
+
+	// 重置链接只能使用一次
+	w = doRequest(router, http.MethodPost, "/auth/password/reset", "", "", reset)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(router, http.MethodPost, "/auth/login", "", "", LoginRequest{Username: "alice", Password: "password3"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 必须修改密码的用户登录后令牌中带有 pwd_change，修改密码后解除
+	require.NoError(t, db.Model(&user).Update("must_change_password", true).Error)
+	w = doRequest(router, http.MethodPost, "/auth/login", "", "", LoginRequest{Username: "alice", Password: "password3"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var login AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	assert.True(t, login.PasswordChangeRequired)
+	claims, err := tokens.ValidateToken(login.Token)
+	require.NoError(t, err)
+	assert.True(t, claims.PasswordChange)
+
+	w = doRequest(router, http.MethodPost, "/api/me/password", uid, "user",
+		ChangePasswordRequest{CurrentPassword: "password3", NewPassword: "password3"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "新密码不能与当前密码相同")
+	w = doRequest(router, http.MethodPost, "/api/me/password", uid, "user",
+		ChangePasswordRequest{CurrentPassword: "password3", NewPassword: "password4"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	claims, err = tokens.ValidateToken(login.Token)
+	require.NoError(t, err)
+	assert.False(t, claims.PasswordChange)
+}
@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"shorturl-platform/internal/loginguard"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	"shorturl-platform/internal/workspace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AdminHandler 包含管理员专用的处理器
+type AdminHandler struct {
+	db         *gorm.DB
+	redis      *redis.Client
+	sessions   *session.Service
+	loginGuard *loginguard.Guard
+}
+
+// NewAdminHandler 创建一个新的 AdminHandler
+func NewAdminHandler(db *gorm.DB, redis *redis.Client, sessions *session.Service, loginGuard *loginguard.Guard) *AdminHandler {
+	return &AdminHandler{db: db, redis: redis, sessions: sessions, loginGuard: loginGuard}
+}
+
+// UserResponse 定义了管理员查看的用户信息，不包含密码摘要和两步验证密钥
+type UserResponse struct {
+	ID          uint       `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	IsActive    bool       `json:"is_active"`
+	TOTPEnabled bool       `json:"totp_enabled"`
+	LastLogin   *time.Time `json:"last_login"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// newUserResponse 将用户模型转换为响应
+func newUserResponse(u *model.User) UserResponse {
+	return UserResponse{
+		ID:          u.ID,
+		Username:    u.Username,
+		Email:       u.Email,
+		Role:        u.Role,
+		IsActive:    u.IsActive,
+		TOTPEnabled: u.TOTPEnabled,
+		LastLogin:   u.LastLogin,
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+// UserListResponse 定义了用户列表的响应
+type UserListResponse struct {
+	Users    []UserResponse `json:"users"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+}
+
+// UpdateUserRequest 定义了修改用户请求的结构体，未提供的字段保持不变
+type UpdateUserRequest struct {
+	Role     *string `json:"role" binding:"omitempty,oneof=user admin" example:"admin"`
+	IsActive *bool   `json:"is_active" example:"false"`
+}
+
+// ResetPasswordRequest 定义了重置密码请求的结构体
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"omitempty,min=6"` // 为空时生成随机的临时密码
+}
+
+// ListUsers godoc
+// @Summary 用户列表
+// @Description 分页列出用户，q 按用户名或邮箱模糊搜索，可按角色和状态筛选
+// @Tags Admin
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   q          query  string  false  "用户名或邮箱关键字"
+// @Param   role       query  string  false  "角色: user 或 admin"
+// @Param   active     query  bool    false  "是否启用"
+// @Param   page       query  int     false  "页码，从 1 开始"
+// @Param   page_size  query  int     false  "每页数量，默认 20，最大 100"
+// @Success 200 {object} UserListResponse "成功响应"
+// @Failure 403 {object} gin.H "需要管理员权限"
+// @Router /api/admin/users [get]
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	query := h.db.Model(&model.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + q + "%"
+		query = query.Where("username LIKE ? OR email LIKE ?", pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if active := c.Query("active"); active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 active 参数"})
+			return
+		}
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page = max(page, 1)
+	pageSize = min(max(pageSize, 1), 100)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		zap.S().Errorf("查询用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+		return
+	}
+	var users []model.User
+	if err := query.Order("id").Limit(pageSize).Offset((page - 1) * pageSize).Find(&users).Error; err != nil {
+		zap.S().Errorf("查询用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询用户失败"})
+		return
+	}
+
+	resp := UserListResponse{Users: make([]UserResponse, len(users)), Total: total, Page: page, PageSize: pageSize}
+	for i := range users {
+		resp.Users[i] = newUserResponse(&users[i])
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateUser godoc
+// @Summary 修改用户
+// @Description 修改用户的角色或启用状态。修改后该用户的所有会话立即失效，需要重新登录。不能修改自己，也不能移除最后一个可用的管理员
+// @Tags Admin
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                true  "用户 ID"
+// @Param   body  body  UpdateUserRequest  true  "修改内容"
+// @Success 200 {object} UserResponse "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 404 {object} gin.H "用户不存在"
+// @Failure 409 {object} gin.H "不能移除最后一个管理员"
+// @Router /api/admin/users/{id} [patch]
+func (h *AdminHandler) UpdateUser(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Role != nil && *req.Role != user.Role {
+		updates["role"] = *req.Role
+	}
+	if req.IsActive != nil && *req.IsActive != user.IsActive {
+		updates["is_active"] = *req.IsActive
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, newUserResponse(user))
+		return
+	}
+	demoted := req.Role != nil && *req.Role != "admin"
+	deactivated := req.IsActive != nil && !*req.IsActive
+	if !h.checkAdminRemoval(c, user, demoted || deactivated) {
+		return
+	}
+
+	if err := h.db.Model(user).Updates(updates).Error; err != nil {
+		zap.S().Errorf("修改用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改用户失败"})
+		return
+	}
+	// 访问令牌中携带角色，修改后撤销已有会话使新的角色和状态立即生效
+	h.userChanged(c, user)
+	h.audit(c, "管理员修改了用户", user, "changes", updates)
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ResetPassword godoc
+// @Summary 重置用户密码
+// @Description 为用户设置新密码，未提供密码时生成一个随机的临时密码并在响应中返回。无论密码由谁提供，用户登录后都必须先修改密码。用户的所有会话立即失效
+// @Tags Admin
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                   true   "用户 ID"
+// @Param   body  body  ResetPasswordRequest  false  "新密码"
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 404 {object} gin.H "用户不存在"
+// @Router /api/admin/users/{id}/reset-password [post]
+func (h *AdminHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	password := req.Password
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = randomPassword(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成临时密码失败"})
+			return
+		}
+	}
+	if err := user.SetPassword(password); err != nil {
+		zap.S().Errorf("密码加密失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+		return
+	}
+	// 管理员知道重置后的密码，无论是生成的还是管理员输入的，用户登录后都必须先修改密码
+	err := h.db.Model(user).Updates(map[string]any{"password_hash": user.PasswordHash, "must_change_password": true}).Error
+	if err != nil {
+		zap.S().Errorf("重置密码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+
+	h.userChanged(c, user)
+	h.audit(c, "管理员重置了用户密码", user, "generated", generated)
+	resp := gin.H{"message": "密码已重置，用户需要使用新密码重新登录"}
+	if generated {
+		resp["temporary_password"] = password
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteUser godoc
+// @Summary 删除用户
+// @Description 删除用户并使其所有会话和 API 密钥失效，同时移除其工作区成员关系。用户创建的短链接保留，管理员仍可管理。
+// @Description 不能删除自己，不能删除最后一个可用的管理员，也不能删除工作区唯一的所有者（需要先转让所有权或删除工作区）
+// @Tags Admin
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   id   path  int  true  "用户 ID"
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 400 {object} gin.H "无效的用户 ID"
+// @Failure 404 {object} gin.H "用户不存在"
+// @Failure 409 {object} gin.H "不能删除最后一个管理员或工作区唯一的所有者"
+// @Router /api/admin/users/{id} [delete]
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+	if !h.checkAdminRemoval(c, user, true) {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := workspace.RemoveUser(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+	var soleOwner *workspace.SoleOwnerError
+	if errors.As(err, &soleOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": soleOwner.Error(), "workspaces": soleOwner.Workspaces})
+		return
+	}
+	if err != nil {
+		zap.S().Errorf("删除用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
+		return
+	}
+
+	h.userChanged(c, user)
+	h.audit(c, "管理员删除了用户", user)
+	c.JSON(http.StatusOK, gin.H{"message": "用户已删除"})
+}
+
+// targetUser 读取路径中的用户，管理员不能通过这些接口修改自己，避免误操作把自己锁在系统外
+func (h *AdminHandler) targetUser(c *gin.Context) (*model.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户 ID"})
+		return nil, false
+	}
+	if uint(id) == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的账户，请由其他管理员操作"})
+		return nil, false
+	}
+	var user model.User
+	if err := h.db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkAdminRemoval 操作会使一个可用的管理员失去权限时，确认系统中还有其他可用的管理员
+func (h *AdminHandler) checkAdminRemoval(c *gin.Context, user *model.User, removing bool) bool {
+	if !removing || user.Role != "admin" || !user.IsActive {
+		return true
+	}
+	var others int64
+	err := h.db.Model(&model.User{}).
+		Where("role = ? AND is_active = ? AND id <> ?", "admin", true, user.ID).
+		Count(&others).Error
+	if err != nil {
+		zap.S().Errorf("查询管理员失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询管理员失败"})
+		return false
+	}
+	if others == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "至少需要保留一个可用的管理员"})
+		return false
+	}
+	return true
+}
+
+// userChanged 用户信息变更后清除登录缓存并撤销该用户的所有会话
+func (h *AdminHandler) userChanged(c *gin.Context, user *model.User) {
+	invalidateUserCache(h.redis, user.Username)
+	if err := h.sessions.RevokeUser(c.Request.Context(), user.ID); err != nil {
+		zap.S().Errorf("撤销用户会话失败: %v", err)
+	}
+}
+
+// audit 记录管理员操作
+func (h *AdminHandler) audit(c *gin.Context, msg string, user *model.User, keysAndValues ...any) {
+	fields := append([]any{
+		"username", user.Username, "user_id", user.ID,
+		"operator", c.GetString("username"), "operator_id", currentUserID(c), "ip", c.ClientIP(),
+	}, keysAndValues...)
+	zap.S().Named("admin").Infow(msg, fields...)
+}
+
+// randomPassword 生成临时密码
+func randomPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// UnlockUser godoc
+// @Summary 解锁用户
+// @Description 解除因登录失败次数过多导致的账户锁定，并清除失败记录。按 IP 的锁定只在传入 ip 时解除
+// @Tags Admin
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   id   path   int     true   "用户 ID"
+// @Param   ip   query  string  false  "同时解除该 IP 的锁定"
+// @Success 200 {object} gin.H "解锁成功"
+// @Failure 400 {object} gin.H "无效的用户 ID"
+// @Failure 403 {object} gin.H "需要管理员权限"
+// @Failure 404 {object} gin.H "用户不存在"
+// @Router /api/admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户 ID"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+	if err := h.loginGuard.Unlock(ctx, user.Username); err != nil {
+		zap.S().Errorf("解锁用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁用户失败"})
+		return
+	}
+	// 按 IP 的锁定与账户无关，管理员需要从登录失败日志中确认 IP 后显式解除
+	ip := c.Query("ip")
+	if ip != "" {
+		if net.ParseIP(ip) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 IP 地址"})
+			return
+		}
+		if err := h.loginGuard.UnlockIP(ctx, ip); err != nil {
+			zap.S().Errorf("解锁 IP 失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁 IP 失败"})
+			return
+		}
+	}
+
+	zap.S().Named("loginguard").Infow("管理员解除了账户锁定",
+		"username", user.Username, "user_id", user.ID, "unlocked_ip", ip,
+		"operator", c.GetString("username"), "operator_id", currentUserID(c), "ip", c.ClientIP())
+	resp := gin.H{"message": "账户已解锁", "username": user.Username}
+	if ip != "" {
+		resp["unlocked_ip"] = ip
+	} else {
+		resp["note"] = "按 IP 的锁定未解除，如用户所在 IP 仍被锁定，请通过 ip 参数解除"
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"shorturl-platform/internal/loginguard"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAdminHandler_ManageUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:admin_handler_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RefreshToken{}, &model.Workspace{}, &model.WorkspaceMember{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	admin := model.User{Username: "root", Email: "root@example.com", PasswordHash: "x", Role: "admin", IsActive: true}
+	require.NoError(t, db.Create(&admin).Error)
+	for i := 1; i <= 3; i++ {
+		u := model.User{Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i), PasswordHash: "x", Role: "user", IsActive: true}
+		require.NoError(t, db.Create(&u).Error)
+	}
+
+	logger := zap.NewNop().Sugar()
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	sessions := session.NewService(db, tokens, session.NewDenylist(nil), time.Hour, logger)
+	h := NewAdminHandler(db, nil, sessions, loginguard.New(nil, loginguard.Options{}, logger))
+
+	router := gin.New()
+	router.Use(testIdentity())
+	router.GET("/api/admin/users", h.ListUsers)
+	router.PATCH("/api/admin/users/:id", h.UpdateUser)
+	router.DELETE("/api/admin/users/:id", h.DeleteUser)
+	router.POST("/api/admin/users/:id/reset-password", h.ResetPassword)
+
+	operator := strconv.Itoa(int(admin.ID))
+	var user model.User
+	require.NoError(t, db.Where("username = ?", "user2").First(&user).Error)
+	path := fmt.Sprintf("/api/admin/users/%d", user.ID)
+
+	// 搜索和分页
+	w := doRequest(router, http.MethodGet, "/api/admin/users?q=user&page_size=2", operator, "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list UserListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, int64(3), list.Total)
+	assert.Len(t, list.Users, 2)
+	assert.NotContains(t, w.Body.String(), "PasswordHash")
+
+	// 修改角色和状态后该用户的会话立即失效
+	pair, err := sessions.Issue(t.Context(), &user, session.Client{}, nil)
+	require.NoError(t, err)
+	w = doRequest(router, http.MethodPatch, path, operator, "admin", gin.H{"role": "admin", "is_active": false})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"is_active":false`)
+	require.NoError(t, db.First(&user, user.ID).Error)
+	assert.Equal(t, "admin", user.Role)
+	assert.False(t, user.IsActive)
+	_, err = sessions.Refresh(t.Context(), pair.RefreshToken, session.Client{})
+	assert.Error(t, err)
+
+	w = doRequest(router, http.MethodPatch, path, operator, "admin", gin.H{"role": "owner"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 不能修改自己，避免最后一个管理员把自己降级或禁用
+	w = doRequest(router, http.MethodPatch, fmt.Sprintf("/api/admin/users/%d", admin.ID), operator, "admin", gin.H{"role": "user"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 未提供密码时生成临时密码
+	w = doRequest(router, http.MethodPost, path+"/reset-password", operator, "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var reset map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reset))
+	require.NoError(t, db.First(&user, user.ID).Error)
+	assert.True(t, user.CheckPassword(reset["temporary_password"]))
+	assert.True(t, user.MustChangePassword, "临时密码登录后必须修改")
+
+	// 管理员输入的密码同样需要用户登录后修改
+	require.NoError(t, db.Model(&user).Update("must_change_password", false).Error)
+	w = doRequest(router, http.MethodPost, path+"/reset-password", operator, "admin", gin.H{"password": "chosen-by-admin"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "temporary_password")
+	require.NoError(t, db.First(&user, user.ID).Error)
+	assert.True(t, user.CheckPassword("chosen-by-admin"))
+	assert.True(t, user.MustChangePassword, "管理员设置的密码登录后也必须修改")
+
+	// 用户是工作区唯一的所有者时不能删除，转让所有权后删除并移除成员关系
+	var other model.User
+	require.NoError(t, db.Where("username = ?", "user3").First(&other).Error)
+	ws := model.Workspace{Name: "team", CreatedBy: user.ID}
+	require.NoError(t, db.Create(&ws).Error)
+	require.NoError(t, db.Create(&model.WorkspaceMember{WorkspaceID: ws.ID, UserID: user.ID, Role: "owner"}).Error)
+	require.NoError(t, db.Create(&model.WorkspaceMember{WorkspaceID: ws.ID, UserID: other.ID, Role: "editor"}).Error)
+	w = doRequest(router, http.MethodDelete, path, operator, "admin", nil)
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "team")
+	require.NoError(t, db.First(&model.User{}, user.ID).Error)
+
+	require.NoError(t, db.Model(&model.WorkspaceMember{}).Where("user_id = ?", other.ID).Update("role", "owner").Error)
+	w = doRequest(router, http.MethodDelete, path, operator, "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.ErrorIs(t, db.First(&model.User{}, user.ID).Error, gorm.ErrRecordNotFound)
+	var memberships int64
+	db.Model(&model.WorkspaceMember{}).Where("user_id = ?", user.ID).Count(&memberships)
+	assert.Zero(t, memberships)
+}
+
+func TestAdminHandler_KeepsLastAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:admin_handler_last_admin_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RefreshToken{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	// 操作者是一个已被降级但会话尚未过期的前管理员
+	target := model.User{Username: "root", Email: "root@example.com", PasswordHash: "x", Role: "admin", IsActive: true}
+	require.NoError(t, db.Create(&target).Error)
+
+	logger := zap.NewNop().Sugar()
+	sessions := session.NewService(db, auth.NewManager("test-secret", "test", time.Minute), session.NewDenylist(nil), time.Hour, logger)
+	h := NewAdminHandler(db, nil, sessions, loginguard.New(nil, loginguard.Options{}, logger))
+	router := gin.New()
+	router.Use(testIdentity())
+	router.PATCH("/api/admin/users/:id", h.UpdateUser)
+	router.DELETE("/api/admin/users/:id", h.DeleteUser)
+
+	path := fmt.Sprintf("/api/admin/users/%d", target.ID)
+	w := doRequest(router, http.MethodPatch, path, "999", "admin", gin.H{"is_active": false})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(router, http.MethodDelete, path, "999", "admin", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
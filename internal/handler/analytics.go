@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"shorturl-platform/internal/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultAnalyticsRange 是未指定 from 时默认统计的时间范围
+	defaultAnalyticsRange = 7 * 24 * time.Hour
+	// maxAnalyticsBuckets 是单次查询允许返回的最大时间桶数量
+	maxAnalyticsBuckets = 2000
+	// analyticsTopN 是各维度排行返回的条目数
+	analyticsTopN = 10
+)
+
+// TimeBucket 是时间序列中的一个点
+type TimeBucket struct {
+	Time   time.Time `json:"time"`
+	Clicks int64     `json:"clicks"`
+	// UniqueVisitors 只在按天或按周统计时提供，独立访客按天记录，无法细分到小时
+	UniqueVisitors *int64 `json:"unique_visitors,omitempty"`
+}
+
+// CountItem 是维度排行中的一项
+type CountItem struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// AnalyticsResponse 是单个链接的点击分析结果
+type AnalyticsResponse struct {
+	ShortCode   string    `json:"short_code"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Interval    string    `json:"interval"`
+	TotalClicks int64     `json:"total_clicks"`
+	BotClicks   int64     `json:"bot_clicks"` // 时间范围内爬虫的点击数，无论是否包含在其他统计中
+	// UniqueVisitors 是时间范围所覆盖各天的独立访客数（近似值，不包含爬虫）
+	UniqueVisitors int64        `json:"unique_visitors"`
+	IncludeBots    bool         `json:"include_bots"`
+	Series         []TimeBucket `json:"series"`
+	TopReferers    []CountItem  `json:"top_referers"`
+	TopCountries   []CountItem  `json:"top_countries"`
+	Browsers       []CountItem  `json:"browsers"`
+	OSes           []CountItem  `json:"oses"`
+	DeviceTypes    []CountItem  `json:"device_types"`
+}
+
+// GetLinkAnalytics godoc
+// @Summary 获取链接点击分析
+// @Description 按小时/天/周返回点击时间序列，以及来源、国家、浏览器、操作系统和设备类型排行
+// @Tags ShortLink
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   code      path   string  true   "短码"
+// @Param   from      query  string  false  "开始时间 (RFC3339 或 2006-01-02)，默认 7 天前"
+// @Param   to        query  string  false  "结束时间 (RFC3339 或 2006-01-02)，默认当前时间"
+// @Param   interval  query  string  false  "时间粒度: hour, day, week，默认 day"
+// @Param   include_bots  query  bool  false  "是否包含爬虫的点击，默认不包含"
+// @Param   X-Workspace-ID  header  int  false  "工作区 ID，不传时为个人空间"
+// @Success 200 {object} AnalyticsResponse "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "链接不存在"
+// @Router /api/links/{code}/analytics [get]
+func (h *ShortLinkHandler) GetLinkAnalytics(c *gin.Context) {
+	link, ok := h.findManagedLink(c, c.Param("code"))
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := parseAnalyticsTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间: " + v})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultAnalyticsRange)
+	if v := c.Query("from"); v != "" {
+		t, err := parseAnalyticsTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间: " + v})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间必须早于结束时间"})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "day")
+	step, ok := analyticsIntervals[interval]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval 只能是 hour、day 或 week"})
+		return
+	}
+	if to.Sub(truncateBucket(from, interval))/step > maxAnalyticsBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "时间范围过大，请缩小范围或使用更大的时间粒度"})
+		return
+	}
+
+	includeBots := c.Query("include_bots") == "true" || c.Query("include_bots") == "1"
+
+	resp := AnalyticsResponse{ShortCode: link.ShortCode, From: from, To: to, Interval: interval, IncludeBots: includeBots}
+	rangeQuery := func() *gorm.DB {
+		return h.db.Model(&model.ClickRecord{}).
+			Where("short_link_id = ? AND created_at >= ? AND created_at < ?", link.ID, from, to)
+	}
+	clickQuery := func() *gorm.DB {
+		if includeBots {
+			return rangeQuery()
+		}
+		return rangeQuery().Where("is_bot = ?", false)
+	}
+
+	if err := rangeQuery().Where("is_bot = ?", true).Count(&resp.BotClicks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询点击数据失败"})
+		return
+	}
+
+	series, total, err := h.clickSeries(clickQuery(), from, to, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询点击数据失败"})
+		return
+	}
+	resp.Series = series
+	resp.TotalClicks = total
+
+	if err := h.fillVisitorSeries(link.ID, &resp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询独立访客失败"})
+		return
+	}
+
+	dimensions := []struct {
+		column string
+		empty  string
+		target *[]CountItem
+	}{
+		{"referer", "(direct)", &resp.TopReferers},
+		{"country", "(unknown)", &resp.TopCountries},
+		{"browser", "(unknown)", &resp.Browsers},
+		{"os", "(unknown)", &resp.OSes},
+		{"device_type", "(unknown)", &resp.DeviceTypes},
+	}
+	for _, d := range dimensions {
+		items, err := topValues(clickQuery(), d.column, d.empty)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询点击数据失败"})
+			return
+		}
+		*d.target = items
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// analyticsIntervals 是支持的时间粒度及其步长
+var analyticsIntervals = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// parseAnalyticsTime 解析 RFC3339 或 YYYY-MM-DD 格式的时间
+func parseAnalyticsTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	return t.UTC(), err
+}
+
+// truncateBucket 将时间截断到所在时间桶的起点（UTC），周以周一为起点
+func truncateBucket(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// clickSeries 在数据库中按小时分组计数，再在内存中汇总到目标粒度，缺失的时间桶补零
+func (h *ShortLinkHandler) clickSeries(query *gorm.DB, from, to time.Time, interval string) ([]TimeBucket, int64, error) {
+	expr, loc := h.hourBucketExpr()
+	var rows []struct {
+		Hour   string
+		Clicks int64
+	}
+	if err := query.Select(expr + " AS hour, COUNT(*) AS clicks").Group("hour").Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	counts := make(map[time.Time]int64)
+	var total int64
+	for _, row := range rows {
+		hour, err := time.ParseInLocation("2006-01-02 15:04:05", row.Hour, loc)
+		if err != nil {
+			continue
+		}
+		counts[truncateBucket(hour, interval)] += row.Clicks
+		total += row.Clicks
+	}
+
+	step := analyticsIntervals[interval]
+	series := make([]TimeBucket, 0)
+	for t := truncateBucket(from, interval); t.Before(to); t = t.Add(step) {
+		series = append(series, TimeBucket{Time: t, Clicks: counts[t]})
+	}
+	return series, total, nil
+}
+
+// fillVisitorSeries 统计整个时间范围以及每个按天/按周时间桶的独立访客数
+func (h *ShortLinkHandler) fillVisitorSeries(linkID uint, resp *AnalyticsResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 整个时间范围和每个时间桶各需要一次 PFCOUNT，在一次调用中批量查询
+	periods := [][]time.Time{daysBetween(resp.From, resp.To)}
+	step := analyticsIntervals[resp.Interval]
+	if resp.Interval != "hour" {
+		for _, bucket := range resp.Series {
+			periods = append(periods, daysBetween(bucket.Time, bucket.Time.Add(step)))
+		}
+	}
+	counts, err := h.visitors.Unions(ctx, linkID, periods)
+	if err != nil {
+		return err
+	}
+	resp.UniqueVisitors = counts[0]
+	if resp.Interval == "hour" {
+		return nil
+	}
+	for i := range resp.Series {
+		resp.Series[i].UniqueVisitors = &counts[i+1]
+	}
+	return nil
+}
+
+// daysBetween 返回 [from, to) 覆盖的每一天（UTC 零点）
+func daysBetween(from, to time.Time) []time.Time {
+	var days []time.Time
+	for d := truncateBucket(from, "day"); d.Before(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// hourBucketExpr 返回按小时截断 created_at 的 SQL 表达式，以及结果所在的时区。
+// MySQL 连接使用 loc=Local 存储本地时间，SQLite 的 strftime 会把时间转换为 UTC。
+func (h *ShortLinkHandler) hourBucketExpr() (string, *time.Location) {
+	if h.db.Dialector.Name() == "sqlite" {
+		return "strftime('%Y-%m-%d %H:00:00', created_at)", time.UTC
+	}
+	return "DATE_FORMAT(created_at, '%Y-%m-%d %H:00:00')", time.Local
+}
+
+// topValues 返回某一维度点击数最多的若干个值，空值以 empty 标记
+func topValues(query *gorm.DB, column, empty string) ([]CountItem, error) {
+	items := make([]CountItem, 0, analyticsTopN)
+	err := query.Select(column + " AS value, COUNT(*) AS count").
+		Group(column).
+		Order("count DESC").
+		Limit(analyticsTopN).
+		Scan(&items).Error
+	for i := range items {
+		if items[i].Value == "" {
+			items[i].Value = empty
+		}
+	}
+	return items, err
+}
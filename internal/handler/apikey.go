@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"shorturl-platform/internal/apikey"
+	"shorturl-platform/internal/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APIKeyHandler 包含个人 API 密钥管理的处理器
+type APIKeyHandler struct {
+	apiKeys *apikey.Service
+}
+
+// NewAPIKeyHandler 创建一个新的 APIKeyHandler
+func NewAPIKeyHandler(apiKeys *apikey.Service) *APIKeyHandler {
+	return &APIKeyHandler{apiKeys: apiKeys}
+}
+
+// CreateAPIKeyRequest 定义了创建 API 密钥请求的结构体
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100" example:"ci-pipeline"`
+	Scopes    []string   `json:"scopes" binding:"required" example:"links:write"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2026-12-31T23:59:59Z"` // 可选，为空时永不过期
+}
+
+// APIKeyResponse 定义了 API 密钥的响应，Key 只在创建时返回
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty" example:"sk_3f9a..."`
+	Prefix     string     `json:"prefix" example:"sk_3f9a1b2c"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// newAPIKeyResponse 将密钥记录转换为响应
+func newAPIKeyResponse(k *model.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		LastUsedIP: k.LastUsedIP,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary 创建 API 密钥
+// @Description 创建一个带权限范围的个人 API 密钥，明文密钥只在本次响应中返回，请妥善保存。可选权限范围：links:write、links:read、stats:read
+// @Tags APIKey
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   CreateAPIKeyRequest  true  "密钥信息"
+// @Success 201 {object} APIKeyResponse "创建成功"
+// @Failure 400 {object} gin.H "请求无效"
+// @Router /api/keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须晚于当前时间"})
+		return
+	}
+	if _, err := apikey.ValidateScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, record, err := h.apiKeys.Create(c.Request.Context(), currentUserID(c), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		zap.S().Errorf("创建 API 密钥失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 API 密钥失败"})
+		return
+	}
+
+	resp := newAPIKeyResponse(record)
+	resp.Key = key
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListAPIKeys godoc
+// @Summary 获取 API 密钥列表
+// @Description 获取当前用户的所有 API 密钥，不包含密钥明文
+// @Tags APIKey
+// @Security ApiKeyAuth
+// @Produce  json
+// @Success 200 {array} APIKeyResponse "成功响应"
+// @Router /api/keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		zap.S().Errorf("查询 API 密钥失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询 API 密钥失败"})
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		resp = append(resp, newAPIKeyResponse(&keys[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeAPIKey godoc
+// @Summary 撤销 API 密钥
+// @Description 撤销当前用户的一个 API 密钥，撤销后立即失效
+// @Tags APIKey
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   id   path  int  true  "密钥 ID"
+// @Success 200 {object} gin.H "撤销成功"
+// @Failure 404 {object} gin.H "密钥不存在"
+// @Router /api/keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的密钥 ID"})
+		return
+	}
+
+	if err := h.apiKeys.Revoke(c.Request.Context(), currentUserID(c), uint(id)); err != nil {
+		if errors.Is(err, apikey.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		zap.S().Errorf("撤销 API 密钥失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销 API 密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API 密钥已撤销"})
+}
@@ -3,9 +3,18 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"shorturl-platform/internal/account"
+	"shorturl-platform/internal/loginguard"
+	"shorturl-platform/internal/mfa"
 	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	"shorturl-platform/pkg/database"
 	auth "shorturl-platform/pkg/jwt"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,20 +25,28 @@ import (
 
 // AuthHandler 包含认证相关的处理器
 type AuthHandler struct {
-	db         *gorm.DB
-	redis      *redis.Client
-	jwtManager *auth.TokenManager
+	db              *gorm.DB
+	redis           *redis.Client
+	tokens          *auth.TokenManager
+	sessions        *session.Service
+	loginGuard      *loginguard.Guard
+	mfa             *mfa.Service
+	accounts        *account.Service
+	requireAdminMFA bool
 }
 
-// NewAuthHandler 创建一个新的 AuthHandler
-func NewAuthHandler(db *gorm.DB, redis *redis.Client, jwtManager *auth.TokenManager) *AuthHandler {
-	return &AuthHandler{db: db, redis: redis, jwtManager: jwtManager}
+// NewAuthHandler 创建一个新的 AuthHandler，requireAdminMFA 对应配置 auth.require_admin_2fa
+func NewAuthHandler(db *gorm.DB, redis *redis.Client, tokens *auth.TokenManager, sessions *session.Service, loginGuard *loginguard.Guard, mfaService *mfa.Service, accounts *account.Service, requireAdminMFA bool) *AuthHandler {
+	return &AuthHandler{
+		db: db, redis: redis, tokens: tokens, sessions: sessions, loginGuard: loginGuard,
+		mfa: mfaService, accounts: accounts, requireAdminMFA: requireAdminMFA,
+	}
 }
 
 // LoginRequest 定义了登录请求的结构体
 type LoginRequest struct {
 	Username string `json:"username" binding:"required" example:"admin"`
-	Password string `json:"password" binding:"required" example:"admin"`
+	Password string `json:"password" binding:"required" example:"password123"`
 }
 
 // RegisterRequest 定义了注册请求的结构体
@@ -39,21 +56,97 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6" example:"password123"`
 }
 
+// LoginMFARequest 定义了两步验证登录请求的结构体
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required" example:"123456"` // 验证器中的 6 位验证码或恢复码
+}
+
+// RefreshRequest 定义了刷新令牌请求的结构体
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 // AuthResponse 定义了认证成功后的响应
 type AuthResponse struct {
-	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token" example:"3q2-7wKj..."`
+	ExpiresIn    int64  `json:"expires_in" example:"900"`
+	// 配置要求管理员启用两步验证、而本次登录没有经过两步验证时为 true，此时会话不具有管理员权限
+	MFASetupRequired bool `json:"mfa_setup_required,omitempty"`
+	// 用户使用初始密码或管理员重置的临时密码登录时为 true，需要先调用 /api/me/password 修改密码
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
+// MFAChallengeResponse 启用了两步验证的用户密码验证通过后的响应，需要携带 mfa_token 调用 /auth/login/2fa
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required" example:"true"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in" example:"300"`
+}
+
+// newAuthResponse 将令牌对转换为响应
+func newAuthResponse(pair session.Pair) AuthResponse {
+	return AuthResponse{Token: pair.AccessToken, RefreshToken: pair.RefreshToken, ExpiresIn: pair.ExpiresIn}
+}
+
+// clientInfo 返回随会话保存的客户端信息
+func clientInfo(c *gin.Context) session.Client {
+	return session.Client{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+// invalidateUserCache 删除 Login 使用的用户缓存，用户信息变更后调用
+func invalidateUserCache(rdb *redis.Client, username string) {
+	if rdb != nil {
+		rdb.Del(context.Background(), "user:"+username)
+	}
+}
+
+// cachedUser 是 Login 缓存在 Redis 中的用户信息，User 序列化为 JSON 时不包含密码哈希，这里单独保存
+type cachedUser struct {
+	model.User
+	PasswordHash string `json:"password_hash"`
+}
+
+// cacheUser 缓存 Login 使用的用户信息，有效期 1 小时
+func cacheUser(rdb *redis.Client, user *model.User) {
+	if rdb == nil {
+		return
+	}
+	userBytes, _ := json.Marshal(cachedUser{User: *user, PasswordHash: user.PasswordHash})
+	rdb.Set(context.Background(), "user:"+user.Username, userBytes, 1*time.Hour)
+}
+
+// loadCachedUser 读取 Login 使用的用户缓存，缺少密码哈希的旧缓存视为未命中
+func loadCachedUser(rdb *redis.Client, username string, user *model.User) bool {
+	if rdb == nil {
+		return false
+	}
+	val, err := rdb.Get(context.Background(), "user:"+username).Result()
+	if err != nil {
+		return false
+	}
+	var cached cachedUser
+	if json.Unmarshal([]byte(val), &cached) != nil || cached.PasswordHash == "" {
+		return false
+	}
+	*user = cached.User
+	user.PasswordHash = cached.PasswordHash
+	return true
 }
 
 // Login godoc
 // @Summary 用户登录
-// @Description 使用用户名和密码获取 JWT 令牌
+// @Description 使用用户名和密码获取 JWT 令牌。启用了两步验证的用户返回 mfa_token，需要再调用 /auth/login/2fa 提交验证码
 // @Tags Auth
 // @Accept  json
 // @Produce  json
 // @Param   account  body   LoginRequest  true  "登录凭据"
 // @Success 200 {object} AuthResponse "成功响应"
+// @Success 200 {object} MFAChallengeResponse "需要两步验证 (mfa_required 为 true)"
 // @Failure 400 {object} gin.H "请求无效"
 // @Failure 401 {object} gin.H "认证失败"
+// @Failure 429 {object} gin.H "失败次数过多，账户已被临时锁定"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
@@ -62,30 +155,29 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// 锁定期间即使密码正确也拒绝登录，不存在的用户名同样计数，避免泄露账户是否存在
+	attempt := loginguard.Attempt{Username: req.Username, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 500*time.Millisecond)
+	defer cancel()
+	if locked := h.loginGuard.Check(ctx, attempt); locked > 0 {
+		respondLocked(c, locked)
+		return
+	}
+
 	var user model.User
-	userKey := "user:" + req.Username
-	if h.redis != nil {
-		val, err := h.redis.Get(context.Background(), userKey).Result()
-		if err == nil {
-			if json.Unmarshal([]byte(val), &user) == nil {
-				goto VerifyPassword
-			}
-		}
+	if loadCachedUser(h.redis, req.Username, &user) {
+		goto VerifyPassword
 	}
 
 	if err := h.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		h.loginFailed(ctx, c, attempt)
 		return
 	}
-
-	if h.redis != nil {
-		userBytes, _ := json.Marshal(user)
-		h.redis.Set(context.Background(), userKey, userBytes, 1*time.Hour)
-	}
+	cacheUser(h.redis, &user)
 
 VerifyPassword:
 	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		h.loginFailed(ctx, c, attempt)
 		return
 	}
 	if !user.IsActive {
@@ -93,20 +185,132 @@ VerifyPassword:
 		return
 	}
 
-	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role)
+	// 启用了两步验证时密码正确只算完成第一步，失败计数在第二步通过后才清除，
+	// 这样知道密码的人猜测验证码时同样会触发锁定
+	if user.TOTPEnabled {
+		token, err := h.mfa.BeginChallenge(c.Request.Context(), user.ID)
+		if err != nil {
+			zap.S().Errorf("生成两步验证凭据失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败，请重试"})
+			return
+		}
+		c.JSON(http.StatusOK, MFAChallengeResponse{
+			MFARequired: true, MFAToken: token, ExpiresIn: int64(mfa.ChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	h.loginGuard.Succeed(ctx, attempt)
+	h.startSession(c, &user, []string{auth.AMRPassword})
+}
+
+// LoginMFA godoc
+// @Summary 两步验证登录
+// @Description 提交密码登录返回的 mfa_token 和验证器中的 6 位验证码（或一个恢复码）完成登录。验证码错误同样计入登录失败次数
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   LoginMFARequest  true  "两步验证"
+// @Success 200 {object} AuthResponse "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 401 {object} gin.H "验证码错误或凭据已过期"
+// @Failure 429 {object} gin.H "失败次数过多，账户已被临时锁定"
+// @Router /auth/login/2fa [post]
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+
+	userID, err := h.mfa.ChallengeUser(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		if !errors.Is(err, mfa.ErrChallengeExpired) {
+			zap.S().Errorf("读取两步验证凭据失败: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": mfa.ErrChallengeExpired.Error()})
+		return
+	}
+	var user model.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": mfa.ErrChallengeExpired.Error()})
+		return
+	}
+
+	attempt := loginguard.Attempt{Username: user.Username, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 500*time.Millisecond)
+	defer cancel()
+	if locked := h.loginGuard.Check(ctx, attempt); locked > 0 {
+		respondLocked(c, locked)
+		return
+	}
+
+	amr, err := h.mfa.Verify(c.Request.Context(), &user, req.Code)
+	switch {
+	case errors.Is(err, mfa.ErrInvalidCode):
+		if locked := h.loginGuard.Fail(ctx, attempt); locked > 0 {
+			respondLocked(c, locked)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, mfa.ErrNotEnabled):
+		// 两次请求之间关闭了两步验证，要求重新登录
+		c.JSON(http.StatusUnauthorized, gin.H{"error": mfa.ErrChallengeExpired.Error()})
+		return
+	case err != nil:
+		zap.S().Errorf("两步验证失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败，请重试"})
+		return
+	}
+
+	h.mfa.EndChallenge(c.Request.Context(), req.MFAToken)
+	h.loginGuard.Succeed(ctx, attempt)
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		return
+	}
+	h.startSession(c, &user, append([]string{auth.AMRPassword}, amr...))
+}
+
+// startSession 登录成功后开启会话并返回令牌，amr 是本次登录使用的认证方式
+func (h *AuthHandler) startSession(c *gin.Context, user *model.User, amr []string) {
+	pair, err := h.sessions.Issue(c.Request.Context(), user, clientInfo(c), amr)
 	if err != nil {
 		zap.S().Errorf("生成令牌失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
 	}
 
-	go h.db.Model(&user).Update("last_login", time.Now())
-	c.JSON(http.StatusOK, AuthResponse{Token: token})
+	go h.db.Model(user).Update("last_login", time.Now())
+	resp := newAuthResponse(pair)
+	resp.MFASetupRequired = h.requireAdminMFA && user.Role == "admin" && !slices.Contains(amr, auth.AMRMFA)
+	resp.PasswordChangeRequired = user.MustChangePassword
+	c.JSON(http.StatusOK, resp)
+}
+
+// loginFailed 记录一次失败的登录，本次失败触发锁定时直接返回 429
+func (h *AuthHandler) loginFailed(ctx context.Context, c *gin.Context, attempt loginguard.Attempt) {
+	if locked := h.loginGuard.Fail(ctx, attempt); locked > 0 {
+		respondLocked(c, locked)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+}
+
+// respondLocked 返回锁定响应，Retry-After 为剩余锁定秒数
+func respondLocked(c *gin.Context, locked time.Duration) {
+	seconds := int64(math.Ceil(locked.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "登录失败次数过多，账户已被临时锁定，请稍后再试",
+		"retry_after": seconds,
+	})
 }
 
 // Register godoc
 // @Summary 用户注册
-// @Description 创建一个新用户并返回 JWT 令牌
+// @Description 创建一个新用户并返回 JWT 令牌，同时向注册邮箱发送验证邮件
 // @Tags Auth
 // @Accept  json
 // @Produce  json
@@ -137,25 +341,90 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	if err := h.db.Create(&user).Error; err != nil {
+		// 已删除的用户仍占用用户名和邮箱，同时注册相同的用户名时也会冲突
+		if database.IsUniqueViolation(h.db, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "用户名或邮箱已被使用"})
+			return
+		}
 		zap.S().Errorf("创建用户失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
 		return
 	}
 
-	if h.redis != nil {
-		userKey := "user:" + user.Username
-		userBytes, _ := json.Marshal(user)
-		h.redis.Set(context.Background(), userKey, userBytes, 1*time.Hour)
+	// 验证邮件发送失败不影响注册，用户可以稍后重新发送
+	if err := h.accounts.SendVerification(c.Request.Context(), &user); err != nil {
+		zap.S().Errorf("发送验证邮件失败: %v", err)
 	}
 
-	token, err := h.jwtManager.GenerateToken(user.ID, user.Username, user.Role)
+	cacheUser(h.redis, &user)
+
+	pair, err := h.sessions.Issue(c.Request.Context(), &user, clientInfo(c), []string{auth.AMRPassword})
 	if err != nil {
 		zap.S().Errorf("注册后生成令牌失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, AuthResponse{Token: token})
+	c.JSON(http.StatusCreated, newAuthResponse(pair))
+}
+
+// Refresh godoc
+// @Summary 刷新令牌
+// @Description 使用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌随即失效。已失效的刷新令牌被再次使用时，整个会话都会被撤销
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   RefreshRequest  true  "刷新令牌"
+// @Success 200 {object} AuthResponse "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 401 {object} gin.H "刷新令牌无效或已失效"
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+
+	pair, err := h.sessions.Refresh(c.Request.Context(), req.RefreshToken, clientInfo(c))
+	switch {
+	case errors.Is(err, session.ErrInvalidRefreshToken),
+		errors.Is(err, session.ErrRefreshTokenReused),
+		errors.Is(err, session.ErrUserInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		zap.S().Errorf("刷新令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAuthResponse(pair))
+}
+
+// Logout godoc
+// @Summary 退出登录
+// @Description 撤销当前会话：当前访问令牌立即失效，该会话的刷新令牌也不能再使用
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce  json
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 401 {object} gin.H "未认证"
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims, ok := c.Get("claims")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+		return
+	}
+
+	if err := h.sessions.Logout(c.Request.Context(), claims.(*auth.Claims)); err != nil {
+		zap.S().Errorf("退出登录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
 }
 
 // GetCurrentUser godoc
@@ -183,3 +452,15 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// JWKS godoc
+// @Summary 签名公钥
+// @Description 返回验证访问令牌所需的公钥 (JWKS)，其他服务可以据此验证令牌而无需持有密钥。使用 HS256 时返回空列表
+// @Tags Auth
+// @Produce  json
+// @Success 200 {object} auth.JWKS "公钥集合"
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
@@ -2,29 +2,65 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"shorturl-platform/internal/clicks"
+	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/idempotency"
 	"shorturl-platform/internal/model"
 	"shorturl-platform/internal/shortcode" // 导入 shortcode 包
+	"shorturl-platform/internal/visitors"
+	"shorturl-platform/pkg/database"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+// linkCacheTTL 是短链接缓存的最长有效期
+const linkCacheTTL = 24 * time.Hour
+
+// codeRetryAfter 是没有可用短码时建议客户端重试的间隔，与生成器检查通道水位的周期一致
+const codeRetryAfter = 5 * time.Second
+
+// idempotencyRetryAfter 是幂等键存储（Redis）不可用时建议客户端重试的间隔
+const idempotencyRetryAfter = 5 * time.Second
+
+// maxCreateAttempts 是生成的短码与已有短码冲突时最多尝试插入的次数
+const maxCreateAttempts = 5
+
 // ShortLinkHandler 处理器
 type ShortLinkHandler struct {
 	db            *gorm.DB
 	redis         *redis.Client
 	codeGenerator *shortcode.Generator // 添加 codeGenerator 字段
+	linkConfig    *config.Link
+	clickRecorder *clicks.Recorder
+	visitors      visitors.Counter
+	idempotency   *idempotency.Service
+}
+
+// cachedLink 是写入 Redis 的链接缓存条目
+type cachedLink struct {
+	ID  uint   `json:"id"`
+	URL string `json:"url"`
 }
 
 // NewShortLinkHandler 创建处理器实例
-func NewShortLinkHandler(db *gorm.DB, redisClient *redis.Client, codeGenerator *shortcode.Generator) *ShortLinkHandler {
+func NewShortLinkHandler(db *gorm.DB, redisClient *redis.Client, codeGenerator *shortcode.Generator, linkConfig *config.Link, clickRecorder *clicks.Recorder, visitorCounter visitors.Counter) *ShortLinkHandler {
 	return &ShortLinkHandler{
 		db:            db,
 		redis:         redisClient,
 		codeGenerator: codeGenerator, // 初始化 codeGenerator
+		linkConfig:    linkConfig,
+		clickRecorder: clickRecorder,
+		visitors:      visitorCounter,
+		idempotency:   idempotency.New(redisClient),
 	}
 }
 
@@ -33,14 +69,24 @@ func (h *ShortLinkHandler) IndexPage(c *gin.Context) {
 	c.HTML(http.StatusOK, "index.html", nil)
 }
 
-// HealthCheck ... (保持不变)
+// HealthCheck 返回服务健康状态、点击写入队列的积压、丢弃与写入失败情况，以及短码过滤器的填充率和误判统计
 func (h *ShortLinkHandler) HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "timestamp": time.Now()})
+	c.JSON(http.StatusOK, gin.H{
+		"status":               "healthy",
+		"timestamp":            time.Now(),
+		"click_events_pending": h.clickRecorder.Pending(),
+		"click_events_dropped": h.clickRecorder.Dropped(),
+		"click_events_failed":  h.clickRecorder.Failed(),
+		"shortcode_registry":   h.codeGenerator.Stats(c.Request.Context()),
+	})
 }
 
-// CreateShortLinkRequest ... (保持不变)
+// CreateShortLinkRequest 创建短链接的请求体
 type CreateShortLinkRequest struct {
-	URL string `json:"url" binding:"required,url" example:"https://github.com/gin-gonic/gin"`
+	URL       string     `json:"url" binding:"required,url" example:"https://github.com/gin-gonic/gin"`
+	Alias     string     `json:"alias,omitempty" example:"spring-sale"`               // 可选的自定义短码
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2026-12-31T23:59:59Z"` // 可选的过期时间
+	MaxClicks int64      `json:"max_clicks,omitempty" binding:"min=0" example:"100"`  // 可选的点击预算，0 表示不限
 }
 
 // CreateShortLinkResponse ... (保持不变)
@@ -56,9 +102,15 @@ type CreateShortLinkResponse struct {
 // @Accept  json
 // @Produce  json
 // @Param   url  body   CreateShortLinkRequest  true  "长链接 URL"
+// @Param   X-Workspace-ID  header  int  false  "工作区 ID，不传时为个人空间"
+// @Param   Idempotency-Key  header  string  false  "幂等键，24 小时内使用同一个键重试时返回第一次创建的短链接"
 // @Success 201 {object} CreateShortLinkResponse "成功响应"
 // @Failure 400 {object} gin.H "请求无效"
+// @Failure 403 {object} gin.H "工作区角色无权创建链接"
+// @Failure 409 {object} gin.H "别名已被占用，或使用相同幂等键的请求正在处理中"
+// @Failure 422 {object} gin.H "幂等键已用于参数不同的请求"
 // @Failure 500 {object} gin.H "服务器内部错误"
+// @Failure 503 {object} gin.H "暂时无法分配短码、短码冲突次数过多或幂等键存储不可用，响应头 Retry-After 为建议的重试秒数"
 // @Router /api/shorten [post]
 func (h *ShortLinkHandler) CreateShortLink(c *gin.Context) {
 	var req CreateShortLinkRequest
@@ -66,112 +118,443 @@ func (h *ShortLinkHandler) CreateShortLink(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
 		return
 	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须晚于当前时间"})
+		return
+	}
 
-	// 从预生成通道获取短码，这是一个高性能操作
-	shortCode := h.codeGenerator.GetCode()
+	if req.Alias != "" {
+		if err := shortcode.ValidateAlias(req.Alias); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	shortLink := model.ShortLink{ShortCode: shortCode, OriginalURL: req.URL, IsActive: true}
-	if err := h.db.Create(&shortLink).Error; err != nil {
-		// 注意：在高并发下，如果通道耗尽且生成速度跟不上，这里可能会因为短码重复而失败。
-		// 一个更健壮的系统会在这里实现重试逻辑，或者返回一个 "稍后重试" 的错误。
-		// 为简化起见，我们暂时只记录错误。
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建短链接失败，可能是数据库错误或短码冲突"})
+	key := c.GetHeader(idempotency.Header)
+	if len(key) > idempotency.MaxKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "幂等键过长"})
+		return
+	}
+	if key == "" {
+		status, body := h.createLink(c, &req)
+		c.JSON(status, body)
 		return
 	}
 
-	if h.redis != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		// 设置缓存，可以考虑将过期时间配置化
-		h.redis.Set(ctx, "shortlink:"+shortCode, req.URL, 24*time.Hour)
+	key = shortenIdempotencyKey(currentUserID(c), key)
+	fingerprint := shortenFingerprint(&req, currentWorkspaceID(c))
+	saved, err := h.idempotency.Begin(c.Request.Context(), key, fingerprint)
+	switch {
+	case errors.Is(err, idempotency.ErrInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, idempotency.ErrMismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		// 无法确认请求是否已经处理过，不能冒着重复创建的风险继续执行，让客户端稍后用同一个键重试
+		zap.S().Warnf("读取幂等键失败: %v", err)
+		c.Header("Retry-After", strconv.Itoa(int(idempotencyRetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "暂时无法处理幂等键，请稍后重试"})
+		return
+	case saved != nil:
+		c.Header(idempotency.ReplayedHeader, "true")
+		c.Data(saved.Status, "application/json; charset=utf-8", saved.Body)
+		return
+	}
+
+	status, body := h.createLink(c, &req)
+	// 客户端超时断开后请求上下文已取消，但链接可能已经创建，结果仍然需要保存
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), time.Second)
+	defer cancel()
+	if status == http.StatusCreated {
+		data, _ := json.Marshal(body)
+		_ = h.idempotency.Complete(ctx, key, fingerprint, idempotency.Response{Status: status, Body: data})
+	} else {
+		// 失败的请求不保存结果，释放幂等键以便客户端重试
+		_ = h.idempotency.Release(ctx, key)
+	}
+	c.JSON(status, body)
+}
+
+// shortenIdempotencyKey 返回创建短链接使用的幂等键，幂等键按用户隔离
+func shortenIdempotencyKey(userID uint, key string) string {
+	return fmt.Sprintf("shorten:%d:%s", userID, key)
+}
+
+// shortenFingerprint 计算创建请求的指纹，同一个键用于不同的参数或工作区时视为冲突
+func shortenFingerprint(req *CreateShortLinkRequest, workspaceID uint) string {
+	return idempotency.Fingerprint(struct {
+		Request     CreateShortLinkRequest
+		WorkspaceID uint
+	}{*req, workspaceID})
+}
+
+// createLink 插入短链接，返回响应状态码和响应体。生成的短码被唯一索引拒绝时（其他实例或并发请求已插入、
+// 本实例的过滤器还不知道）换一个新短码重试，最多尝试 maxCreateAttempts 次
+func (h *ShortLinkHandler) createLink(c *gin.Context, req *CreateShortLinkRequest) (int, any) {
+	ctx := c.Request.Context()
+	if req.Alias != "" {
+		exists, err := h.codeGenerator.Exists(ctx, req.Alias)
+		if err != nil {
+			return http.StatusInternalServerError, gin.H{"error": "检查别名失败"}
+		}
+		if exists {
+			return http.StatusConflict, gin.H{"error": "别名已被占用"}
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		shortCode := req.Alias
+		if shortCode == "" {
+			// 优先从预生成通道获取短码，通道为空时同步生成
+			code, err := h.codeGenerator.GetCode(ctx)
+			if err != nil {
+				return codeUnavailable(c, err)
+			}
+			shortCode = code
+		}
+
+		shortLink := model.ShortLink{
+			UserID:      currentUserID(c),
+			WorkspaceID: currentWorkspaceID(c),
+			ShortCode:   shortCode,
+			OriginalURL: req.URL,
+			IsActive:    true,
+			ExpiresAt:   req.ExpiresAt,
+			MaxClicks:   req.MaxClicks,
+		}
+		err := h.db.Create(&shortLink).Error
+		if err == nil {
+			h.codeGenerator.Record(ctx, shortCode)
+			if req.Alias != "" {
+				h.codeGenerator.Claim(shortCode)
+			}
+			h.cacheLink(&shortLink)
+			return http.StatusCreated, CreateShortLinkResponse{ShortURL: "http://" + c.Request.Host + "/" + shortCode}
+		}
+		if !database.IsUniqueViolation(h.db, err) {
+			return http.StatusInternalServerError, gin.H{"error": "创建短链接失败"}
+		}
+
+		h.codeGenerator.Record(ctx, shortCode)
+		if req.Alias != "" {
+			return http.StatusConflict, gin.H{"error": "别名已被占用"}
+		}
+		if attempt == maxCreateAttempts {
+			c.Header("Retry-After", strconv.Itoa(int(codeRetryAfter.Seconds())))
+			return http.StatusServiceUnavailable, gin.H{"error": "短码冲突次数过多，请稍后重试"}
+		}
 	}
+}
 
-	c.JSON(http.StatusCreated, CreateShortLinkResponse{ShortURL: "http://" + c.Request.Host + "/" + shortCode})
+// codeUnavailable 把获取短码失败转换为响应：生成器停止、短码耗尽或请求超时时返回 503 和 Retry-After
+func codeUnavailable(c *gin.Context, err error) (int, any) {
+	if errors.Is(err, shortcode.ErrGeneratorStopped) || errors.Is(err, shortcode.ErrExhausted) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		c.Header("Retry-After", strconv.Itoa(int(codeRetryAfter.Seconds())))
+		return http.StatusServiceUnavailable, gin.H{"error": "暂时无法分配短码，请稍后重试"}
+	}
+	return http.StatusInternalServerError, gin.H{"error": "生成短码失败"}
 }
 
-// RedirectToOriginal ... (保持不变)
+// RedirectToOriginal 重定向到原始链接，并校验过期时间与点击预算
 func (h *ShortLinkHandler) RedirectToOriginal(c *gin.Context) {
 	code := c.Param("code")
 	if h.redis != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
-		if cachedURL, err := h.redis.Get(ctx, "shortlink:"+code).Result(); err == nil {
-			go h.incrementClickCount(code)
-			c.Redirect(http.StatusFound, cachedURL)
-			return
+		// 只有未设置点击预算的链接才会被缓存，且缓存 TTL 不超过链接的过期时间
+		if val, err := h.redis.Get(ctx, "shortlink:"+code).Result(); err == nil {
+			var cached cachedLink
+			if json.Unmarshal([]byte(val), &cached) == nil {
+				h.recordClick(c, cached.ID)
+				c.Redirect(http.StatusFound, cached.URL)
+				return
+			}
 		}
 	}
 
 	var link model.ShortLink
-	if err := h.db.Where("short_code = ? AND is_active = ?", code, true).First(&link).Error; err != nil {
+	if err := h.db.Where("short_code = ?", code).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "链接不存在或已禁用"})
+		return
+	}
+	if link.IsExpired(time.Now()) || link.ClicksExhausted() {
+		h.respondGone(c)
+		return
+	}
+	if !link.IsActive {
 		c.JSON(http.StatusNotFound, gin.H{"error": "链接不存在或已禁用"})
 		return
 	}
 
-	go h.incrementClickCount(code)
-	if h.redis != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-		defer cancel()
-		h.redis.Set(ctx, "shortlink:"+code, link.OriginalURL, 24*time.Hour)
+	if link.MaxClicks > 0 {
+		// 有点击预算的链接需要同步地、带条件地扣减，避免并发请求超出预算。
+		// User-Agent 由客户端决定，爬虫同样消耗预算；预算单独计数，click_count 仍由写入器累加且不含爬虫
+		result := h.db.Model(&model.ShortLink{}).
+			Where("id = ? AND budget_used < max_clicks", link.ID).
+			Update("budget_used", gorm.Expr("budget_used + 1"))
+		if result.Error != nil || result.RowsAffected == 0 {
+			h.respondGone(c)
+			return
+		}
+	} else {
+		h.cacheLink(&link)
 	}
+	h.recordClick(c, link.ID)
 	c.Redirect(http.StatusFound, link.OriginalURL)
 }
 
-// GetAllLinks ... (保持不变)
+// respondGone 处理已过期的链接：配置了兜底地址时跳转，否则返回 410
+func (h *ShortLinkHandler) respondGone(c *gin.Context) {
+	if h.linkConfig != nil && h.linkConfig.FallbackURL != "" {
+		c.Redirect(http.StatusFound, h.linkConfig.FallbackURL)
+		return
+	}
+	c.JSON(http.StatusGone, gin.H{"error": "链接已过期"})
+}
+
+// cacheLink 将链接写入缓存，TTL 跟随链接的过期时间；有点击预算的链接不缓存
+func (h *ShortLinkHandler) cacheLink(link *model.ShortLink) {
+	if h.redis == nil || link.MaxClicks > 0 {
+		return
+	}
+	ttl := linkCacheTTL
+	if link.ExpiresAt != nil {
+		if untilExpiry := time.Until(*link.ExpiresAt); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+	val, err := json.Marshal(cachedLink{ID: link.ID, URL: link.OriginalURL})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	h.redis.Set(ctx, "shortlink:"+link.ShortCode, val, ttl)
+}
+
+// recordClick 将点击事件提交给异步写入器，不会阻塞重定向
+func (h *ShortLinkHandler) recordClick(c *gin.Context, linkID uint) {
+	h.clickRecorder.Record(clicks.Event{
+		ShortLinkID: linkID,
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		Referer:     c.Request.Referer(),
+		CreatedAt:   time.Now(),
+	})
+}
+
+// invalidateLink 删除链接的缓存
+func (h *ShortLinkHandler) invalidateLink(code string) {
+	if h.redis == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	h.redis.Del(ctx, "shortlink:"+code)
+}
+
+// currentUserID 返回 AuthMiddleware 写入上下文的用户 ID，未认证时返回 0
+func currentUserID(c *gin.Context) uint {
+	userID, _ := c.Get("user_id")
+	id, _ := userID.(uint)
+	return id
+}
+
+// isAdmin 判断当前用户是否为管理员
+func isAdmin(c *gin.Context) bool {
+	return c.GetString("role") == "admin"
+}
+
+// currentWorkspaceID 返回 WorkspaceScope 写入上下文的工作区 ID，0 表示个人空间
+func currentWorkspaceID(c *gin.Context) uint {
+	workspaceID, _ := c.Get("workspace_id")
+	id, _ := workspaceID.(uint)
+	return id
+}
+
+// scopedLinks 返回当前范围内可见的链接查询：工作区中为该工作区的全部链接；
+// 个人空间中管理员可见全部，普通用户只能看到自己个人空间的链接
+func (h *ShortLinkHandler) scopedLinks(c *gin.Context) *gorm.DB {
+	query := h.db.Model(&model.ShortLink{})
+	if workspaceID := currentWorkspaceID(c); workspaceID != 0 {
+		return query.Where("workspace_id = ?", workspaceID)
+	}
+	if !isAdmin(c) {
+		query = query.Where("workspace_id = ? AND user_id = ?", 0, currentUserID(c))
+	}
+	return query
+}
+
+// findManagedLink 查找当前范围内有权管理的链接，失败时直接写入错误响应。
+// 工作区中的角色已由 RequireWorkspaceRole 校验，只需确认链接属于该工作区；
+// 个人空间中只有链接的所有者和管理员可以操作
+func (h *ShortLinkHandler) findManagedLink(c *gin.Context, code string) (*model.ShortLink, bool) {
+	var link model.ShortLink
+	if err := h.db.Where("short_code = ?", code).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "链接不存在"})
+		return nil, false
+	}
+	if workspaceID := currentWorkspaceID(c); workspaceID != 0 {
+		if link.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "链接不存在"})
+			return nil, false
+		}
+		return &link, true
+	}
+	if !isAdmin(c) && (link.WorkspaceID != 0 || link.UserID != currentUserID(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该链接"})
+		return nil, false
+	}
+	return &link, true
+}
+
+// GetAllLinks 获取当前范围内的链接列表
 func (h *ShortLinkHandler) GetAllLinks(c *gin.Context) {
 	var links []model.ShortLink
-	if err := h.db.Order("created_at DESC").Find(&links).Error; err != nil {
+	if err := h.scopedLinks(c).Order("created_at DESC").Find(&links).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取链接失败"})
 		return
 	}
+	h.fillUniqueVisitors(links)
 	c.JSON(http.StatusOK, links)
 }
 
-// incrementClickCount ... (保持不变)
-func (h *ShortLinkHandler) incrementClickCount(code string) {
-	h.db.Model(&model.ShortLink{}).Where("short_code = ?", code).Update("click_count", gorm.Expr("click_count + 1"))
+// fillUniqueVisitors 填充链接的独立访客数，统计失败时保持为 0
+func (h *ShortLinkHandler) fillUniqueVisitors(links []model.ShortLink) {
+	if len(links) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.ID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	totals, err := h.visitors.Totals(ctx, ids)
+	if err != nil {
+		return
+	}
+	for i := range links {
+		links[i].UniqueVisitors = totals[links[i].ID]
+	}
 }
 
-// GetStats ... (保持不变)
+// GetStats 获取当前范围内的链接统计
 func (h *ShortLinkHandler) GetStats(c *gin.Context) {
 	var stats struct {
 		TotalLinks  int64 `json:"total_links"`
 		TotalClicks int64 `json:"total_clicks"`
 		ActiveLinks int64 `json:"active_links"`
 	}
-	h.db.Model(&model.ShortLink{}).Count(&stats.TotalLinks)
-	h.db.Model(&model.ShortLink{}).Select("COALESCE(SUM(click_count), 0)").Scan(&stats.TotalClicks)
-	h.db.Model(&model.ShortLink{}).Where("is_active = ?", true).Count(&stats.ActiveLinks)
+	h.scopedLinks(c).Count(&stats.TotalLinks)
+	h.scopedLinks(c).Select("COALESCE(SUM(click_count), 0)").Scan(&stats.TotalClicks)
+	h.scopedLinks(c).Where("is_active = ?", true).Count(&stats.ActiveLinks)
 	c.JSON(http.StatusOK, stats)
 }
 
-// ToggleLink ... (保持不变)
+// ToggleLink 切换链接的启用状态
 func (h *ShortLinkHandler) ToggleLink(c *gin.Context) {
 	code := c.Param("code")
-	var link model.ShortLink
-	if err := h.db.Where("short_code = ?", code).First(&link).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "链接不存在"})
+	link, ok := h.findManagedLink(c, code)
+	if !ok {
 		return
 	}
 	newStatus := !link.IsActive
-	h.db.Model(&link).Update("is_active", newStatus)
-	if h.redis != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		h.redis.Del(ctx, "shortlink:"+code)
-	}
+	h.db.Model(link).Update("is_active", newStatus)
+	h.invalidateLink(code)
 	c.JSON(http.StatusOK, gin.H{"message": "状态更新成功", "is_active": newStatus})
 }
 
-// DeleteLink ... (保持不变)
+// UpdateLinkRequest 更新短链接生命周期的请求体，未提供的字段保持不变
+type UpdateLinkRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" example:"2026-12-31T23:59:59Z"`
+	RemoveExpiry bool       `json:"remove_expiry,omitempty"` // 为 true 时清除过期时间
+	MaxClicks    *int64     `json:"max_clicks,omitempty" binding:"omitempty,min=0" example:"100"`
+}
+
+// UpdateLink godoc
+// @Summary 更新短链接
+// @Description 更新短链接的过期时间和点击预算，因过期或预算用完而停用的链接在更新后未过期且预算未用完时重新启用
+// @Tags ShortLink
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   code  path   string             true  "短码"
+// @Param   body  body   UpdateLinkRequest  true  "更新内容"
+// @Param   X-Workspace-ID  header  int  false  "工作区 ID，不传时为个人空间"
+// @Success 200 {object} model.ShortLink "成功响应"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "链接不存在"
+// @Router /api/links/{code} [patch]
+func (h *ShortLinkHandler) UpdateLink(c *gin.Context) {
+	var req UpdateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须晚于当前时间"})
+		return
+	}
+
+	code := c.Param("code")
+	link, ok := h.findManagedLink(c, code)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.RemoveExpiry {
+		updates["expires_at"] = nil
+	} else if req.ExpiresAt != nil {
+		updates["expires_at"] = *req.ExpiresAt
+	}
+	if req.MaxClicks != nil {
+		updates["max_clicks"] = *req.MaxClicks
+	}
+	if len(updates) > 0 {
+		// 已过期或预算用完的链接会被清理任务停用，延长过期时间或预算后链接不再过期时重新启用。
+		// 更新前未过期的停用链接是所有者手动停用的，保持停用
+		now := time.Now()
+		lapsed := link.IsExpired(now) || link.ClicksExhausted()
+		next := *link
+		if req.RemoveExpiry {
+			next.ExpiresAt = nil
+		} else if req.ExpiresAt != nil {
+			next.ExpiresAt = req.ExpiresAt
+		}
+		if req.MaxClicks != nil {
+			next.MaxClicks = *req.MaxClicks
+		}
+		if lapsed && !next.IsExpired(now) && !next.ClicksExhausted() {
+			updates["is_active"] = true
+		}
+		if err := h.db.Model(link).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+	h.invalidateLink(code)
+	h.db.First(link, link.ID)
+	c.JSON(http.StatusOK, link)
+}
+
+// DeleteLink 删除链接
 func (h *ShortLinkHandler) DeleteLink(c *gin.Context) {
 	code := c.Param("code")
-	if h.redis != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		h.redis.Del(ctx, "shortlink:"+code)
+	link, ok := h.findManagedLink(c, code)
+	if !ok {
+		return
 	}
-	if err := h.db.Where("short_code = ?", code).Delete(&model.ShortLink{}).Error; err != nil {
+	h.invalidateLink(code)
+	if err := h.db.Delete(link).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
@@ -2,12 +2,24 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"shorturl-platform/internal/clicks"
+	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/idempotency"
 	"shorturl-platform/internal/model"
 	"shorturl-platform/internal/shortcode"
+	"shorturl-platform/internal/sweeper"
+	"shorturl-platform/internal/visitors"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -23,13 +35,18 @@ func setupTest() (*gin.Engine, func(), *ShortLinkHandler) {
 	gin.SetMode(gin.TestMode)
 
 	// 2. 初始化内存数据库
-	db, err := gorm.Open(sqlite.open("file::memory:?cache=shared"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
 	if err != nil {
 		panic("无法连接到内存数据库: " + err.Error())
 	}
+	// 共享缓存的内存库在多个连接并发读写时会返回 "database table is locked"，
+	// 生成器和点击写入器都在后台访问数据库，这里限制为单个连接以串行化访问
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
 
 	// 3. 自动迁移
-	err = db.AutoMigrate(&model.ShortLink{}, &model.User{})
+	err = db.AutoMigrate(&model.ShortLink{}, &model.User{}, &model.ClickRecord{})
 	if err != nil {
 		panic("数据库迁移失败: " + err.Error())
 	}
@@ -40,27 +57,84 @@ func setupTest() (*gin.Engine, func(), *ShortLinkHandler) {
 	logger, _ := zap.NewDevelopment()
 	sugaredLogger := logger.Sugar()
 
-	// 使用一个简单的、非后台运行的短码生成器进行测试
-	// 这样可以避免在测试期间 goroutine 泄漏
-	mockGenerator := shortcode.NewGenerator(db, sugaredLogger)
+	// 查重经过进程内布隆过滤器，与默认配置一致
+	registry := shortcode.NewRegistry(db, shortcode.NewMemoryFilter(0, 0), sugaredLogger)
+	if err := registry.Load(context.Background()); err != nil {
+		panic("加载短码过滤器失败: " + err.Error())
+	}
+
+	// 启动短码生成器，GetCode 依赖后台填充的通道
+	// 清理函数中会停止它，避免在测试期间 goroutine 泄漏
+	mockGenerator := shortcode.NewGenerator(shortcode.NewRandomSource(registry, shortcode.DefaultCodeLength, shortcode.DefaultCharset), registry, sugaredLogger)
+	mockGenerator.Start()
+
+	visitorCounter := visitors.NewMemoryCounter()
+	clickRecorder := clicks.NewRecorder(db, clicks.Options{
+		FlushInterval: 10 * time.Millisecond,
+		Visitors:      visitorCounter,
+	}, sugaredLogger)
+	clickRecorder.Start()
 
-	linkHandler := NewShortLinkHandler(db, nil, mockGenerator)
+	linkHandler := NewShortLinkHandler(db, nil, mockGenerator, &config.Link{}, clickRecorder, visitorCounter)
 
 	// 5. 设置路由
+	// 测试中不经过 JWT 认证，通过请求头模拟 AuthMiddleware 写入的用户信息
 	router := gin.Default()
+	router.Use(testIdentity())
 	router.POST("/api/shorten", linkHandler.CreateShortLink)
 	router.GET("/:code", linkHandler.RedirectToOriginal)
+	router.GET("/api/links", linkHandler.GetAllLinks)
+	router.GET("/api/stats", linkHandler.GetStats)
+	router.PUT("/api/links/:code", linkHandler.ToggleLink)
+	router.PATCH("/api/links/:code", linkHandler.UpdateLink)
+	router.DELETE("/api/links/:code", linkHandler.DeleteLink)
+	router.GET("/api/links/:code/analytics", linkHandler.GetLinkAnalytics)
 
 	// 6. 定义清理函数
 	cleanup := func() {
+		mockGenerator.Stop() // 确保生成器被停止
+		clickRecorder.Stop()
 		sqlDB, _ := db.DB()
 		sqlDB.Close()
-		mockGenerator.Stop() // 确保生成器被停止
 	}
 
 	return router, cleanup, linkHandler
 }
 
+// testIdentity 从 X-Test-User / X-Test-Role 请求头读取用户信息并写入上下文
+func testIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID, err := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64); err == nil {
+			c.Set("user_id", uint(userID))
+			c.Set("role", "user")
+		}
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			c.Set("role", role)
+		}
+		c.Next()
+	}
+}
+
+// doRequest 以指定用户身份发起请求
+func doRequest(router *gin.Engine, method, path, userID, role string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Buffer
+	if body != nil {
+		bodyBytes, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(bodyBytes)
+	} else {
+		reader = bytes.NewBuffer(nil)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", userID)
+	if role != "" {
+		req.Header.Set("X-Test-Role", role)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
 // TestShortLinkHandler_Integration 测试创建和重定向的完整流程
 func TestShortLinkHandler_Integration(t *testing.T) {
 	router, cleanup, _ := setupTest()
@@ -110,5 +184,422 @@ func TestShortLinkHandler_Integration(t *testing.T) {
 
 	// 验证重定向的目标地址
 	redirectURL := w.Header().Get("Location")
-	assert.Equal(t_testing.T, originalURL, redirectURL, "重定向的 URL 应与原始 URL 匹配")
+	assert.Equal(t, originalURL, redirectURL, "重定向的 URL 应与原始 URL 匹配")
 }
+
+// postJSON 发起一个 JSON POST 请求并返回响应记录
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	bodyBytes, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestCreateShortLink_Alias 测试自定义别名的创建、冲突和校验
+func TestCreateShortLink_Alias(t *testing.T) {
+	router, cleanup, _ := setupTest()
+	defer cleanup()
+
+	originalURL := "https://example.com/spring"
+
+	// 使用合法别名创建
+	w := postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: originalURL, Alias: "spring-sale"})
+	assert.Equal(t, http.StatusCreated, w.Code, "合法别名应创建成功")
+
+	var createResp CreateShortLinkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &createResp))
+	assert.True(t, strings.HasSuffix(createResp.ShortURL, "/spring-sale"), "短链接应使用别名")
+
+	// 别名可以正常重定向
+	req, _ := http.NewRequest(http.MethodGet, "/spring-sale", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, originalURL, w.Header().Get("Location"))
+
+	// 重复的别名返回 409
+	w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: originalURL, Alias: "spring-sale"})
+	assert.Equal(t, http.StatusConflict, w.Code, "重复别名应返回 409")
+
+	// 非法别名返回 400
+	for _, alias := range []string{"API", "health", "ab", "has space", "bad/slash"} {
+		w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: originalURL, Alias: alias})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "别名 %q 应被拒绝", alias)
+	}
+}
+
+// TestCreateShortLink_GeneratorStopped 测试生成器停止后返回 503 而不是阻塞
+func TestCreateShortLink_GeneratorStopped(t *testing.T) {
+	router, cleanup, h := setupTest()
+	defer cleanup()
+
+	h.codeGenerator.Stop()
+	w := postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com"})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	// 使用别名时不需要生成器
+	w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com", Alias: "still-works"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+// TestRedirect_Expiration 测试按时间和点击预算过期
+func TestRedirect_Expiration(t *testing.T) {
+	router, cleanup, linkHandler := setupTest()
+	defer cleanup()
+
+	get := func(code string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 点击预算为 1 的链接只能访问一次
+	w := postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/once", Alias: "only-once", MaxClicks: 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusFound, get("only-once").Code)
+	assert.Equal(t, http.StatusGone, get("only-once").Code, "点击预算用完后应返回 410")
+
+	// 爬虫同样消耗点击预算，伪造 User-Agent 不能绕过
+	w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/bot", Alias: "bot-budget", MaxClicks: 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	getAs := func(code, userAgent string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusFound, getAs("bot-budget", "curl/8.5.0"))
+	assert.Equal(t, http.StatusGone, getAs("bot-budget", "curl/8.5.0"), "爬虫用完预算后也应返回 410")
+	assert.Equal(t, http.StatusGone, getAs("bot-budget", "Googlebot/2.1"))
+	linkHandler.clickRecorder.Stop()
+	var botLink model.ShortLink
+	assert.NoError(t, linkHandler.db.Where("short_code = ?", "bot-budget").First(&botLink).Error)
+	assert.Equal(t, int64(1), botLink.BudgetUsed)
+	assert.Zero(t, botLink.ClickCount, "爬虫的跳转不计入 click_count")
+
+	// 过期时间必须在未来
+	past := time.Now().Add(-time.Hour)
+	w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/past", ExpiresAt: &past})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 已过期的链接返回 410
+	expired := model.ShortLink{ShortCode: "expired-link", OriginalURL: "https://example.com/old", IsActive: true, ExpiresAt: &past}
+	linkHandler.db.Create(&expired)
+	assert.Equal(t, http.StatusGone, get("expired-link").Code)
+
+	// 配置了兜底地址时跳转到兜底地址
+	linkHandler.linkConfig.FallbackURL = "https://example.com/expired"
+	w = get("expired-link")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/expired", w.Header().Get("Location"))
+
+	// 清理任务停用过期和预算用完的链接，清除过期时间后链接恢复可用
+	assert.Equal(t, 3, sweeper.NewSweeper(linkHandler.db, nil, 0, zap.NewNop().Sugar()).Sweep())
+	w = doRequest(router, http.MethodPatch, "/api/links/expired-link", "", "", UpdateLinkRequest{RemoveExpiry: true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = get("expired-link")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/old", w.Header().Get("Location"))
+
+	// 预算用完的链接延长过期时间不会重新启用，提高预算后恢复可用
+	future := time.Now().Add(time.Hour)
+	w = doRequest(router, http.MethodPatch, "/api/links/only-once", "", "", UpdateLinkRequest{ExpiresAt: &future})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://example.com/expired", get("only-once").Header().Get("Location"))
+	maxClicks := int64(2)
+	w = doRequest(router, http.MethodPatch, "/api/links/only-once", "", "", UpdateLinkRequest{MaxClicks: &maxClicks})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://example.com/once", get("only-once").Header().Get("Location"))
+
+	// 手动停用的链接更新过期时间或预算后保持停用
+	w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/paused", Alias: "paused-link"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = doRequest(router, http.MethodPut, "/api/links/paused-link", "", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	maxClicks = 10
+	w = doRequest(router, http.MethodPatch, "/api/links/paused-link", "", "", UpdateLinkRequest{MaxClicks: &maxClicks, ExpiresAt: &future})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var paused model.ShortLink
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &paused))
+	assert.False(t, paused.IsActive, "手动停用的链接不应被重新启用")
+	assert.Equal(t, http.StatusNotFound, get("paused-link").Code)
+}
+
+// TestLinks_Ownership 测试链接按所有者隔离，管理员拥有全局视图
+func TestLinks_Ownership(t *testing.T) {
+	router, cleanup, _ := setupTest()
+	defer cleanup()
+
+	w := doRequest(router, http.MethodPost, "/api/shorten", "1", "", CreateShortLinkRequest{URL: "https://example.com/alice", Alias: "alice-link"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	listCodes := func(userID, role string) []string {
+		w := doRequest(router, http.MethodGet, "/api/links", userID, role, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var links []model.ShortLink
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+		codes := make([]string, 0, len(links))
+		for _, link := range links {
+			codes = append(codes, link.ShortCode)
+		}
+		return codes
+	}
+
+	// 所有者和管理员能看到链接，其他用户看不到
+	assert.Contains(t, listCodes("1", ""), "alice-link")
+	assert.NotContains(t, listCodes("2", ""), "alice-link")
+	assert.Contains(t, listCodes("3", "admin"), "alice-link")
+
+	// 其他用户的统计不包含该链接
+	w = doRequest(router, http.MethodGet, "/api/stats", "2", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total_links":0`)
+
+	// 其他用户不能修改或删除
+	w = doRequest(router, http.MethodDelete, "/api/links/alice-link", "2", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 所有者可以删除
+	w = doRequest(router, http.MethodDelete, "/api/links/alice-link", "1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestRedirect_RecordsClick 测试重定向会异步写入点击记录并累加点击数
+func TestRedirect_RecordsClick(t *testing.T) {
+	router, cleanup, linkHandler := setupTest()
+	defer cleanup()
+
+	w := postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/tracked", Alias: "tracked"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req, _ := http.NewRequest(http.MethodGet, "/tracked", nil)
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	req.Header.Set("Referer", "https://news.example.com/")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// 爬虫的点击会被记录，但不计入 click_count
+	req, _ = http.NewRequest(http.MethodGet, "/tracked", nil)
+	req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// 停止写入器会刷新队列中剩余的事件
+	linkHandler.clickRecorder.Stop()
+
+	var link model.ShortLink
+	linkHandler.db.Where("short_code = ?", "tracked").First(&link)
+	assert.Equal(t, int64(1), link.ClickCount)
+
+	// 爬虫的访问不计入独立访客
+	w = doRequest(router, http.MethodGet, "/api/links", "0", "", nil)
+	var links []model.ShortLink
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, int64(1), links[0].UniqueVisitors)
+	}
+
+	var records []model.ClickRecord
+	linkHandler.db.Where("short_link_id = ?", link.ID).Order("id").Find(&records)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "test-agent/1.0", records[0].UserAgent)
+		assert.Equal(t, "https://news.example.com/", records[0].Referer)
+		assert.False(t, records[0].IsBot)
+		assert.True(t, records[1].IsBot)
+		assert.Equal(t, "Slackbot", records[1].Browser)
+	}
+}
+
+// TestGetLinkAnalytics 测试点击时间序列和维度排行
+func TestGetLinkAnalytics(t *testing.T) {
+	router, cleanup, linkHandler := setupTest()
+	defer cleanup()
+
+	w := doRequest(router, http.MethodPost, "/api/shorten", "1", "", CreateShortLinkRequest{URL: "https://example.com/report", Alias: "report"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var link model.ShortLink
+	linkHandler.db.Where("short_code = ?", "report").First(&link)
+
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	records := []model.ClickRecord{
+		{ShortLinkID: link.ID, Referer: "https://news.example.com/", CreatedAt: day.Add(1 * time.Hour)},
+		{ShortLinkID: link.ID, Referer: "https://news.example.com/", CreatedAt: day.Add(5 * time.Hour)},
+		{ShortLinkID: link.ID, CreatedAt: day.Add(26 * time.Hour)},
+		{ShortLinkID: link.ID, Browser: "Googlebot", DeviceType: "bot", IsBot: true, CreatedAt: day.Add(2 * time.Hour)},
+	}
+	linkHandler.db.Create(&records)
+	// 访客 a 两天都访问过，整个时间范围内只算一次
+	assert.NoError(t, linkHandler.visitors.Add(context.Background(), []visitors.Visit{
+		{LinkID: link.ID, Fingerprint: "a", Time: day.Add(1 * time.Hour)},
+		{LinkID: link.ID, Fingerprint: "b", Time: day.Add(5 * time.Hour)},
+		{LinkID: link.ID, Fingerprint: "a", Time: day.Add(26 * time.Hour)},
+	}))
+
+	w = doRequest(router, http.MethodGet, "/api/links/report/analytics?from=2026-03-02&to=2026-03-05&interval=day", "1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp AnalyticsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(3), resp.TotalClicks, "默认不包含爬虫的点击")
+	assert.Equal(t, int64(1), resp.BotClicks)
+	assert.Equal(t, int64(2), resp.UniqueVisitors)
+	if assert.Len(t, resp.Series, 3) {
+		assert.Equal(t, int64(2), resp.Series[0].Clicks)
+		assert.Equal(t, int64(1), resp.Series[1].Clicks)
+		assert.Equal(t, int64(0), resp.Series[2].Clicks)
+		for i, want := range []int64{2, 1, 0} {
+			if assert.NotNil(t, resp.Series[i].UniqueVisitors) {
+				assert.Equal(t, want, *resp.Series[i].UniqueVisitors)
+			}
+		}
+	}
+	if assert.Len(t, resp.TopReferers, 2) {
+		assert.Equal(t, CountItem{Value: "https://news.example.com/", Count: 2}, resp.TopReferers[0])
+		assert.Equal(t, CountItem{Value: "(direct)", Count: 1}, resp.TopReferers[1])
+	}
+
+	// include_bots=true 时包含爬虫的点击
+	w = doRequest(router, http.MethodGet, "/api/links/report/analytics?from=2026-03-02&to=2026-03-05&include_bots=true", "1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(4), resp.TotalClicks)
+	assert.Contains(t, resp.Browsers, CountItem{Value: "Googlebot", Count: 1})
+
+	// 其他用户无权查看
+	w = doRequest(router, http.MethodGet, "/api/links/report/analytics", "2", "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 不支持的时间粒度
+	w = doRequest(router, http.MethodGet, "/api/links/report/analytics?interval=month", "1", "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// collidingSource 先返回 collisions 次已被占用的短码 taken，之后返回新的短码
+type collidingSource struct {
+	mu         sync.Mutex
+	taken      string
+	collisions int
+	calls      int
+}
+
+func (s *collidingSource) Next(context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.collisions {
+		return s.taken, nil
+	}
+	return fmt.Sprintf("fresh%04d", s.calls), nil
+}
+
+func (s *collidingSource) Generatable(string) bool { return true }
+
+// TestCreateShortLink_RetryOnConflict 测试生成的短码被唯一索引拒绝时换新短码重试，且重试次数有上限
+func TestCreateShortLink_RetryOnConflict(t *testing.T) {
+	router, cleanup, h := setupTest()
+	defer cleanup()
+
+	// 在过滤器加载后直接插入数据库，模拟其他实例插入、本实例的过滤器并不知道的短码
+	registry := shortcode.NewRegistry(h.db, shortcode.NewMemoryFilter(0, 0), zap.NewNop().Sugar())
+	assert.NoError(t, registry.Load(context.Background()))
+	assert.NoError(t, h.db.Create(&model.ShortLink{ShortCode: "taken00", OriginalURL: "https://example.com"}).Error)
+
+	h.codeGenerator = shortcode.NewGenerator(&collidingSource{taken: "taken00", collisions: 2}, registry, zap.NewNop().Sugar())
+	w := postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/retry"})
+	h.codeGenerator.Stop()
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var resp CreateShortLinkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotContains(t, resp.ShortURL, "taken00")
+
+	// 一直冲突时在有限次数后返回 503
+	h.codeGenerator = shortcode.NewGenerator(&collidingSource{taken: "taken00", collisions: 1 << 30}, registry, zap.NewNop().Sugar())
+	w = postJSON(router, "/api/shorten", CreateShortLinkRequest{URL: "https://example.com/retry"})
+	h.codeGenerator.Stop()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+// TestCreateShortLink_Idempotency 测试使用相同幂等键重试时返回第一次创建的短链接
+func TestCreateShortLink_Idempotency(t *testing.T) {
+	router, cleanup, h := setupTest()
+	defer cleanup()
+
+	post := func(userID, key string, body CreateShortLinkRequest) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	body := CreateShortLinkRequest{URL: "https://example.com/once"}
+
+	first := post("1", "key-1", body)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	retry := post("1", "key-1", body)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+
+	var count int64
+	h.db.Model(&model.ShortLink{}).Where("original_url = ?", body.URL).Count(&count)
+	assert.Equal(t, int64(1), count, "重试不应创建重复的链接")
+
+	// 同一个键用于不同的参数返回 422
+	w := post("1", "key-1", CreateShortLinkRequest{URL: "https://example.com/other"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// 幂等键按用户隔离
+	w = post("2", "key-1", body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEqual(t, first.Body.String(), w.Body.String())
+
+	// 失败的请求不保存结果并释放幂等键，使用同一个键重试时重新执行
+	w = post("1", "key-2", CreateShortLinkRequest{URL: "https://example.com", Alias: "once-alias"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = post("1", "key-3", CreateShortLinkRequest{URL: "https://example.com", Alias: "once-alias"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = post("1", "key-3", CreateShortLinkRequest{URL: "https://example.com", Alias: "once-alias"})
+	assert.Equal(t, http.StatusConflict, w.Code, "释放后的键应重新执行而不是返回处理中")
+
+	// 前一个请求仍在处理中时返回 409
+	pending := CreateShortLinkRequest{URL: "https://example.com/pending"}
+	_, err := h.idempotency.Begin(context.Background(), shortenIdempotencyKey(1, "key-4"), shortenFingerprint(&pending, 0))
+	assert.NoError(t, err)
+	w = post("1", "key-4", pending)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	// 幂等键存储不可用时不创建链接，返回 503 让客户端稍后重试
+	h.idempotency = idempotency.NewWithStore(failingStore{})
+	w = post("1", "key-5", CreateShortLinkRequest{URL: "https://example.com/redis-down"})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	h.db.Model(&model.ShortLink{}).Where("original_url = ?", "https://example.com/redis-down").Count(&count)
+	assert.Zero(t, count)
+}
+
+// failingStore 模拟 Redis 不可用的幂等键存储
+type failingStore struct{}
+
+func (failingStore) SetNX(context.Context, string, []byte, time.Duration) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Del(context.Context, string) error { return errors.New("connection refused") }
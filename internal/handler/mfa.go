@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"shorturl-platform/internal/mfa"
+	"shorturl-platform/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MFAHandler 包含两步验证管理的处理器
+type MFAHandler struct {
+	db    *gorm.DB
+	redis *redis.Client
+	mfa   *mfa.Service
+}
+
+// NewMFAHandler 创建一个新的 MFAHandler
+func NewMFAHandler(db *gorm.DB, redis *redis.Client, mfaService *mfa.Service) *MFAHandler {
+	return &MFAHandler{db: db, redis: redis, mfa: mfaService}
+}
+
+// MFACodeRequest 定义了提交验证码请求的结构体
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"` // 验证器中的 6 位验证码或恢复码
+}
+
+// DisableMFARequest 定义了关闭两步验证请求的结构体
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+// MFAStatusResponse 定义了两步验证状态的响应
+type MFAStatusResponse struct {
+	Enabled                bool  `json:"enabled"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// MFASetupResponse 定义了绑定验证器的响应
+type MFASetupResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/shorturl-platform:alice?secret=JBSWY3DPEHPK3PXP&issuer=shorturl-platform"`
+}
+
+// RecoveryCodesResponse 定义了恢复码的响应，恢复码只在生成时返回一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetStatus godoc
+// @Summary 两步验证状态
+// @Description 返回当前用户是否启用了两步验证及剩余的恢复码数量
+// @Tags MFA
+// @Security ApiKeyAuth
+// @Produce  json
+// @Success 200 {object} MFAStatusResponse "成功响应"
+// @Router /api/me/2fa [get]
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	resp := MFAStatusResponse{Enabled: user.TOTPEnabled}
+	if user.TOTPEnabled {
+		remaining, err := h.mfa.RemainingRecoveryCodes(c.Request.Context(), user.ID)
+		if err != nil {
+			zap.S().Errorf("查询恢复码失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询两步验证状态失败"})
+			return
+		}
+		resp.RecoveryCodesRemaining = remaining
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Setup godoc
+// @Summary 绑定验证器
+// @Description 生成新的 TOTP 密钥，返回的 otpauth_uri 可以生成二维码供验证器应用扫描。需要调用 /api/me/2fa/enable 提交验证码确认后才会生效
+// @Tags MFA
+// @Security ApiKeyAuth
+// @Produce  json
+// @Success 200 {object} MFASetupResponse "成功响应"
+// @Failure 409 {object} gin.H "两步验证已启用"
+// @Router /api/me/2fa/setup [post]
+func (h *MFAHandler) Setup(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	enrollment, err := h.mfa.Setup(c.Request.Context(), user)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MFASetupResponse{Secret: enrollment.Secret, OTPAuthURI: enrollment.URI})
+}
+
+// Enable godoc
+// @Summary 启用两步验证
+// @Description 提交验证器中的验证码确认绑定，成功后返回一组一次性恢复码，恢复码只显示这一次，请妥善保存
+// @Tags MFA
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   MFACodeRequest  true  "验证码"
+// @Success 200 {object} RecoveryCodesResponse "成功响应"
+// @Failure 400 {object} gin.H "验证码错误或尚未绑定"
+// @Failure 409 {object} gin.H "两步验证已启用"
+// @Router /api/me/2fa/enable [post]
+func (h *MFAHandler) Enable(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	codes, err := h.mfa.Enable(c.Request.Context(), user, req.Code)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	invalidateUserCache(h.redis, user.Username)
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable godoc
+// @Summary 关闭两步验证
+// @Description 需要同时提交当前密码和验证码（或恢复码），关闭后密钥和恢复码全部删除
+// @Tags MFA
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   DisableMFARequest  true  "密码和验证码"
+// @Success 200 {object} gin.H "成功响应"
+// @Failure 400 {object} gin.H "密码或验证码错误"
+// @Router /api/me/2fa/disable [post]
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+	if err := h.mfa.Disable(c.Request.Context(), user, req.Code); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	invalidateUserCache(h.redis, user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary 重新生成恢复码
+// @Description 提交验证码后生成一组新的恢复码，之前的恢复码全部作废
+// @Tags MFA
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   MFACodeRequest  true  "验证码"
+// @Success 200 {object} RecoveryCodesResponse "成功响应"
+// @Failure 400 {object} gin.H "验证码错误或未启用两步验证"
+// @Router /api/me/2fa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	codes, err := h.mfa.RegenerateRecoveryCodes(c.Request.Context(), user, req.Code)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// currentUser 从数据库读取当前用户，不使用登录缓存，缓存中不包含 TOTP 密钥
+func (h *MFAHandler) currentUser(c *gin.Context) (*model.User, bool) {
+	var user model.User
+	if err := h.db.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// respondError 将两步验证服务的错误转换为响应
+func (h *MFAHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, mfa.ErrAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, mfa.ErrNotEnabled), errors.Is(err, mfa.ErrSetupRequired), errors.Is(err, mfa.ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		zap.S().Errorf("两步验证操作失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败，请重试"})
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shorturl-platform/internal/account"
+	"shorturl-platform/internal/loginguard"
+	"shorturl-platform/internal/mfa"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+	"shorturl-platform/pkg/mailer"
+	"shorturl-platform/pkg/totp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthHandler_TwoStepLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:mfa_handler_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RefreshToken{}, &model.RecoveryCode{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	user := model.User{Username: "root", Email: "root@example.com", Role: "admin", IsActive: true}
+	require.NoError(t, user.SetPassword("correct-horse"))
+	require.NoError(t, db.Create(&user).Error)
+
+	logger := zap.NewNop().Sugar()
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	sessions := session.NewService(db, tokens, session.NewDenylist(nil), time.Hour, logger)
+	mfaService := mfa.NewService(db, nil, "test", logger)
+	guard := loginguard.New(nil, loginguard.Options{MaxAttempts: 3}, logger)
+	accounts := account.NewService(db, mailer.NewLogMailer(logger), "test-secret", "", logger)
+	authHandler := NewAuthHandler(db, nil, tokens, sessions, guard, mfaService, accounts, true)
+	mfaHandler := NewMFAHandler(db, nil, mfaService)
+
+	router := gin.New()
+	router.Use(testIdentity())
+	router.POST("/auth/login", authHandler.Login)
+	router.POST("/auth/login/2fa", authHandler.LoginMFA)
+	router.POST("/api/me/2fa/setup", mfaHandler.Setup)
+	router.POST("/api/me/2fa/enable", mfaHandler.Enable)
+
+	post := func(path string, body any) (int, map[string]any) {
+		raw, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", strconv.Itoa(int(user.ID)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	credentials := LoginRequest{Username: "root", Password: "correct-horse"}
+
+	// 未启用两步验证的管理员可以登录，但会话不具有管理员权限
+	code, resp := post("/auth/login", credentials)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, resp["mfa_setup_required"])
+
+	code, resp = post("/api/me/2fa/setup", nil)
+	require.Equal(t, http.StatusOK, code)
+	secret := resp["secret"].(string)
+	totpCode, _ := totp.Code(secret, totp.Step(time.Now()))
+	code, resp = post("/api/me/2fa/enable", MFACodeRequest{Code: totpCode})
+	require.Equal(t, http.StatusOK, code)
+	recovery := resp["recovery_codes"].([]any)
+	require.Len(t, recovery, mfa.RecoveryCodeCount)
+
+	// 启用后密码正确只返回临时凭据
+	code, resp = post("/auth/login", credentials)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, resp["mfa_required"])
+	assert.Nil(t, resp["token"])
+	mfaToken := resp["mfa_token"].(string)
+
+	code, _ = post("/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken, Code: "000000"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, resp = post("/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken, Code: recovery[0].(string)})
+	require.Equal(t, http.StatusOK, code)
+	assert.Nil(t, resp["mfa_setup_required"])
+	claims, err := tokens.ValidateToken(resp["token"].(string))
+	require.NoError(t, err)
+	assert.True(t, claims.HasMFA())
+
+	// 临时凭据只能使用一次
+	code, _ = post("/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken, Code: recovery[1].(string)})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// 验证码错误计入登录失败次数，达到上限后锁定
+	_, resp = post("/auth/login", credentials)
+	mfaToken = resp["mfa_token"].(string)
+	for range 3 {
+		code, _ = post("/auth/login/2fa", LoginMFARequest{MFAToken: mfaToken, Code: "000000"})
+	}
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
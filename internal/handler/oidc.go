@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/mfa"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+	"shorturl-platform/pkg/oidc"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// oidcFlowCookie 保存一次登录流程的 state、nonce 和 PKCE verifier，只在回调路径上发送
+const oidcFlowCookie = "oidc_flow"
+
+// OIDCHandler 包含 OIDC 登录相关的处理器
+type OIDCHandler struct {
+	db       *gorm.DB
+	provider *oidc.Provider
+	sessions *session.Service
+	mfa      *mfa.Service
+	cfg      *config.OIDC
+	// bootstrapAdmin 是初始管理员的用户名，角色同步不会修改该用户，避免提供方的声明把唯一的管理员降级
+	bootstrapAdmin string
+}
+
+// NewOIDCHandler 创建一个新的 OIDCHandler，bootstrapAdmin 为初始管理员的用户名
+func NewOIDCHandler(db *gorm.DB, provider *oidc.Provider, sessions *session.Service, mfaService *mfa.Service, cfg *config.OIDC, bootstrapAdmin string) *OIDCHandler {
+	return &OIDCHandler{db: db, provider: provider, sessions: sessions, mfa: mfaService, cfg: cfg, bootstrapAdmin: bootstrapAdmin}
+}
+
+// oidcFlow 登录流程的临时状态
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// Info godoc
+// @Summary OIDC 登录信息
+// @Description 返回 OIDC 登录是否可用及登录按钮名称，未启用时返回 404
+// @Tags Auth
+// @Produce  json
+// @Success 200 {object} gin.H "成功响应"
+// @Router /auth/oidc [get]
+func (h *OIDCHandler) Info(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"name": h.cfg.Name, "login_url": "/auth/oidc/login"})
+}
+
+// Login godoc
+// @Summary OIDC 登录
+// @Description 跳转到身份提供方的登录页（授权码流程 + PKCE）
+// @Tags Auth
+// @Success 302 "跳转到身份提供方"
+// @Failure 502 {object} gin.H "无法连接身份提供方"
+// @Router /auth/oidc/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	var flow oidcFlow
+	var err error
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		if *v, err = oidc.RandomString(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成登录状态失败"})
+			return
+		}
+	}
+
+	authURL, err := h.provider.AuthCodeURL(c.Request.Context(), flow.State, flow.Nonce, oidc.CodeChallenge(flow.Verifier))
+	if err != nil {
+		zap.S().Errorf("OIDC 登录失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接身份提供方"})
+		return
+	}
+
+	raw, _ := json.Marshal(flow)
+	h.setFlowCookie(c, base64.RawURLEncoding.EncodeToString(raw), 600)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary OIDC 登录回调
+// @Description 身份提供方登录成功后的回调。校验 state 和 ID Token，首次登录时自动创建用户，然后跳转回首页并在 URL 片段中携带令牌。
+// @Description 启用了两步验证的用户在提供方没有完成多因素认证时，片段中只携带 mfa_token，需要再调用 /auth/login/2fa 提交验证码
+// @Tags Auth
+// @Param   code   query  string  true  "授权码"
+// @Param   state  query  string  true  "登录状态"
+// @Success 302 "跳转回首页"
+// @Router /auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	flow, ok := h.readFlow(c)
+	// 状态只能使用一次
+	h.setFlowCookie(c, "", -1)
+	if !ok || flow.State == "" || c.Query("state") != flow.State {
+		h.fail(c, "登录状态无效或已过期，请重新登录")
+		return
+	}
+	if errCode := c.Query("error"); errCode != "" {
+		zap.S().Warnf("身份提供方返回错误: %s %s", errCode, c.Query("error_description"))
+		h.fail(c, "身份提供方拒绝了登录请求")
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.provider.Exchange(ctx, c.Query("code"), flow.Verifier)
+	if err != nil {
+		zap.S().Errorf("OIDC 换取令牌失败: %v", err)
+		h.fail(c, "登录失败，请重试")
+		return
+	}
+	identity, err := h.provider.Verify(ctx, token.IDToken, flow.Nonce)
+	if err != nil {
+		zap.S().Warnf("OIDC ID Token 验证失败: %v", err)
+		h.fail(c, "登录失败，请重试")
+		return
+	}
+
+	user, err := h.provisionUser(identity)
+	if err != nil {
+		zap.S().Errorf("OIDC 用户关联失败: %v", err)
+		h.fail(c, "无法创建或关联本地账户，请联系管理员")
+		return
+	}
+	if !user.IsActive {
+		h.fail(c, "账户已被禁用")
+		return
+	}
+
+	amr := identityAMR(identity.Claims)
+	if user.TOTPEnabled && !slices.Contains(amr, auth.AMRMFA) {
+		// 提供方没有完成多因素认证时同样需要本地的两步验证，与密码登录一样走 /auth/login/2fa
+		token, err := h.mfa.BeginChallenge(ctx, user.ID)
+		if err != nil {
+			zap.S().Errorf("生成两步验证凭据失败: %v", err)
+			h.fail(c, "登录失败，请重试")
+			return
+		}
+		c.Redirect(http.StatusFound, "/#oidc?"+url.Values{"mfa_token": {token}}.Encode())
+		return
+	}
+
+	pair, err := h.sessions.Issue(ctx, user, clientInfo(c), amr)
+	if err != nil {
+		zap.S().Errorf("生成令牌失败: %v", err)
+		h.fail(c, "生成令牌失败")
+		return
+	}
+	go h.db.Model(user).Update("last_login", time.Now())
+
+	// 令牌放在 URL 片段中，不会发送到服务器或出现在访问日志里
+	fragment := url.Values{"token": {pair.AccessToken}, "refresh_token": {pair.RefreshToken}}
+	c.Redirect(http.StatusFound, "/#oidc?"+fragment.Encode())
+}
+
+// provisionUser 找到外部账户关联的本地用户，首次登录时关联或创建用户
+func (h *OIDCHandler) provisionUser(id *oidc.IDToken) (*model.User, error) {
+	var user model.User
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var identity model.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", h.issuer(), id.Subject).First(&identity).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := h.linkOrCreateUser(tx, id, &user); err != nil {
+				return err
+			}
+			identity = model.UserIdentity{UserID: user.ID, Issuer: h.issuer(), Subject: id.Subject, Email: id.Email}
+			if err := tx.Create(&identity).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		// 配置了角色声明时，以身份提供方为准同步角色，初始管理员除外
+		if h.cfg.RoleClaim != "" && user.Username != h.bootstrapAdmin {
+			if role := h.mapRole(id.Claims); role != user.Role {
+				zap.S().Infow("根据身份提供方同步用户角色", "username", user.Username, "from", user.Role, "to", role)
+				user.Role = role
+				return tx.Model(&user).Update("role", role).Error
+			}
+		}
+		return nil
+	})
+	return &user, err
+}
+
+// linkOrCreateUser 提供方验证过的邮箱与本地用户已验证的邮箱相同时关联该用户，否则创建新用户。
+// 本地邮箱未经验证时可能是他人抢先用该邮箱注册的，关联后对方仍能用本地密码登录，因此不关联
+func (h *OIDCHandler) linkOrCreateUser(tx *gorm.DB, id *oidc.IDToken, user *model.User) error {
+	email := ""
+	if id.Email != "" && id.EmailVerified {
+		err := tx.Where("email = ?", id.Email).First(user).Error
+		switch {
+		case err == nil && user.EmailVerified:
+			zap.S().Infow("OIDC 账户已关联到本地用户", "username", user.Username, "issuer", h.issuer(), "subject", id.Subject)
+			return nil
+		case err == nil:
+			zap.S().Warnw("本地用户的邮箱未验证，不关联 OIDC 账户", "username", user.Username, "issuer", h.issuer(), "subject", id.Subject)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			email = id.Email
+		default:
+			return err
+		}
+	}
+	if email == "" {
+		// 未验证或已被本地用户占用的邮箱不写入
+		email = subjectHash(h.issuer(), id.Subject) + "@oidc.invalid"
+	}
+	username, err := h.uniqueUsername(tx, id)
+	if err != nil {
+		return err
+	}
+	password, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+
+	*user = model.User{Username: username, Email: email, Role: h.defaultRole(), IsActive: true}
+	if email == id.Email {
+		// 提供方已经验证过邮箱，不需要再发送验证邮件
+		now := time.Now()
+		user.EmailVerified, user.EmailVerifiedAt = true, &now
+	}
+	if h.cfg.RoleClaim != "" {
+		user.Role = h.mapRole(id.Claims)
+	}
+	// 外部账户不使用本地密码登录，设置一个随机密码
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+	zap.S().Infow("OIDC 首次登录，已创建用户", "username", user.Username, "role", user.Role, "issuer", h.issuer(), "subject", id.Subject)
+	return nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// uniqueUsername 根据配置的声明生成用户名，与已有用户重名时追加序号，不会因重名关联到其他用户
+func (h *OIDCHandler) uniqueUsername(tx *gorm.DB, id *oidc.IDToken) (string, error) {
+	claim := h.cfg.UsernameClaim
+	if claim == "" {
+		claim = "preferred_username"
+	}
+	base, _ := id.Claims[claim].(string)
+	if claim == "email" {
+		base, _, _ = strings.Cut(base, "@")
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "oidc_" + subjectHash(h.issuer(), id.Subject)[:8]
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d", base, i+1)
+		}
+		var count int64
+		if err := tx.Model(&model.User{}).Unscoped().Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("无法生成唯一的用户名")
+}
+
+// mapRole 根据角色声明映射本地角色，声明可以是字符串或字符串数组，匹配到多个时 admin 优先
+func (h *OIDCHandler) mapRole(claims map[string]any) string {
+	var values []string
+	switch v := claims[h.cfg.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	role := ""
+	for _, v := range values {
+		mapped, ok := h.cfg.RoleMapping[v]
+		if !ok {
+			continue
+		}
+		if mapped == "admin" {
+			return mapped
+		}
+		if role == "" {
+			role = mapped
+		}
+	}
+	if role == "" {
+		return h.defaultRole()
+	}
+	return role
+}
+
+// identityAMR 返回 OIDC 会话的登录方式，身份提供方在 amr 声明中表明已完成多因素认证时视为通过两步验证
+func identityAMR(claims map[string]any) []string {
+	amr := []string{auth.AMROIDC}
+	values, _ := claims["amr"].([]any)
+	for _, v := range values {
+		switch v {
+		case auth.AMRMFA, auth.AMROTP, "hwk", "swk":
+			return append(amr, auth.AMRMFA)
+		}
+	}
+	return amr
+}
+
+// issuer 返回规范化的 issuer，作为外部账户的命名空间
+func (h *OIDCHandler) issuer() string {
+	return strings.TrimSuffix(h.cfg.Issuer, "/")
+}
+
+func (h *OIDCHandler) defaultRole() string {
+	if h.cfg.DefaultRole != "" {
+		return h.cfg.DefaultRole
+	}
+	return "user"
+}
+
+// readFlow 读取登录流程 Cookie
+func (h *OIDCHandler) readFlow(c *gin.Context) (oidcFlow, bool) {
+	var flow oidcFlow
+	value, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		return flow, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(raw, &flow) != nil {
+		return flow, false
+	}
+	return flow, true
+}
+
+// setFlowCookie 写入或清除登录流程 Cookie。SameSite=Lax 保证从提供方跳转回来时 Cookie 会被携带
+func (h *OIDCHandler) setFlowCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, value, maxAge, "/auth/oidc", "", c.Request.TLS != nil, true)
+}
+
+// fail 跳转回首页并显示错误信息
+func (h *OIDCHandler) fail(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, "/#oidc?"+url.Values{"error": {message}}.Encode())
+}
+
+// subjectHash 返回外部账户的短哈希，用于生成占位用户名和邮箱
+func subjectHash(issuer, subject string) string {
+	sum := sha256.Sum256([]byte(issuer + "|" + subject))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/mfa"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+	"shorturl-platform/pkg/oidc"
+	"shorturl-platform/pkg/oidc/oidctest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// oidcTestEnv 是 OIDC 登录测试使用的身份提供方、数据库和路由
+type oidcTestEnv struct {
+	issuer *oidctest.Issuer
+	db     *gorm.DB
+	tokens *auth.TokenManager
+	mfa    *mfa.Service
+	router *gin.Engine
+}
+
+func setupOIDCTest(t *testing.T, dbName string) *oidcTestEnv {
+	gin.SetMode(gin.TestMode)
+	issuer := oidctest.NewIssuer("shorturl", "s3cret")
+	t.Cleanup(issuer.Close)
+
+	db, err := gorm.Open(sqlite.Open("file:"+dbName+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.UserIdentity{}, &model.RefreshToken{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	cfg := &config.OIDC{
+		Issuer:      issuer.URL(),
+		ClientID:    "shorturl",
+		RedirectURL: "http://localhost/auth/oidc/callback",
+		RoleClaim:   "groups",
+		RoleMapping: map[string]string{"shorturl-admins": "admin"},
+	}
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer: cfg.Issuer, ClientID: cfg.ClientID, ClientSecret: "s3cret", RedirectURL: cfg.RedirectURL,
+	}, nil)
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	sessions := session.NewService(db, tokens, session.NewDenylist(nil), time.Hour, zap.NewNop().Sugar())
+	mfaService := mfa.NewService(db, nil, "test", zap.NewNop().Sugar())
+	h := NewOIDCHandler(db, provider, sessions, mfaService, cfg, "admin")
+
+	router := gin.New()
+	router.GET("/auth/oidc/login", h.Login)
+	router.GET("/auth/oidc/callback", h.Callback)
+	return &oidcTestEnv{issuer: issuer, db: db, tokens: tokens, mfa: mfaService, router: router}
+}
+
+// login 完成一次完整的浏览器登录流程，返回回调跳转到的首页片段参数
+func (e *oidcTestEnv) login(t *testing.T, tamperState bool) url.Values {
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	require.NotEmpty(t, cookies)
+
+	callback, err := e.issuer.Authorize(w.Header().Get("Location"))
+	require.NoError(t, err)
+	if tamperState {
+		q := callback.Query()
+		q.Set("state", "forged")
+		callback.RawQuery = q.Encode()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	location := w.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/#oidc?"), location)
+	fragment, _ := url.ParseQuery(strings.TrimPrefix(location, "/#oidc?"))
+	return fragment
+}
+
+func TestOIDCHandler_LoginProvisionsUser(t *testing.T) {
+	env := setupOIDCTest(t, "oidc_handler_test")
+	db, issuer, tokens := env.db, env.issuer, env.tokens
+	// 已有一个同名的本地用户，OIDC 用户不能因为重名被关联到该用户
+	require.NoError(t, db.Create(&model.User{Username: "alice", Email: "alice@local", PasswordHash: "x", Role: "user", IsActive: true}).Error)
+
+	issuer.SetClaims(map[string]any{
+		"sub": "emp-42", "email": "alice@corp.example", "email_verified": true,
+		"preferred_username": "alice", "groups": []string{"staff", "shorturl-admins"},
+		"amr": []string{"pwd", "mfa"},
+	})
+	fragment := env.login(t, false)
+	require.Empty(t, fragment.Get("error"))
+	claims, err := tokens.ValidateToken(fragment.Get("token"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice-2", claims.Username)
+	assert.Equal(t, "admin", claims.Role)
+	assert.True(t, claims.HasMFA(), "身份提供方完成了多因素认证")
+	assert.NotEmpty(t, fragment.Get("refresh_token"))
+	var created model.User
+	require.NoError(t, db.Where("username = ?", "alice-2").First(&created).Error)
+	assert.True(t, created.EmailVerified, "提供方验证过的邮箱无需再次验证")
+
+	// 再次登录使用同一个本地用户，角色随身份提供方同步
+	issuer.SetClaims(map[string]any{"sub": "emp-42", "preferred_username": "alice", "groups": []string{"staff"}})
+	fragment = env.login(t, false)
+	claims, err = tokens.ValidateToken(fragment.Get("token"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice-2", claims.Username)
+	assert.Equal(t, "user", claims.Role)
+	assert.False(t, claims.HasMFA())
+
+	var identities int64
+	db.Model(&model.UserIdentity{}).Count(&identities)
+	assert.Equal(t, int64(1), identities)
+
+	// state 不匹配时拒绝登录
+	fragment = env.login(t, true)
+	assert.NotEmpty(t, fragment.Get("error"))
+	assert.Empty(t, fragment.Get("token"))
+}
+
+func TestOIDCHandler_LinksOnlyVerifiedEmail(t *testing.T) {
+	env := setupOIDCTest(t, "oidc_handler_link_test")
+	users := []model.User{
+		// 抢先用受害者邮箱注册、没有验证邮箱的本地账户
+		{Username: "bob", Email: "bob@corp.example", Role: "user", IsActive: true},
+		{Username: "carol", Email: "carol@corp.example", Role: "user", IsActive: true, EmailVerified: true},
+		{Username: "admin", Email: "admin@corp.example", Role: "admin", IsActive: true, EmailVerified: true},
+	}
+	for i := range users {
+		require.NoError(t, users[i].SetPassword("local-password"))
+		require.NoError(t, env.db.Create(&users[i]).Error)
+	}
+
+	loginAs := func(subject, username string) *auth.Claims {
+		env.issuer.SetClaims(map[string]any{
+			"sub": subject, "email": username + "@corp.example", "email_verified": true,
+			"preferred_username": username, "groups": []string{"staff"},
+		})
+		fragment := env.login(t, false)
+		require.Empty(t, fragment.Get("error"))
+		claims, err := env.tokens.ValidateToken(fragment.Get("token"))
+		require.NoError(t, err)
+		return claims
+	}
+
+	// 本地邮箱未验证时创建独立的用户，不占用该邮箱
+	claims := loginAs("emp-bob", "bob")
+	assert.Equal(t, "bob-2", claims.Username)
+	var created model.User
+	require.NoError(t, env.db.Where("username = ?", "bob-2").First(&created).Error)
+	assert.NotEqual(t, "bob@corp.example", created.Email)
+	assert.False(t, created.EmailVerified)
+
+	// 本地邮箱已验证时关联该用户
+	claims = loginAs("emp-carol", "carol")
+	assert.Equal(t, "carol", claims.Username)
+	assert.Equal(t, users[1].ID, claims.UserID)
+
+	// 初始管理员关联后角色不随身份提供方同步
+	claims = loginAs("emp-admin", "admin")
+	assert.Equal(t, "admin", claims.Username)
+	assert.Equal(t, "admin", claims.Role)
+}
+
+func TestOIDCHandler_TOTPUserRequiresChallenge(t *testing.T) {
+	env := setupOIDCTest(t, "oidc_handler_totp_test")
+	user := model.User{Username: "dave", Email: "dave@corp.example", Role: "user", IsActive: true, EmailVerified: true, TOTPEnabled: true, TOTPSecret: "JBSWY3DPEHPK3PXP"}
+	require.NoError(t, user.SetPassword("local-password"))
+	require.NoError(t, env.db.Create(&user).Error)
+	claims := map[string]any{"sub": "emp-dave", "email": "dave@corp.example", "email_verified": true, "preferred_username": "dave"}
+
+	// 提供方没有完成多因素认证时只返回两步验证凭据
+	env.issuer.SetClaims(claims)
+	fragment := env.login(t, false)
+	assert.Empty(t, fragment.Get("token"))
+	assert.Empty(t, fragment.Get("refresh_token"))
+	require.NotEmpty(t, fragment.Get("mfa_token"))
+	userID, err := env.mfa.ChallengeUser(context.Background(), fragment.Get("mfa_token"))
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	// amr 表明已完成多因素认证时直接登录
+	claims["amr"] = []string{"pwd", "otp"}
+	env.issuer.SetClaims(claims)
+	fragment = env.login(t, false)
+	assert.Empty(t, fragment.Get("mfa_token"))
+	token, err := env.tokens.ValidateToken(fragment.Get("token"))
+	require.NoError(t, err)
+	assert.True(t, token.HasMFA())
+}
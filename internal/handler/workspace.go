@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"shorturl-platform/internal/workspace"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// WorkspaceHandler 包含工作区及成员管理的处理器，工作区和角色由 WorkspaceScope 中间件解析
+type WorkspaceHandler struct {
+	workspaces *workspace.Service
+}
+
+// NewWorkspaceHandler 创建一个新的 WorkspaceHandler
+func NewWorkspaceHandler(workspaces *workspace.Service) *WorkspaceHandler {
+	return &WorkspaceHandler{workspaces: workspaces}
+}
+
+// WorkspaceRequest 定义了创建或重命名工作区请求的结构体
+type WorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"市场部"`
+}
+
+// AddMemberRequest 定义了添加工作区成员请求的结构体
+type AddMemberRequest struct {
+	Login string `json:"login" binding:"required" example:"alice"` // 用户名或邮箱
+	Role  string `json:"role" binding:"required,oneof=owner editor viewer" example:"editor"`
+}
+
+// UpdateMemberRequest 定义了修改成员角色请求的结构体
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer" example:"viewer"`
+}
+
+// ListWorkspaces godoc
+// @Summary 获取工作区列表
+// @Description 获取当前用户所在的工作区及其角色
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Produce  json
+// @Success 200 {array} workspace.Summary "成功响应"
+// @Router /api/workspaces [get]
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	list, err := h.workspaces.List(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		zap.S().Errorf("查询工作区失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询工作区失败"})
+		return
+	}
+	if list == nil {
+		list = []workspace.Summary{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// CreateWorkspace godoc
+// @Summary 创建工作区
+// @Description 创建一个工作区，创建者成为所有者
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   body  body   WorkspaceRequest  true  "工作区名称"
+// @Success 201 {object} workspace.Summary "创建成功"
+// @Failure 400 {object} gin.H "请求无效"
+// @Router /api/workspaces [post]
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	ws, err := h.workspaces.Create(c.Request.Context(), currentUserID(c), req.Name)
+	if err != nil {
+		zap.S().Errorf("创建工作区失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建工作区失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, ws)
+}
+
+// RenameWorkspace godoc
+// @Summary 重命名工作区
+// @Description 修改工作区名称，需要工作区所有者权限
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   workspace_id  path  int               true  "工作区 ID"
+// @Param   body          body  WorkspaceRequest  true  "工作区名称"
+// @Success 200 {object} model.Workspace "成功响应"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "工作区不存在"
+// @Router /api/workspaces/{workspace_id} [patch]
+func (h *WorkspaceHandler) RenameWorkspace(c *gin.Context) {
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	ws, err := h.workspaces.Rename(c.Request.Context(), currentWorkspaceID(c), req.Name)
+	if err != nil {
+		respondWorkspaceError(c, err, "重命名工作区失败")
+		return
+	}
+	c.JSON(http.StatusOK, ws)
+}
+
+// DeleteWorkspace godoc
+// @Summary 删除工作区
+// @Description 删除工作区及其成员关系，工作区中还有链接时不能删除，需要工作区所有者权限
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   workspace_id  path  int  true  "工作区 ID"
+// @Success 200 {object} gin.H "删除成功"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "工作区不存在"
+// @Failure 409 {object} gin.H "工作区中还有链接"
+// @Router /api/workspaces/{workspace_id} [delete]
+func (h *WorkspaceHandler) DeleteWorkspace(c *gin.Context) {
+	if err := h.workspaces.Delete(c.Request.Context(), currentWorkspaceID(c)); err != nil {
+		respondWorkspaceError(c, err, "删除工作区失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "工作区已删除"})
+}
+
+// ListMembers godoc
+// @Summary 获取工作区成员
+// @Description 获取工作区的成员及其角色，工作区的任何成员都可以查看
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   workspace_id  path  int  true  "工作区 ID"
+// @Success 200 {array} workspace.Member "成功响应"
+// @Failure 404 {object} gin.H "工作区不存在"
+// @Router /api/workspaces/{workspace_id}/members [get]
+func (h *WorkspaceHandler) ListMembers(c *gin.Context) {
+	members, err := h.workspaces.Members(c.Request.Context(), currentWorkspaceID(c))
+	if err != nil {
+		zap.S().Errorf("查询工作区成员失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询工作区成员失败"})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// AddMember godoc
+// @Summary 添加工作区成员
+// @Description 按用户名或邮箱添加成员，角色可选 owner、editor、viewer，需要工作区所有者权限
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   workspace_id  path  int               true  "工作区 ID"
+// @Param   body          body  AddMemberRequest  true  "成员信息"
+// @Success 201 {object} workspace.Member "添加成功"
+// @Failure 400 {object} gin.H "请求无效"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "用户不存在"
+// @Failure 409 {object} gin.H "用户已经是成员"
+// @Router /api/workspaces/{workspace_id}/members [post]
+func (h *WorkspaceHandler) AddMember(c *gin.Context) {
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	member, err := h.workspaces.AddMember(c.Request.Context(), currentWorkspaceID(c), req.Login, req.Role)
+	if err != nil {
+		respondWorkspaceError(c, err, "添加成员失败")
+		return
+	}
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateMember godoc
+// @Summary 修改成员角色
+// @Description 修改工作区成员的角色，工作区至少需要保留一个所有者，需要工作区所有者权限
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param   workspace_id  path  int                  true  "工作区 ID"
+// @Param   user_id       path  int                  true  "用户 ID"
+// @Param   body          body  UpdateMemberRequest  true  "新角色"
+// @Success 200 {object} gin.H "修改成功"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "成员不存在"
+// @Failure 409 {object} gin.H "不能降级最后一个所有者"
+// @Router /api/workspaces/{workspace_id}/members/{user_id} [patch]
+func (h *WorkspaceHandler) UpdateMember(c *gin.Context) {
+	userID, ok := parseMemberID(c)
+	if !ok {
+		return
+	}
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据: " + err.Error()})
+		return
+	}
+	if err := h.workspaces.UpdateMember(c.Request.Context(), currentWorkspaceID(c), userID, req.Role); err != nil {
+		respondWorkspaceError(c, err, "修改成员角色失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员角色已更新", "role": req.Role})
+}
+
+// RemoveMember godoc
+// @Summary 移除工作区成员
+// @Description 所有者可以移除任何成员，其他成员只能移除自己（退出工作区），工作区至少需要保留一个所有者
+// @Tags Workspace
+// @Security ApiKeyAuth
+// @Produce  json
+// @Param   workspace_id  path  int  true  "工作区 ID"
+// @Param   user_id       path  int  true  "用户 ID"
+// @Success 200 {object} gin.H "移除成功"
+// @Failure 403 {object} gin.H "无权操作"
+// @Failure 404 {object} gin.H "成员不存在"
+// @Failure 409 {object} gin.H "不能移除最后一个所有者"
+// @Router /api/workspaces/{workspace_id}/members/{user_id} [delete]
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	userID, ok := parseMemberID(c)
+	if !ok {
+		return
+	}
+	if userID != currentUserID(c) && !workspace.Allows(c.GetString("workspace_role"), workspace.RoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "需要工作区 owner 权限"})
+		return
+	}
+	if err := h.workspaces.RemoveMember(c.Request.Context(), currentWorkspaceID(c), userID); err != nil {
+		respondWorkspaceError(c, err, "移除成员失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// parseMemberID 解析路径中的用户 ID，失败时直接写入错误响应
+func parseMemberID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户 ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWorkspaceError 将工作区服务的错误映射为响应
+func respondWorkspaceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound), errors.Is(err, workspace.ErrMemberNotFound), errors.Is(err, workspace.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, workspace.ErrAlreadyMember), errors.Is(err, workspace.ErrLastOwner), errors.Is(err, workspace.ErrNotEmpty):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		zap.S().Errorf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"shorturl-platform/internal/clicks"
+	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/middleware"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/shortcode"
+	"shorturl-platform/internal/visitors"
+	"shorturl-platform/internal/workspace"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestWorkspaceHandler_ScopedLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:workspace_handler_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.ShortLink{}, &model.ClickRecord{}, &model.Workspace{}, &model.WorkspaceMember{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	logger := zap.NewNop().Sugar()
+	counter := visitors.NewMemoryCounter()
+	registry := shortcode.NewRegistry(db, nil, logger)
+	links := NewShortLinkHandler(db, nil, shortcode.NewGenerator(shortcode.NewRandomSource(registry, shortcode.DefaultCodeLength, shortcode.DefaultCharset), registry, logger), &config.Link{},
+		clicks.NewRecorder(db, clicks.Options{Visitors: counter}, logger), counter)
+	workspaces := workspace.NewService(db, logger)
+	h := NewWorkspaceHandler(workspaces)
+
+	// 与 registerRoutes 相同的权限配置
+	router := gin.New()
+	router.Use(testIdentity())
+	viewer := middleware.RequireWorkspaceRole(workspace.RoleViewer)
+	editor := middleware.RequireWorkspaceRole(workspace.RoleEditor)
+	owner := middleware.RequireWorkspaceRole(workspace.RoleOwner)
+	router.POST("/api/workspaces", h.CreateWorkspace)
+	router.GET("/api/workspaces", h.ListWorkspaces)
+	api := router.Group("/api", middleware.WorkspaceScope(workspaces))
+	api.POST("/shorten", editor, links.CreateShortLink)
+	api.GET("/links", viewer, links.GetAllLinks)
+	api.DELETE("/links/:code", editor, links.DeleteLink)
+	scoped := router.Group("/api/workspaces/:workspace_id", middleware.WorkspaceScope(workspaces))
+	scoped.GET("/links", viewer, links.GetAllLinks)
+	scoped.DELETE("", owner, h.DeleteWorkspace)
+	scoped.POST("/members", owner, h.AddMember)
+	scoped.PATCH("/members/:user_id", owner, h.UpdateMember)
+	scoped.DELETE("/members/:user_id", h.RemoveMember)
+
+	users := map[string]string{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user := model.User{Username: name, Email: name + "@example.com", PasswordHash: "x", IsActive: true}
+		require.NoError(t, db.Create(&user).Error)
+		users[name] = strconv.Itoa(int(user.ID))
+	}
+
+	w := doRequest(router, http.MethodPost, "/api/workspaces", users["alice"], "", WorkspaceRequest{Name: "市场部"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var ws workspace.Summary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ws))
+	base := fmt.Sprintf("/api/workspaces/%d", ws.ID)
+
+	w = doRequest(router, http.MethodPost, base+"/members", users["alice"], "", AddMemberRequest{Login: "bob", Role: workspace.RoleViewer})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "bob@example.com", "成员信息不应包含邮箱")
+
+	// 通过请求头指定工作区：viewer 不能创建链接，升级为 editor 后可以
+	shorten := func(user, alias, header string) int {
+		return doRequestWithHeader(router, http.MethodPost, "/api/shorten", user,
+			CreateShortLinkRequest{URL: "https://example.com/" + alias, Alias: alias}, header)
+	}
+	header := strconv.Itoa(int(ws.ID))
+	assert.Equal(t, http.StatusForbidden, shorten(users["bob"], "bob-ws", header))
+	w = doRequest(router, http.MethodPatch, base+"/members/"+users["bob"], users["alice"], "", UpdateMemberRequest{Role: workspace.RoleEditor})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusCreated, shorten(users["bob"], "bob-ws", header))
+	assert.Equal(t, http.StatusCreated, shorten(users["bob"], "bob-own", ""))
+	assert.Equal(t, http.StatusNotFound, shorten(users["carol"], "carol-ws", header), "非成员看不到工作区")
+
+	// 成员共享工作区中的链接，个人空间互不可见
+	list := func(user, path string) []model.ShortLink {
+		w := doRequest(router, http.MethodGet, path, user, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var result []model.ShortLink
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+	shared := list(users["alice"], base+"/links")
+	require.Len(t, shared, 1)
+	assert.Equal(t, "bob-ws", shared[0].ShortCode)
+	assert.Equal(t, ws.ID, shared[0].WorkspaceID)
+	assert.Empty(t, list(users["alice"], "/api/links"))
+	own := list(users["bob"], "/api/links")
+	require.Len(t, own, 1)
+	assert.Equal(t, "bob-own", own[0].ShortCode)
+
+	// 工作区中的链接只能在该工作区范围内管理
+	w = doRequest(router, http.MethodDelete, "/api/links/bob-ws", users["bob"], "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusNotFound,
+		doRequestWithHeader(router, http.MethodDelete, "/api/links/bob-own", users["alice"], nil, header))
+
+	// 所有者不能退出最后一个所有者的身份；editor 可以自己退出，但不能移除他人
+	w = doRequest(router, http.MethodDelete, base+"/members/"+users["alice"], users["bob"], "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(router, http.MethodDelete, base+"/members/"+users["alice"], users["alice"], "", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(router, http.MethodDelete, base+"/members/"+users["bob"], users["bob"], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, http.MethodGet, base+"/links", users["bob"], "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 管理员在任何工作区中都视为所有者；工作区中还有链接时不能删除
+	w = doRequest(router, http.MethodDelete, base, users["carol"], "admin", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, http.StatusOK,
+		doRequestWithHeader(router, http.MethodDelete, "/api/links/bob-ws", users["alice"], nil, header))
+	w = doRequest(router, http.MethodDelete, base, users["alice"], "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, http.MethodGet, base+"/links", users["carol"], "admin", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// doRequestWithHeader 以指定用户身份在 X-Workspace-ID 指定的工作区中发起请求，返回状态码
+func doRequestWithHeader(router *gin.Engine, method, path, userID string, body interface{}, workspaceID string) int {
+	bodyBytes, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", userID)
+	req.Header.Set(middleware.WorkspaceHeader, workspaceID)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
@@ -0,0 +1,122 @@
+// Package idempotency 保存带 Idempotency-Key 请求头的请求的结果，客户端在超时后用同一个键重试时
+// 返回第一次请求的响应，而不是重复执行。
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Header 是客户端传入幂等键的请求头
+	Header = "Idempotency-Key"
+	// ReplayedHeader 出现在重放的响应中，表示响应来自之前保存的结果
+	ReplayedHeader = "Idempotent-Replayed"
+	// MaxKeyLength 是幂等键的最大长度
+	MaxKeyLength = 255
+	// TTL 是请求结果的保留时间
+	TTL = 24 * time.Hour
+	// pendingTTL 是请求处理中的占位记录的保留时间，实例在处理过程中崩溃时占位记录在该时间后失效
+	pendingTTL = time.Minute
+)
+
+var (
+	// ErrInProgress 表示使用相同幂等键的请求仍在处理中
+	ErrInProgress = errors.New("使用相同幂等键的请求正在处理中")
+	// ErrMismatch 表示幂等键已用于参数不同的请求
+	ErrMismatch = errors.New("幂等键已用于参数不同的请求")
+)
+
+// Response 是保存下来的响应
+type Response struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// record 是幂等键对应的记录，Response 为 nil 时请求仍在处理中
+type record struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+// Store 保存幂等记录，所有键都带有过期时间
+type Store interface {
+	// SetNX 在键不存在时写入 value 并返回 nil；键已存在时不写入，返回现有的值
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, error)
+	// Set 覆盖写入
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Del 删除键
+	Del(ctx context.Context, key string) error
+}
+
+// Service 管理幂等键的生命周期：Begin 占用键，请求成功后 Complete 保存响应，失败时 Release 释放键以便客户端重试
+type Service struct {
+	store Store
+}
+
+// New 在 Redis 可用时返回多实例共享的实现，否则只在当前实例内生效
+func New(rdb *redis.Client) *Service {
+	if rdb != nil {
+		return NewWithStore(NewRedisStore(rdb))
+	}
+	return NewWithStore(NewMemoryStore())
+}
+
+// NewWithStore 使用指定的存储创建 Service
+func NewWithStore(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Fingerprint 计算请求参数的指纹，用于识别同一幂等键被用于不同的请求
+func Fingerprint(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin 开始处理带幂等键的请求。键已保存过响应时返回该响应，调用方应直接返回它；
+// 返回 nil 时键已被占用，调用方处理请求后必须调用 Complete 或 Release
+func (s *Service) Begin(ctx context.Context, key, fingerprint string) (*Response, error) {
+	value, err := json.Marshal(record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.store.SetNX(ctx, storeKey(key), value, pendingTTL)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(existing, &rec); err != nil {
+		return nil, err
+	}
+	if rec.Fingerprint != fingerprint {
+		return nil, ErrMismatch
+	}
+	if rec.Response == nil {
+		return nil, ErrInProgress
+	}
+	return rec.Response, nil
+}
+
+// Complete 保存请求的响应，之后 TTL 内使用同一个键的请求都会得到该响应
+func (s *Service) Complete(ctx context.Context, key, fingerprint string, resp Response) error {
+	value, err := json.Marshal(record{Fingerprint: fingerprint, Response: &resp})
+	if err != nil {
+		return err
+	}
+	return s.store.Set(ctx, storeKey(key), value, TTL)
+}
+
+// Release 释放请求失败时占用的键
+func (s *Service) Release(ctx context.Context, key string) error {
+	return s.store.Del(ctx, storeKey(key))
+}
+
+func storeKey(key string) string { return "idempotency:" + key }
@@ -0,0 +1,55 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	s := NewWithStore(store)
+	ctx := context.Background()
+
+	// 第一次请求占用键
+	saved, err := s.Begin(ctx, "k1", "fp")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+
+	// 处理中的重试和参数不同的请求都被拒绝
+	_, err = s.Begin(ctx, "k1", "fp")
+	assert.ErrorIs(t, err, ErrInProgress)
+	_, err = s.Begin(ctx, "k1", "other")
+	assert.ErrorIs(t, err, ErrMismatch)
+
+	// 完成后重试得到保存的响应
+	require.NoError(t, s.Complete(ctx, "k1", "fp", Response{Status: 201, Body: []byte(`{"short_url":"x"}`)}))
+	saved, err = s.Begin(ctx, "k1", "fp")
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+	assert.Equal(t, 201, saved.Status)
+	assert.JSONEq(t, `{"short_url":"x"}`, string(saved.Body))
+
+	// 超过保留时间后键可以重新使用
+	now = now.Add(TTL)
+	saved, err = s.Begin(ctx, "k1", "other")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+
+	// 释放后键可以立即重新使用
+	require.NoError(t, s.Release(ctx, "k1"))
+	saved, err = s.Begin(ctx, "k1", "fp")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+
+	// 处理中的占位记录在实例崩溃后自动失效
+	now = now.Add(pendingTTL)
+	saved, err = s.Begin(ctx, "k1", "fp")
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+}
@@ -0,0 +1,101 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore 基于 Redis 的实现，多个实例共享幂等记录
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisStore 创建 Redis 存储
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+// SetNX 使用 SET NX GET 原子地写入或读取现有值，需要 Redis 7.0 及以上
+func (s *RedisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, error) {
+	existing, err := s.rdb.SetArgs(ctx, key, value, redis.SetArgs{Mode: "NX", TTL: ttl, Get: true}).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return existing, err
+}
+
+// Set 覆盖写入
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+// Del 删除键
+func (s *RedisStore) Del(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, key).Err()
+}
+
+// MemoryStore 是 Redis 不可用时的进程内实现
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	value    []byte
+	expireAt time.Time
+}
+
+// NewMemoryStore 创建进程内存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// SetNX 在键不存在或已过期时写入
+func (s *MemoryStore) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expireAt) {
+		return e.value, nil
+	}
+	s.sweep(now)
+	s.entries[key] = memoryEntry{value: value, expireAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// Set 覆盖写入
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	s.entries[key] = memoryEntry{value: value, expireAt: now.Add(ttl)}
+	return nil
+}
+
+// Del 删除键
+func (s *MemoryStore) Del(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep 每分钟清理一次已过期的条目，调用方需持有锁
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expireAt) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package loginguard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestGuard(opts Options) (*Guard, *time.Time) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	return NewWithStore(store, opts, zap.NewNop().Sugar()), &now
+}
+
+func TestGuard_LocksUsernameWithExponentialBackoff(t *testing.T) {
+	g, now := newTestGuard(Options{MaxAttempts: 3, IPMaxAttempts: 100, BaseLockout: time.Minute, MaxLockout: 3 * time.Minute})
+	ctx := context.Background()
+	a := Attempt{Username: "alice", IP: "10.0.0.1"}
+
+	assert.Zero(t, g.Fail(ctx, a))
+	assert.Zero(t, g.Fail(ctx, a))
+	assert.Equal(t, time.Minute, g.Fail(ctx, a))
+	assert.Equal(t, time.Minute, g.Check(ctx, a))
+
+	// 改变大小写或换一个 IP 都不能绕过用户名锁定
+	assert.Equal(t, time.Minute, g.Check(ctx, Attempt{Username: "ALICE", IP: "10.0.0.2"}))
+
+	// 第二次被锁定时时长翻倍，之后不超过上限
+	*now = now.Add(time.Minute)
+	assert.Zero(t, g.Check(ctx, a))
+	g.Fail(ctx, a)
+	g.Fail(ctx, a)
+	assert.Equal(t, 2*time.Minute, g.Fail(ctx, a))
+
+	*now = now.Add(2 * time.Minute)
+	g.Fail(ctx, a)
+	g.Fail(ctx, a)
+	assert.Equal(t, 3*time.Minute, g.Fail(ctx, a))
+
+	// 管理员解锁后立即可以登录，锁定级别也被重置
+	assert.NoError(t, g.Unlock(ctx, "Alice"))
+	assert.Zero(t, g.Check(ctx, a))
+	g.Fail(ctx, a)
+	g.Fail(ctx, a)
+	assert.Equal(t, time.Minute, g.Fail(ctx, a))
+}
+
+func TestGuard_LocksIPAcrossUsernames(t *testing.T) {
+	g, _ := newTestGuard(Options{MaxAttempts: 100, IPMaxAttempts: 3, BaseLockout: time.Minute})
+	ctx := context.Background()
+
+	g.Fail(ctx, Attempt{Username: "a", IP: "10.0.0.1"})
+	g.Fail(ctx, Attempt{Username: "b", IP: "10.0.0.1"})
+	// 登录成功不会清除 IP 的失败次数
+	g.Succeed(ctx, Attempt{Username: "mine", IP: "10.0.0.1"})
+	assert.Equal(t, time.Minute, g.Fail(ctx, Attempt{Username: "c", IP: "10.0.0.1"}))
+
+	assert.Equal(t, time.Minute, g.Check(ctx, Attempt{Username: "d", IP: "10.0.0.1"}))
+	assert.Zero(t, g.Check(ctx, Attempt{Username: "d", IP: "10.0.0.2"}))
+
+	// 解锁用户名不影响 IP 锁定，需要单独解锁 IP
+	assert.NoError(t, g.Unlock(ctx, "d"))
+	assert.Equal(t, time.Minute, g.Check(ctx, Attempt{Username: "d", IP: "10.0.0.1"}))
+	assert.NoError(t, g.UnlockIP(ctx, "10.0.0.1"))
+	assert.Zero(t, g.Check(ctx, Attempt{Username: "d", IP: "10.0.0.1"}))
+}
+
+func TestGuard_SucceedResetsUserFailures(t *testing.T) {
+	g, now := newTestGuard(Options{MaxAttempts: 2, IPMaxAttempts: 100})
+	ctx := context.Background()
+	a := Attempt{Username: "bob", IP: "10.0.0.1"}
+
+	g.Fail(ctx, a)
+	g.Succeed(ctx, a)
+	assert.Zero(t, g.Fail(ctx, a))
+
+	// 失败次数在统计窗口结束后过期
+	*now = now.Add(16 * time.Minute)
+	assert.Zero(t, g.Fail(ctx, a))
+}
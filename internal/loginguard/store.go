@@ -0,0 +1,198 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Store 保存登录失败计数和锁定状态，所有键都带有过期时间
+type Store interface {
+	// Incr 将计数加一并返回新值，键不存在时创建并设置过期时间
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Lock 设置锁定键，ttl 即锁定时长
+	Lock(ctx context.Context, key string, ttl time.Duration) error
+	// TTL 返回键的剩余时间，键不存在时返回 0
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Del 删除键
+	Del(ctx context.Context, keys ...string) error
+}
+
+// RedisStore 基于 Redis 的实现，多个实例共享失败计数
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisStore 创建 Redis 存储
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+// incrScript 原子地执行 INCR，键没有过期时间时（即刚创建）才设置过期时间。
+// 与 EXPIRE NX 效果相同，但不要求 Redis 7。ARGV[1] 为过期时间，单位毫秒
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// Incr 执行 INCR，并只在首次创建时设置过期时间，保证计数窗口不会被后续失败延长
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.rdb, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+// Lock 设置锁定键
+func (s *RedisStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	return s.rdb.Set(ctx, key, 1, ttl).Err()
+}
+
+// TTL 返回键的剩余时间
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.rdb.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Del 删除键
+func (s *RedisStore) Del(ctx context.Context, keys ...string) error {
+	return s.rdb.Del(ctx, keys...).Err()
+}
+
+// MemoryStore 是 Redis 不可用时的进程内实现
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+// NewMemoryStore 创建进程内存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// get 返回未过期的条目，调用方需持有锁
+func (s *MemoryStore) get(key string) (memoryEntry, bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return e, false
+	}
+	if !s.now().Before(e.expireAt) {
+		delete(s.entries, key)
+		return e, false
+	}
+	return e, true
+}
+
+// Incr 将计数加一
+func (s *MemoryStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.get(key)
+	if !ok {
+		e = memoryEntry{expireAt: s.now().Add(ttl)}
+	}
+	e.value++
+	s.entries[key] = e
+	return e.value, nil
+}
+
+// Lock 设置锁定键
+func (s *MemoryStore) Lock(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{value: 1, expireAt: s.now().Add(ttl)}
+	return nil
+}
+
+// TTL 返回键的剩余时间
+func (s *MemoryStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.get(key)
+	if !ok {
+		return 0, nil
+	}
+	return e.expireAt.Sub(s.now()), nil
+}
+
+// Del 删除键
+func (s *MemoryStore) Del(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// FallbackStore 优先使用 Redis，Redis 出错时降级到进程内存储，避免 Redis 故障时失去暴力破解防护
+type FallbackStore struct {
+	primary  Store
+	fallback Store
+	logger   *zap.SugaredLogger
+
+	mu         sync.Mutex
+	lastWarned time.Time
+}
+
+// Incr 将计数加一
+func (s *FallbackStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, err := s.primary.Incr(ctx, key, ttl)
+	if err == nil {
+		return n, nil
+	}
+	s.warn(err)
+	return s.fallback.Incr(ctx, key, ttl)
+}
+
+// Lock 设置锁定键
+func (s *FallbackStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	if err := s.primary.Lock(ctx, key, ttl); err != nil {
+		s.warn(err)
+		return s.fallback.Lock(ctx, key, ttl)
+	}
+	return nil
+}
+
+// TTL 返回两个存储中较长的剩余时间，Redis 恢复后降级期间产生的锁定仍然有效
+func (s *FallbackStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	local, _ := s.fallback.TTL(ctx, key)
+	ttl, err := s.primary.TTL(ctx, key)
+	if err != nil {
+		s.warn(err)
+		return local, nil
+	}
+	return max(ttl, local), nil
+}
+
+// Del 同时从两个存储中删除键
+func (s *FallbackStore) Del(ctx context.Context, keys ...string) error {
+	_ = s.fallback.Del(ctx, keys...)
+	return s.primary.Del(ctx, keys...)
+}
+
+// warn 每分钟最多记录一次降级日志
+func (s *FallbackStore) warn(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastWarned) < time.Minute {
+		return
+	}
+	s.lastWarned = time.Now()
+	s.logger.Warnf("Redis 登录失败计数出错，降级为进程内存储: %v", err)
+}
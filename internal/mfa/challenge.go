@@ -0,0 +1,123 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ChallengeTTL 密码验证通过后完成第二步验证的时限
+const ChallengeTTL = 5 * time.Minute
+
+// ErrChallengeExpired 登录凭据不存在或已过期
+var ErrChallengeExpired = errors.New("验证已过期，请重新登录")
+
+// BeginChallenge 密码验证通过后生成一个临时凭据，客户端提交验证码时携带，只能使用一次
+func (s *Service) BeginChallenge(ctx context.Context, userID uint) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	if err := s.challenges.set(ctx, challengeKey(token), userID, ChallengeTTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ChallengeUser 返回临时凭据对应的用户
+func (s *Service) ChallengeUser(ctx context.Context, token string) (uint, error) {
+	if token == "" {
+		return 0, ErrChallengeExpired
+	}
+	return s.challenges.get(ctx, challengeKey(token))
+}
+
+// EndChallenge 第二步验证通过后作废临时凭据
+func (s *Service) EndChallenge(ctx context.Context, token string) {
+	s.challenges.del(ctx, challengeKey(token))
+}
+
+// challengeKey 只保存凭据的摘要
+func challengeKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "mfa:challenge:" + hex.EncodeToString(sum[:])
+}
+
+// challengeStore 保存登录凭据。总是写入进程内存，Redis 可用时同时写入 Redis，
+// 这样负载均衡把第二步请求转发到其他实例时也能找到凭据
+type challengeStore struct {
+	rdb *redis.Client
+
+	mu      sync.Mutex
+	entries map[string]challengeEntry
+	now     func() time.Time
+}
+
+type challengeEntry struct {
+	userID   uint
+	expireAt time.Time
+}
+
+func newChallengeStore(rdb *redis.Client) *challengeStore {
+	return &challengeStore{rdb: rdb, entries: make(map[string]challengeEntry), now: time.Now}
+}
+
+func (c *challengeStore) set(ctx context.Context, key string, userID uint, ttl time.Duration) error {
+	c.mu.Lock()
+	now := c.now()
+	for k, e := range c.entries {
+		if !now.Before(e.expireAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = challengeEntry{userID: userID, expireAt: now.Add(ttl)}
+	c.mu.Unlock()
+
+	if c.rdb == nil {
+		return nil
+	}
+	return c.rdb.Set(ctx, key, userID, ttl).Err()
+}
+
+func (c *challengeStore) get(ctx context.Context, key string) (uint, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(e.expireAt) {
+		return e.userID, nil
+	}
+
+	if c.rdb == nil {
+		return 0, ErrChallengeExpired
+	}
+	val, err := c.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrChallengeExpired
+	}
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, ErrChallengeExpired
+	}
+	return uint(id), nil
+}
+
+func (c *challengeStore) del(ctx context.Context, key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	if c.rdb != nil {
+		c.rdb.Del(ctx, key)
+	}
+}
@@ -0,0 +1,237 @@
+// Package mfa 实现基于 TOTP 的两步验证：绑定验证器、校验验证码和一次性恢复码，
+// 以及登录时密码验证通过后等待第二步验证的临时凭据。
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"shorturl-platform/internal/model"
+	auth "shorturl-platform/pkg/jwt"
+	"shorturl-platform/pkg/totp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeCount 每次生成的恢复码数量
+const RecoveryCodeCount = 10
+
+var (
+	// ErrAlreadyEnabled 两步验证已经启用
+	ErrAlreadyEnabled = errors.New("两步验证已启用")
+	// ErrNotEnabled 两步验证未启用
+	ErrNotEnabled = errors.New("两步验证未启用")
+	// ErrSetupRequired 还没有生成密钥
+	ErrSetupRequired = errors.New("请先获取两步验证密钥")
+	// ErrInvalidCode 验证码或恢复码错误，或者验证码已经使用过
+	ErrInvalidCode = errors.New("验证码错误")
+)
+
+// Enrollment 绑定验证器所需的信息
+type Enrollment struct {
+	Secret string
+	URI    string // otpauth:// 地址，前端据此生成二维码
+}
+
+// Service 两步验证服务
+type Service struct {
+	db         *gorm.DB
+	challenges *challengeStore
+	issuer     string
+	logger     *zap.SugaredLogger
+	now        func() time.Time
+}
+
+// NewService 创建两步验证服务，issuer 显示在验证器应用中。rdb 为 nil 时登录凭据只在当前实例内有效
+func NewService(db *gorm.DB, rdb *redis.Client, issuer string, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		db:         db,
+		challenges: newChallengeStore(rdb),
+		issuer:     issuer,
+		logger:     logger.Named("mfa"),
+		now:        time.Now,
+	}
+}
+
+// Setup 为用户生成新的密钥，需要调用 Enable 确认验证码后才会生效。已有未确认的密钥时会被替换
+func (s *Service) Setup(ctx context.Context, user *model.User) (Enrollment, error) {
+	if user.TOTPEnabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	err = s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", user.ID).
+		Updates(map[string]any{"totp_secret": secret, "totp_last_step": 0}).Error
+	if err != nil {
+		return Enrollment{}, err
+	}
+	user.TOTPSecret, user.TOTPLastStep = secret, 0
+	return Enrollment{Secret: secret, URI: totp.URI(s.issuer, user.Username, secret)}, nil
+}
+
+// Enable 校验验证器生成的验证码并启用两步验证，返回新生成的恢复码明文
+func (s *Service) Enable(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrSetupRequired
+	}
+	step, ok := totp.Validate(user.TOTPSecret, code, s.now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", user.ID).
+			Updates(map[string]any{"totp_enabled": true, "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled, user.TOTPLastStep = true, step
+	s.logger.Infow("用户已启用两步验证", "user_id", user.ID, "username", user.Username)
+	return codes, nil
+}
+
+// Disable 校验验证码或恢复码后关闭两步验证，同时删除密钥和所有恢复码
+func (s *Service) Disable(ctx context.Context, user *model.User, code string) error {
+	if _, err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", user.ID).
+			Updates(map[string]any{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	user.TOTPEnabled, user.TOTPSecret, user.TOTPLastStep = false, "", 0
+	s.logger.Infow("用户已关闭两步验证", "user_id", user.ID, "username", user.Username)
+	return nil
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，之前的恢复码全部作废
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if _, err := s.Verify(ctx, user, code); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// RemainingRecoveryCodes 返回用户未使用的恢复码数量
+func (s *Service) RemainingRecoveryCodes(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// Verify 校验 6 位验证码或恢复码，返回本次验证对应的登录方式 (amr)。
+// 验证码通过后记录时间步，同一个验证码不能再次使用；恢复码使用后即失效
+func (s *Service) Verify(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrNotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(user.TOTPSecret, code, s.now())
+		if !ok {
+			return nil, ErrInvalidCode
+		}
+		// 条件更新保证并发请求中同一个验证码只能通过一次
+		result := s.db.WithContext(ctx).Model(&model.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrInvalidCode
+		}
+		user.TOTPLastStep = step
+		return []string{auth.AMROTP, auth.AMRMFA}, nil
+	}
+
+	result := s.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", s.now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidCode
+	}
+	s.logger.Infow("用户使用了恢复码", "user_id", user.ID, "username", user.Username)
+	return []string{auth.AMRMFA}, nil
+}
+
+// replaceRecoveryCodes 删除用户的旧恢复码并生成一组新的，返回明文
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]model.RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = model.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// recoveryAlphabet 去掉了容易混淆的 0/o、1/l/i
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// newRecoveryCode 生成 xxxxx-xxxxx 格式的恢复码
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = recoveryAlphabet[n.Int64()]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// hashRecoveryCode 计算恢复码的摘要，忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
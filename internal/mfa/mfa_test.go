@@ -0,0 +1,100 @@
+package mfa
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	auth "shorturl-platform/pkg/jwt"
+	"shorturl-platform/pkg/totp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T) (*Service, *model.User, *time.Time) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RecoveryCode{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	user := &model.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x", Role: "user", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	now := time.Unix(1700000000, 0)
+	s := NewService(db, nil, "Short URL", zap.NewNop().Sugar())
+	s.now = func() time.Time { return now }
+	return s, user, &now
+}
+
+func TestService_EnrollAndVerify(t *testing.T) {
+	s, user, now := setupService(t)
+	ctx := context.Background()
+
+	enrollment, err := s.Setup(ctx, user)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Short%20URL:alice?")
+
+	_, err = s.Enable(ctx, user, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	code, _ := totp.Code(enrollment.Secret, totp.Step(*now))
+	recovery, err := s.Enable(ctx, user, code)
+	require.NoError(t, err)
+	assert.Len(t, recovery, RecoveryCodeCount)
+	_, err = s.Setup(ctx, user)
+	assert.ErrorIs(t, err, ErrAlreadyEnabled)
+
+	// 启用时使用过的验证码不能再用于登录
+	_, err = s.Verify(ctx, user, code)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	*now = now.Add(totp.Period)
+	code, _ = totp.Code(enrollment.Secret, totp.Step(*now))
+	amr, err := s.Verify(ctx, user, code)
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.AMROTP, auth.AMRMFA}, amr)
+
+	// 恢复码不区分大小写，只能使用一次
+	amr, err = s.Verify(ctx, user, " "+recovery[0]+" ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.AMRMFA}, amr)
+	_, err = s.Verify(ctx, user, recovery[0])
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	remaining, err := s.RemainingRecoveryCodes(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(RecoveryCodeCount-1), remaining)
+
+	require.NoError(t, s.Disable(ctx, user, recovery[1]))
+	assert.False(t, user.TOTPEnabled)
+	remaining, _ = s.RemainingRecoveryCodes(ctx, user.ID)
+	assert.Zero(t, remaining)
+	_, err = s.Verify(ctx, user, code)
+	assert.ErrorIs(t, err, ErrNotEnabled)
+}
+
+func TestService_Challenge(t *testing.T) {
+	s, user, _ := setupService(t)
+	ctx := context.Background()
+
+	token, err := s.BeginChallenge(ctx, user.ID)
+	require.NoError(t, err)
+	userID, err := s.ChallengeUser(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	s.EndChallenge(ctx, token)
+	_, err = s.ChallengeUser(ctx, token)
+	assert.ErrorIs(t, err, ErrChallengeExpired)
+
+	token, _ = s.BeginChallenge(ctx, user.ID)
+	s.challenges.now = func() time.Time { return time.Now().Add(ChallengeTTL) }
+	_, err = s.ChallengeUser(ctx, token)
+	assert.ErrorIs(t, err, ErrChallengeExpired)
+}
@@ -1,15 +1,24 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"shorturl-platform/internal/apikey"
+	"shorturl-platform/internal/session"
 	auth "shorturl-platform/pkg/jwt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-// AuthMiddleware JWT认证中间件
-func AuthMiddleware(jwtManager *auth.TokenManager) gin.HandlerFunc {
+// AuthMiddleware 认证中间件，支持 JWT 和个人 API 密钥（Authorization: Bearer sk_... 或 X-API-Key）。
+// 已撤销的 JWT（登出或会话被撤销）会立即被拒绝；使用 API 密钥时会在上下文中写入 scopes，由 RequireScope 校验。
+// requireAdminMFA 为 true 时，管理员只有使用通过两步验证的会话访问才拥有管理员权限，否则按普通用户处理。
+func AuthMiddleware(jwtManager *auth.TokenManager, denylist *session.Denylist, apiKeys *apikey.Service, requireAdminMFA bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 跳过认证的路由
 		if shouldSkipAuth(c.Request.URL.Path) {
@@ -17,6 +26,11 @@ func AuthMiddleware(jwtManager *auth.TokenManager) gin.HandlerFunc {
 			return
 		}
 
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, apiKeys, key, requireAdminMFA)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少认证令牌"})
@@ -32,6 +46,11 @@ func AuthMiddleware(jwtManager *auth.TokenManager) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(parts[1], apikey.KeyPrefix) {
+			authenticateAPIKey(c, apiKeys, parts[1], requireAdminMFA)
+			return
+		}
+
 		tokenString := parts[1]
 		claims, err := jwtManager.ValidateToken(tokenString)
 		if err != nil {
@@ -40,11 +59,116 @@ func AuthMiddleware(jwtManager *auth.TokenManager) gin.HandlerFunc {
 			return
 		}
 
+		// 撤销列表查询出错时放行，令牌仍会在短时间后自然过期
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 500*time.Millisecond)
+		revoked, _ := denylist.IsRevoked(ctx, claims.ID, claims.SessionID)
+		cancel()
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "认证令牌已被撤销"})
+			c.Abort()
+			return
+		}
+
+		// 必须修改密码的用户只能查看自己的信息、修改密码或退出登录
+		if claims.PasswordChange && !slices.Contains(passwordChangePaths, c.Request.URL.Path) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "请先修改初始密码", "password_change_required": true})
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存入上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		setRole(c, claims.Role, requireAdminMFA && !claims.HasMFA())
+		c.Set("claims", claims)
+
+		c.Next()
+	}
+}
+
+// passwordChangePaths 是必须修改密码的用户仍然可以访问的路由
+var passwordChangePaths = []string{"/api/me", "/api/me/password", "/auth/logout"}
+
+// authenticateAPIKey 使用 API 密钥认证，密钥只拥有创建时授予的权限范围。
+// API 密钥不经过两步验证，要求管理员两步验证时不会获得管理员权限；
+// 用户必须修改密码时（例如管理员重置了密码）拒绝使用 API 密钥，修改密码后恢复
+func authenticateAPIKey(c *gin.Context, apiKeys *apikey.Service, key string, requireAdminMFA bool) {
+	record, user, err := apiKeys.Authenticate(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		if !errors.Is(err, apikey.ErrInvalidKey) {
+			zap.S().Errorf("校验 API 密钥失败: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的 API 密钥"})
+		c.Abort()
+		return
+	}
+	if user.MustChangePassword {
+		c.JSON(http.StatusForbidden, gin.H{"error": "请先修改密码后再使用 API 密钥", "password_change_required": true})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	setRole(c, user.Role, requireAdminMFA)
+	c.Set("api_key_id", record.ID)
+	c.Set("scopes", record.ScopeList())
+
+	c.Next()
+}
+
+// setRole 写入用户角色，缺少两步验证的管理员降级为普通用户，并记录原因供 AdminMiddleware 提示
+func setRole(c *gin.Context, role string, missingMFA bool) {
+	if role == "admin" && missingMFA {
+		c.Set("role", "user")
+		c.Set("admin_mfa_required", true)
+		return
+	}
+	c.Set("role", role)
+}
+
+// RequireScope 要求 API 密钥拥有指定的权限范围，JWT 登录的请求不受限制
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, ok := c.Get("scopes"); ok && !slices.Contains(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API 密钥缺少权限: " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly 拒绝使用 API 密钥的请求，用于密钥管理和管理员接口，避免泄露的密钥被用来扩大权限
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该接口不支持使用 API 密钥访问，请登录后操作"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
 
+// RequireVerifiedEmail 要求当前用户已经验证邮箱，isVerified 查询用户的验证状态，
+// 用于配置 auth.require_verified_email 开启时限制未验证的用户创建短链接
+func RequireVerifiedEmail(isVerified func(ctx context.Context, userID uint) (bool, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("user_id")
+		id, _ := userID.(uint)
+		verified, err := isVerified(c.Request.Context(), id)
+		if err != nil {
+			zap.S().Errorf("查询邮箱验证状态失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "请先验证邮箱"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -52,6 +176,11 @@ func AuthMiddleware(jwtManager *auth.TokenManager) gin.HandlerFunc {
 // AdminMiddleware 管理员权限中间件
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if c.GetBool("admin_mfa_required") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "管理员账户需要启用两步验证并重新登录"})
+			c.Abort()
+			return
+		}
 		role, exists := c.Get("role")
 		if !exists || role != "admin" {
 			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"shorturl-platform/internal/apikey"
+	"shorturl-platform/internal/model"
+	"shorturl-platform/internal/session"
+	auth "shorturl-platform/pkg/jwt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthMiddleware_APIKeyScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:middleware_auth_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.APIKey{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	user := &model.User{Username: "ci", Email: "ci@example.com", Role: "user", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+	apiKeys := apikey.NewService(db, zap.NewNop().Sugar())
+	key, _, err := apiKeys.Create(context.Background(), user.ID, "ci", []string{apikey.ScopeLinksWrite}, nil)
+	require.NoError(t, err)
+
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	router := gin.New()
+	api := router.Group("/api", AuthMiddleware(tokens, session.NewDenylist(nil), apiKeys, false))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.POST("/shorten", RequireScope(apikey.ScopeLinksWrite), ok)
+	api.GET("/stats", RequireScope(apikey.ScopeStatsRead), ok)
+	api.GET("/keys", SessionOnly(), ok)
+
+	do := func(method, path string, header http.Header) int {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header = header
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	bearer := http.Header{"Authorization": {"Bearer " + key}}
+	xAPIKey := http.Header{"X-Api-Key": {key}}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/shorten", bearer))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/shorten", xAPIKey))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/stats", xAPIKey), "缺少 stats:read 权限")
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/keys", xAPIKey), "API 密钥不能管理密钥")
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/shorten", http.Header{"X-Api-Key": {"sk_invalid"}}))
+
+	// 必须修改密码时（例如管理员重置密码后）API 密钥暂不可用
+	require.NoError(t, db.Model(user).Update("must_change_password", true).Error)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/shorten", xAPIKey))
+	require.NoError(t, db.Model(user).Update("must_change_password", false).Error)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/shorten", xAPIKey))
+
+	// JWT 登录的请求不受权限范围限制
+	token, err := tokens.GenerateToken(user.ID, user.Username, user.Role, "", nil)
+	require.NoError(t, err)
+	session := http.Header{"Authorization": {"Bearer " + token}}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/stats", session))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/keys", session))
+}
+
+func TestAuthMiddleware_RequireAdminMFA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	router := gin.New()
+	api := router.Group("/api", AuthMiddleware(tokens, session.NewDenylist(nil), nil, true))
+	api.GET("/me", func(c *gin.Context) { c.String(http.StatusOK, c.GetString("role")) })
+	api.GET("/admin/users", AdminMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(path string, amr []string) *httptest.ResponseRecorder {
+		token, err := tokens.GenerateToken(1, "admin", "admin", "", amr)
+		require.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 只用密码登录的管理员按普通用户处理，仍然可以访问自己的资源以完成两步验证绑定
+	password := []string{auth.AMRPassword}
+	assert.Equal(t, "user", do("/api/me", password).Body.String())
+	w := do("/api/admin/users", password)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "两步验证")
+
+	mfa := []string{auth.AMRPassword, auth.AMROTP, auth.AMRMFA}
+	assert.Equal(t, "admin", do("/api/me", mfa).Body.String())
+	assert.Equal(t, http.StatusOK, do("/api/admin/users", mfa).Code)
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verified := map[uint]bool{1: true}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("X-User") == "1" {
+			c.Set("user_id", uint(1))
+		} else {
+			c.Set("user_id", uint(2))
+		}
+	})
+	router.POST("/api/shorten", RequireVerifiedEmail(func(_ context.Context, userID uint) (bool, error) {
+		return verified[userID], nil
+	}), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	req.Header.Set("X-User", "1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthMiddleware_PasswordChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := auth.NewManager("test-secret", "test", time.Minute)
+	router := gin.New()
+	api := router.Group("/api", AuthMiddleware(tokens, session.NewDenylist(nil), nil, false))
+	api.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/me/password", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/shorten", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	token, err := tokens.Sign(auth.Claims{UserID: 1, Username: "admin", Role: "admin", PasswordChange: true})
+	require.NoError(t, err)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/me").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/me/password").Code)
+	w := do(http.MethodPost, "/api/shorten")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "password_change_required")
+}
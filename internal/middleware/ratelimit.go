@@ -1,27 +1,48 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
 	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/ratelimit"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
-	"golang.org/x/time/rate"
 )
 
-// RateLimit 全局限流中间件
-func RateLimit(redisClient *redis.Client, limitConfig *config.Limit) gin.HandlerFunc {
+// RateLimit 按命名策略限流的中间件，按客户端分别计数：已认证的请求按 user_id，匿名请求按客户端 IP。
+// 需要按用户限流的路由组应在 AuthMiddleware 之后注册本中间件。
+// 响应中会带上 X-RateLimit-Limit、X-RateLimit-Remaining、X-RateLimit-Reset，被拒绝时还有 Retry-After。
+func RateLimit(limiter ratelimit.Limiter, limitConfig *config.Limit, policyName string) gin.HandlerFunc {
 	if !limitConfig.Enabled {
 		return func(c *gin.Context) {
 			c.Next()
 		}
 	}
 
-	// 基于内存的限流器
-	limiter := rate.NewLimiter(rate.Limit(limitConfig.Requests), int(limitConfig.Burst))
-	var mu sync.Mutex
+	cfgPolicy := limitConfig.Policy(policyName)
+	window, err := cfgPolicy.WindowDuration()
+	if err != nil {
+		// config.Load 已校验过命名策略，这里只会在默认策略上出现
+		window = time.Minute
+	}
+	policy := ratelimit.Policy{
+		Name:   policyName,
+		Limit:  cfgPolicy.Requests,
+		Period: window,
+		Burst:  cfgPolicy.Burst,
+	}
+	burst := policy.Burst
+	if burst <= 0 {
+		burst = policy.Limit
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d;burst=%d", policy.Limit, int64(window.Seconds()), burst)
+	// X-RateLimit-Limit 是窗口内允许的请求数，与 X-RateLimit-Policy 一致，瞬时容量见其中的 burst
+	limitHeader := strconv.FormatInt(policy.Limit, 10)
 
 	return func(c *gin.Context) {
 		// 跳过特定路径
@@ -32,10 +53,21 @@ func RateLimit(redisClient *redis.Client, limitConfig *config.Limit) gin.Handler
 			}
 		}
 
-		mu.Lock()
-		defer mu.Unlock()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 500*time.Millisecond)
+		result, err := limiter.Allow(ctx, policy.Name+":"+clientKey(c), policy)
+		cancel()
+		// 限流器本身出错时放行，避免限流故障导致整个服务不可用
+		if err != nil {
+			c.Next()
+			return
+		}
 
-		if !limiter.Allow() {
+		c.Header("X-RateLimit-Policy", policyHeader)
+		c.Header("X-RateLimit-Limit", limitHeader)
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.ResetAfter), 10))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.FormatInt(max(ceilSeconds(result.RetryAfter), 1), 10))
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "请求过于频繁，请稍后再试",
 			})
@@ -46,3 +78,16 @@ func RateLimit(redisClient *redis.Client, limitConfig *config.Limit) gin.Handler
 		c.Next()
 	}
 }
+
+// clientKey 返回限流使用的客户端标识
+func clientKey(c *gin.Context) string {
+	if userID, exists := c.Get("user_id"); exists {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds 将时长向上取整为秒
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
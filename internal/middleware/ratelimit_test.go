@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"shorturl-platform/internal/config"
+	"shorturl-platform/internal/ratelimit"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit_PolicyAndHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limitConfig := &config.Limit{
+		Enabled:  true,
+		Requests: 1000,
+		Policies: map[string]config.LimitPolicy{
+			"auth_login": {Requests: 2, Window: "1h"},
+		},
+	}
+
+	router := gin.New()
+	router.POST("/auth/login", RateLimit(ratelimit.NewMemoryLimiter(), limitConfig, "auth_login"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	login := func(ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := login("10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1800", w.Header().Get("X-RateLimit-Reset"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, login("10.0.0.1").Code)
+
+	// 每小时 2 次的配额用完后，需要等待半小时才能恢复一次
+	w = login("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1800", w.Header().Get("Retry-After"))
+
+	// 其他客户端不受影响
+	assert.Equal(t, http.StatusOK, login("10.0.0.2").Code)
+}
+
+func TestRateLimit_LimitHeaderUsesPolicyRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limitConfig := &config.Limit{
+		Enabled:  true,
+		Requests: 1000,
+		Policies: map[string]config.LimitPolicy{
+			"api": {Requests: 10, Window: "1m", Burst: 3},
+		},
+	}
+	router := gin.New()
+	router.GET("/api/links", RateLimit(ratelimit.NewMemoryLimiter(), limitConfig, "api"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/links", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// 配置了 burst 时 X-RateLimit-Limit 仍是窗口内的请求数，而不是瞬时容量
+	assert.Equal(t, "10", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "10;w=60;burst=3", w.Header().Get("X-RateLimit-Policy"))
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Remaining"))
+}
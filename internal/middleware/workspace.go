@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"shorturl-platform/internal/workspace"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// WorkspaceHeader 指定请求所在工作区的请求头，路由中带有 :workspace_id 时以路径为准
+const WorkspaceHeader = "X-Workspace-ID"
+
+// WorkspaceScope 解析请求所在的工作区，并在上下文中写入 workspace_id 和 workspace_role。
+// 没有指定工作区时为用户的个人空间（workspace_id 为 0），用户在个人空间中是所有者；
+// 管理员在任何工作区中都视为所有者；用户不是工作区成员时返回 404，不暴露工作区是否存在
+func WorkspaceScope(workspaces *workspace.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, fromPath := c.Param("workspace_id"), true
+		if raw == "" {
+			raw, fromPath = c.GetHeader(WorkspaceHeader), false
+		}
+		var id uint64
+		if raw != "" {
+			var err error
+			id, err = strconv.ParseUint(raw, 10, 64)
+			if err != nil || (fromPath && id == 0) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的工作区 ID"})
+				c.Abort()
+				return
+			}
+		}
+		if id == 0 {
+			c.Set("workspace_id", uint(0))
+			c.Set("workspace_role", workspace.RoleOwner)
+			c.Next()
+			return
+		}
+
+		role, err := workspaceRole(c, workspaces, uint(id))
+		if errors.Is(err, workspace.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "工作区不存在"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			zap.S().Errorf("查询工作区成员失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
+			c.Abort()
+			return
+		}
+		c.Set("workspace_id", uint(id))
+		c.Set("workspace_role", role)
+		c.Next()
+	}
+}
+
+// workspaceRole 返回当前用户在工作区中的角色，管理员视为所有者
+func workspaceRole(c *gin.Context, workspaces *workspace.Service, id uint) (string, error) {
+	if c.GetString("role") == "admin" {
+		exists, err := workspaces.Exists(c.Request.Context(), id)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", workspace.ErrNotFound
+		}
+		return workspace.RoleOwner, nil
+	}
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uint)
+	return workspaces.Role(c.Request.Context(), id, uid)
+}
+
+// RequireWorkspaceRole 要求当前用户在 WorkspaceScope 解析出的工作区中至少拥有指定角色
+func RequireWorkspaceRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !workspace.Allows(c.GetString("workspace_role"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要工作区 " + role + " 权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
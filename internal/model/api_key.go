@@ -0,0 +1,39 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey 用户创建的个人 API 密钥，只保存密钥的 SHA-256 摘要，明文只在创建时返回一次
+type APIKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"` // 密钥的前几位，便于用户辨认
+	KeyHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"size:255;not null" json:"-"` // 以空格分隔的权限范围
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList 返回密钥的权限范围
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// IsUsable 判断密钥当前是否可用
+func (k *APIKey) IsUsable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 )
 
+// ClickRecord 单次点击记录
 type ClickRecord struct {
 	ID          uint      `gorm:"primarykey" json:"id"`
 	ShortLinkID uint      `gorm:"not null;index" json:"short_link_id"`
@@ -12,9 +13,14 @@ type ClickRecord struct {
 	Referer     string    `gorm:"type:text" json:"referer"`
 	Country     string    `gorm:"size:100" json:"country"`
 	City        string    `gorm:"size:100" json:"city"`
-	CreatedAt   time.Time `json:"created_at"`
+	Browser     string    `gorm:"size:50" json:"browser"`
+	OS          string    `gorm:"size:50" json:"os"`
+	DeviceType  string    `gorm:"size:20" json:"device_type"`
+	IsBot       bool      `gorm:"default:false;index" json:"is_bot"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
 }
 
+// TableName 指定表名
 func (ClickRecord) TableName() string {
 	return "click_records"
 }
@@ -0,0 +1,12 @@
+package model
+
+// CodeSequence 短码计数器，基于计数器的短码策略从这里分配编号，每种策略一行
+type CodeSequence struct {
+	Name  string `gorm:"primarykey;size:32"`
+	Value uint64 `gorm:"not null;default:0"` // 已分配的最大编号
+}
+
+// TableName 指定表名
+func (CodeSequence) TableName() string {
+	return "code_sequences"
+}
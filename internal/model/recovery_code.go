@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// RecoveryCode 两步验证的恢复码，每个只能使用一次，只保存 SHA-256 摘要
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// RefreshToken 刷新令牌，只保存令牌的 SHA-256 摘要。
+// 每次刷新都会撤销旧令牌并在同一家族 (FamilyID) 中签发新令牌，
+// 已撤销的令牌再次被使用说明令牌可能被盗用，此时整个家族都会被撤销。
+type RefreshToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	FamilyID   string     `gorm:"size:32;not null;index" json:"family_id"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	IPAddress  string     `gorm:"size:45" json:"ip_address"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	AMR        string     `gorm:"size:64" json:"amr"` // 登录方式，空格分隔，刷新时沿用
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uint      `json:"replaced_by"` // 轮换后签发的新令牌 ID
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
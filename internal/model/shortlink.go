@@ -6,16 +6,32 @@ import (
 
 // ShortLink 短链接模型
 type ShortLink struct {
-	ID          uint      `gorm:"primarykey" json:"id"`
-	ShortCode   string    `gorm:"size:10;uniqueIndex;not null" json:"short_code"`
-	OriginalURL string    `gorm:"type:text;not null" json:"original_url"`
-	ClickCount  int64     `gorm:"default:0" json:"click_count"`
-	IsActive    bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID             uint       `gorm:"primarykey" json:"id"`
+	UserID         uint       `gorm:"index" json:"user_id"`      // 创建者
+	WorkspaceID    uint       `gorm:"index" json:"workspace_id"` // 所属工作区，0 表示创建者的个人空间
+	ShortCode      string     `gorm:"size:32;uniqueIndex;not null" json:"short_code"`
+	OriginalURL    string     `gorm:"type:text;not null" json:"original_url"`
+	ClickCount     int64      `gorm:"default:0" json:"click_count"`
+	UniqueVisitors int64      `gorm:"-" json:"unique_visitors"` // 近似独立访客数，由 HyperLogLog 统计，不落库
+	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	ExpiresAt      *time.Time `gorm:"index" json:"expires_at,omitempty"` // 过期时间，为空表示永不过期
+	MaxClicks      int64      `gorm:"default:0" json:"max_clicks"`       // 点击预算，0 表示不限
+	BudgetUsed     int64      `gorm:"default:0" json:"budget_used"`      // 已使用的点击预算，每次跳转都计入（包括爬虫）
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
 
 // TableName 指定表名
 func (ShortLink) TableName() string {
 	return "short_links"
 }
+
+// IsExpired 判断链接在给定时间是否已过期
+func (l *ShortLink) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// ClicksExhausted 判断链接的点击预算是否已用完
+func (l *ShortLink) ClicksExhausted() bool {
+	return l.MaxClicks > 0 && l.BudgetUsed >= l.MaxClicks
+}
@@ -12,10 +12,22 @@ type User struct {
 	gorm.Model
 	Username     string `gorm:"type:varchar(50);uniqueIndex;not null"`
 	Email        string `gorm:"type:varchar(100);uniqueIndex;not null"`
-	PasswordHash string `gorm:"type:varchar(255);not null"` // GORM 默认会映射到 password_hash
+	PasswordHash string `gorm:"type:varchar(255);not null" json:"-"` // GORM 默认会映射到 password_hash
 	Role         string `gorm:"type:varchar(20);default:'user'"`
 	IsActive     bool   `gorm:"default:true"`
 	LastLogin    *time.Time
+	// 为 true 时用户必须先修改密码才能使用其他功能，用于初始管理员和管理员重置的临时密码
+	MustChangePassword bool `gorm:"default:false"`
+
+	// 邮箱验证：注册时为 false，通过邮件中的链接验证后为 true
+	EmailVerified   bool `gorm:"default:false"`
+	EmailVerifiedAt *time.Time
+
+	// 两步验证：TOTPSecret 在启用前就会写入，确认验证码后 TOTPEnabled 才为 true。
+	// TOTPLastStep 是最近一次通过验证的时间步，用于拒绝重复使用的验证码
+	TOTPSecret   string `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabled  bool   `gorm:"default:false"`
+	TOTPLastStep int64  `gorm:"default:0" json:"-"`
 }
 
 // SetPassword 加密并设置密码
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// UserIdentity 将外部身份提供方 (OIDC) 的账户关联到本地用户，Issuer + Subject 唯一确定一个外部账户
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Issuer    string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
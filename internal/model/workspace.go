@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// Workspace 工作区，团队成员在其中共享短链接
+type Workspace struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	CreatedBy uint      `gorm:"index" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Workspace) TableName() string {
+	return "workspaces"
+}
+
+// WorkspaceMember 工作区成员及其角色：owner、editor 或 viewer
+type WorkspaceMember struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex:idx_workspace_member" json:"workspace_id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_workspace_member;index" json:"user_id"`
+	Role        string    `gorm:"size:20;not null" json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WorkspaceMember) TableName() string {
+	return "workspace_members"
+}
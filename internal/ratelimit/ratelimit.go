@@ -0,0 +1,212 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Policy 描述一个限流策略：每个 Period 内平均允许 Limit 个请求，瞬时最多允许 Burst 个
+type Policy struct {
+	Name   string
+	Limit  int64
+	Period time.Duration
+	Burst  int64
+}
+
+// emission 返回 GCRA 的发射间隔（两个请求之间的平均间隔）
+func (p Policy) emission() time.Duration {
+	if p.Limit <= 0 || p.Period <= 0 {
+		return 0
+	}
+	return p.Period / time.Duration(p.Limit)
+}
+
+// capacity 返回瞬时允许的最大请求数，未配置 Burst 时等于 Limit
+func (p Policy) capacity() int64 {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// Result 是一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Limit      int64         // 瞬时允许的最大请求数
+	Remaining  int64         // 当前还能立即发出的请求数
+	RetryAfter time.Duration // 被拒绝时，需要等待多久才能重试
+	ResetAfter time.Duration // 多久之后配额完全恢复
+}
+
+// Limiter 按 key 进行限流判断
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// New 在 Redis 可用时返回分布式限流器（Redis 故障时降级到进程内限流），否则返回进程内限流器
+func New(rdb *redis.Client, logger *zap.SugaredLogger) Limiter {
+	memory := NewMemoryLimiter()
+	if rdb == nil {
+		return memory
+	}
+	return &FallbackLimiter{
+		primary:  NewRedisLimiter(rdb),
+		fallback: memory,
+		logger:   logger.Named("ratelimit"),
+	}
+}
+
+// gcraScript 在 Redis 中原子地执行 GCRA（通用信元速率算法）。
+// 键中只保存理论到达时间 (TAT)，时间取自 Redis 服务器，避免各实例时钟不一致。
+// ARGV[1] 为发射间隔，ARGV[2] 为容差，单位均为微秒。
+// 返回 {是否允许, 剩余请求数, 重试等待微秒, 完全恢复微秒}。
+var gcraScript = redis.NewScript(`
+local emission = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + emission
+local diff = now - (new_tat - tolerance)
+if diff < 0 then
+  return {0, 0, -diff, tat - now}
+end
+
+local reset_after = new_tat - now
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil(reset_after / 1000))
+return {1, math.floor((tolerance - reset_after) / emission), 0, reset_after}
+`)
+
+// RedisLimiter 基于 Redis Lua 脚本的分布式 GCRA 限流器，多个实例共享同一份配额
+type RedisLimiter struct {
+	rdb *redis.Client
+}
+
+// NewRedisLimiter 创建一个 Redis 限流器
+func NewRedisLimiter(rdb *redis.Client) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb}
+}
+
+// Allow 执行限流脚本
+func (l *RedisLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	emission := policy.emission()
+	if emission <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	capacity := policy.capacity()
+	tolerance := emission * time.Duration(capacity)
+
+	values, err := gcraScript.Run(ctx, l.rdb, []string{"ratelimit:" + key},
+		emission.Microseconds(), tolerance.Microseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      capacity,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
+
+// MemoryLimiter 是进程内的按 key GCRA 限流器，只在当前实例内生效
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter 创建一个进程内限流器
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{tats: make(map[string]time.Time), now: time.Now}
+}
+
+// Allow 执行与 Redis 脚本相同的 GCRA 判断
+func (l *MemoryLimiter) Allow(_ context.Context, key string, policy Policy) (Result, error) {
+	emission := policy.emission()
+	if emission <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	capacity := policy.capacity()
+	tolerance := emission * time.Duration(capacity)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	tat, ok := l.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(emission)
+	diff := now.Sub(newTAT.Add(-tolerance))
+	if diff < 0 {
+		return Result{Allowed: false, Limit: capacity, RetryAfter: -diff, ResetAfter: tat.Sub(now)}, nil
+	}
+
+	l.tats[key] = newTAT
+	resetAfter := newTAT.Sub(now)
+	return Result{
+		Allowed:    true,
+		Limit:      capacity,
+		Remaining:  int64((tolerance - resetAfter) / emission),
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+// sweep 每分钟清理一次配额已完全恢复的 key，避免内存无限增长
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, tat := range l.tats {
+		if tat.Before(now) {
+			delete(l.tats, key)
+		}
+	}
+}
+
+// FallbackLimiter 优先使用 Redis 限流，Redis 出错时降级到进程内限流
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	logger   *zap.SugaredLogger
+
+	mu         sync.Mutex
+	lastWarned time.Time
+}
+
+// Allow 执行限流判断
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	result, err := l.primary.Allow(ctx, key, policy)
+	if err == nil {
+		return result, nil
+	}
+	l.warn(err)
+	return l.fallback.Allow(ctx, key, policy)
+}
+
+// warn 每分钟最多记录一次降级日志
+func (l *FallbackLimiter) warn(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastWarned) < time.Minute {
+		return
+	}
+	l.lastWarned = time.Now()
+	l.logger.Warnf("Redis 限流失败，降级为进程内限流: %v", err)
+}
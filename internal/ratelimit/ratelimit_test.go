@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMemoryLimiter_GCRA(t *testing.T) {
+	l := NewMemoryLimiter()
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+
+	// 每分钟 60 个，瞬时最多 3 个
+	policy := Policy{Name: "test", Limit: 60, Period: time.Minute, Burst: 3}
+	ctx := context.Background()
+
+	for i := int64(2); i >= 0; i-- {
+		res, err := l.Allow(ctx, "ip:1.1.1.1", policy)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+		assert.Equal(t, int64(3), res.Limit)
+	}
+
+	res, _ := l.Allow(ctx, "ip:1.1.1.1", policy)
+	assert.False(t, res.Allowed, "超过突发容量后应被拒绝")
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// 不同的 key 互不影响
+	res, _ = l.Allow(ctx, "ip:2.2.2.2", policy)
+	assert.True(t, res.Allowed)
+
+	// 一个发射间隔之后恢复一个配额
+	now = now.Add(time.Second)
+	res, _ = l.Allow(ctx, "ip:1.1.1.1", policy)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Policy) (Result, error) {
+	return Result{}, errors.New("redis: connection refused")
+}
+
+func TestFallbackLimiter_UsesMemoryWhenRedisFails(t *testing.T) {
+	l := &FallbackLimiter{primary: failingLimiter{}, fallback: NewMemoryLimiter(), logger: zap.NewNop().Sugar()}
+	policy := Policy{Name: "test", Limit: 1, Period: time.Hour, Burst: 1}
+
+	res, err := l.Allow(context.Background(), "user:1", policy)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = l.Allow(context.Background(), "user:1", policy)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Denylist 记录被撤销的访问令牌 (jti) 和会话 (sid)，条目在对应的访问令牌过期后自动失效。
+// 撤销记录总是同时写入进程内存，Redis 可用时再写入 Redis 供其他实例查询。
+type Denylist struct {
+	rdb *redis.Client
+
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewDenylist 创建撤销列表，rdb 为 nil 时只在当前实例内生效
+func NewDenylist(rdb *redis.Client) *Denylist {
+	return &Denylist{rdb: rdb, entries: make(map[string]time.Time), now: time.Now}
+}
+
+// RevokeToken 撤销单个访问令牌
+func (d *Denylist) RevokeToken(ctx context.Context, jti string, ttl time.Duration) error {
+	return d.add(ctx, tokenKey(jti), ttl)
+}
+
+// RevokeSession 撤销一个会话签发的所有访问令牌
+func (d *Denylist) RevokeSession(ctx context.Context, sid string, ttl time.Duration) error {
+	return d.add(ctx, sessionKey(sid), ttl)
+}
+
+// IsRevoked 判断访问令牌或其所属会话是否已被撤销
+func (d *Denylist) IsRevoked(ctx context.Context, jti, sid string) (bool, error) {
+	keys := make([]string, 0, 2)
+	if jti != "" {
+		keys = append(keys, tokenKey(jti))
+	}
+	if sid != "" {
+		keys = append(keys, sessionKey(sid))
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	d.mu.Lock()
+	now := d.now()
+	for _, key := range keys {
+		if expireAt, ok := d.entries[key]; ok && now.Before(expireAt) {
+			d.mu.Unlock()
+			return true, nil
+		}
+	}
+	d.mu.Unlock()
+
+	if d.rdb == nil {
+		return false, nil
+	}
+	n, err := d.rdb.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// add 写入撤销记录
+func (d *Denylist) add(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	d.mu.Lock()
+	now := d.now()
+	d.sweep(now)
+	d.entries[key] = now.Add(ttl)
+	d.mu.Unlock()
+
+	if d.rdb == nil {
+		return nil
+	}
+	return d.rdb.Set(ctx, key, 1, ttl).Err()
+}
+
+// sweep 每分钟清理一次已过期的条目，调用方需持有锁
+func (d *Denylist) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < time.Minute {
+		return
+	}
+	d.lastSweep = now
+	for key, expireAt := range d.entries {
+		if !now.Before(expireAt) {
+			delete(d.entries, key)
+		}
+	}
+}
+
+func tokenKey(jti string) string   { return "jwt:deny:jti:" + jti }
+func sessionKey(sid string) string { return "jwt:deny:sid:" + sid }
@@ -0,0 +1,226 @@
+// Package session 管理登录会话：签发短期访问令牌和可轮换的刷新令牌，并支持服务端撤销。
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"shorturl-platform/internal/model"
+	auth "shorturl-platform/pkg/jwt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在或已过期
+	ErrInvalidRefreshToken = errors.New("无效的刷新令牌")
+	// ErrRefreshTokenReused 已轮换或已撤销的刷新令牌被再次使用，整个会话已被撤销
+	ErrRefreshTokenReused = errors.New("刷新令牌已失效，请重新登录")
+	// ErrUserInactive 用户不存在或已被禁用
+	ErrUserInactive = errors.New("账户已被禁用")
+)
+
+// Client 发起请求的客户端信息，随刷新令牌保存以便审计
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// Pair 一次登录或刷新签发的令牌对
+type Pair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // 访问令牌的有效期，单位秒
+}
+
+// Service 会话服务
+type Service struct {
+	db         *gorm.DB
+	tokens     *auth.TokenManager
+	denylist   *Denylist
+	refreshTTL time.Duration
+	logger     *zap.SugaredLogger
+}
+
+// NewService 创建会话服务
+func NewService(db *gorm.DB, tokens *auth.TokenManager, denylist *Denylist, refreshTTL time.Duration, logger *zap.SugaredLogger) *Service {
+	return &Service{db: db, tokens: tokens, denylist: denylist, refreshTTL: refreshTTL, logger: logger.Named("session")}
+}
+
+// Issue 为用户开启一个新会话，amr 是本次登录使用的认证方式，会写入该会话签发的所有访问令牌
+func (s *Service) Issue(ctx context.Context, user *model.User, client Client, amr []string) (Pair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return Pair{}, err
+	}
+	var pair Pair
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		refresh, _, err := s.createRefreshToken(tx, user.ID, familyID, client, amr)
+		if err != nil {
+			return err
+		}
+		pair, err = s.pair(user, familyID, refresh, amr)
+		return err
+	})
+	return pair, err
+}
+
+// Refresh 使用刷新令牌换取新的令牌对，旧的刷新令牌随即失效
+func (s *Service) Refresh(ctx context.Context, rawToken string, client Client) (Pair, error) {
+	var current model.RefreshToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashToken(rawToken)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Pair{}, ErrInvalidRefreshToken
+		}
+		return Pair{}, err
+	}
+
+	if current.RevokedAt != nil {
+		s.reuseDetected(ctx, current, client)
+		return Pair{}, ErrRefreshTokenReused
+	}
+	if !time.Now().Before(current.ExpiresAt) {
+		return Pair{}, ErrInvalidRefreshToken
+	}
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, current.UserID).Error; err != nil || !user.IsActive {
+		s.revokeFamily(ctx, current.FamilyID)
+		return Pair{}, ErrUserInactive
+	}
+
+	var pair Pair
+	reused := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证并发刷新时只有一个请求能完成轮换
+		result := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		amr := strings.Fields(current.AMR)
+		refresh, next, err := s.createRefreshToken(tx, user.ID, current.FamilyID, client, amr)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&model.RefreshToken{}).Where("id = ?", current.ID).Update("replaced_by", next.ID).Error; err != nil {
+			return err
+		}
+		pair, err = s.pair(&user, current.FamilyID, refresh, amr)
+		return err
+	})
+	if reused {
+		s.reuseDetected(ctx, current, client)
+	}
+	return pair, err
+}
+
+// Logout 结束访问令牌所属的会话：撤销该会话的刷新令牌和已签发的访问令牌
+func (s *Service) Logout(ctx context.Context, claims *auth.Claims) error {
+	if claims.ExpiresAt != nil {
+		if err := s.denylist.RevokeToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time)); err != nil {
+			s.logger.Warnf("写入令牌撤销列表失败: %v", err)
+		}
+	}
+	if claims.SessionID == "" {
+		return nil
+	}
+	return s.revokeFamily(ctx, claims.SessionID)
+}
+
+// RevokeUser 撤销用户的所有会话，用于管理员禁用、删除用户或重置密码等场景
+func (s *Service) RevokeUser(ctx context.Context, userID uint) error {
+	var families []string
+	err := s.db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Distinct().Pluck("family_id", &families).Error
+	if err != nil {
+		return err
+	}
+	for _, familyID := range families {
+		if err := s.revokeFamily(ctx, familyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reuseDetected 已失效的刷新令牌被再次使用，可能是令牌被盗用，撤销整个会话
+func (s *Service) reuseDetected(ctx context.Context, token model.RefreshToken, client Client) {
+	s.logger.Warnw("检测到刷新令牌被重复使用，已撤销整个会话",
+		"user_id", token.UserID, "family_id", token.FamilyID, "token_id", token.ID,
+		"ip", client.IP, "user_agent", client.UserAgent)
+	if err := s.revokeFamily(ctx, token.FamilyID); err != nil {
+		s.logger.Errorf("撤销会话失败: %v", err)
+	}
+}
+
+// revokeFamily 撤销一个会话的所有刷新令牌，并让该会话签发的访问令牌立即失效
+func (s *Service) revokeFamily(ctx context.Context, familyID string) error {
+	if err := s.denylist.RevokeSession(ctx, familyID, s.tokens.Expiration()); err != nil {
+		s.logger.Warnf("写入会话撤销列表失败: %v", err)
+	}
+	return s.db.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// createRefreshToken 生成并保存一个刷新令牌，返回明文令牌
+func (s *Service) createRefreshToken(tx *gorm.DB, userID uint, familyID string, client Client, amr []string) (string, *model.RefreshToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	record := &model.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		IPAddress: client.IP,
+		UserAgent: client.UserAgent,
+		AMR:       strings.Join(amr, " "),
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// pair 为会话签发访问令牌
+func (s *Service) pair(user *model.User, familyID, refresh string, amr []string) (Pair, error) {
+	access, err := s.tokens.Sign(auth.Claims{
+		UserID: user.ID, Username: user.Username, Role: user.Role, SessionID: familyID, AMR: amr,
+		PasswordChange: user.MustChangePassword,
+	})
+	if err != nil {
+		return Pair{}, err
+	}
+	return Pair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int64(s.tokens.Expiration().Seconds())}, nil
+}
+
+// hashToken 计算刷新令牌的摘要，数据库中不保存明文
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
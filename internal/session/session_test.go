@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	auth "shorturl-platform/pkg/jwt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupService(t *testing.T) (*Service, *Denylist, *auth.TokenManager, *model.User) {
+	db, err := gorm.Open(sqlite.Open("file:session_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RefreshToken{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	user := &model.User{Username: "alice", Email: "alice@example.com", Role: "user", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	tokens := auth.NewManager("test-secret", "test", 15*time.Minute)
+	denylist := NewDenylist(nil)
+	return NewService(db, tokens, denylist, time.Hour, zap.NewNop().Sugar()), denylist, tokens, user
+}
+
+func TestService_RefreshRotatesToken(t *testing.T) {
+	s, _, tokens, user := setupService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, user, Client{IP: "10.0.0.1"}, []string{auth.AMRPassword, auth.AMROTP, auth.AMRMFA})
+	require.NoError(t, err)
+	assert.Equal(t, int64(900), first.ExpiresIn)
+
+	second, err := s.Refresh(ctx, first.RefreshToken, Client{IP: "10.0.0.1"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// 新旧访问令牌属于同一个会话
+	c1, _ := tokens.ValidateToken(first.AccessToken)
+	c2, _ := tokens.ValidateToken(second.AccessToken)
+	assert.Equal(t, c1.SessionID, c2.SessionID)
+	assert.NotEqual(t, c1.ID, c2.ID)
+	// 刷新后的令牌沿用登录时的认证方式
+	assert.True(t, c2.HasMFA())
+	assert.Equal(t, c1.AMR, c2.AMR)
+
+	_, err = s.Refresh(ctx, "not-a-token", Client{})
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestService_ReuseRevokesFamily(t *testing.T) {
+	s, denylist, tokens, user := setupService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, user, Client{}, nil)
+	require.NoError(t, err)
+	second, err := s.Refresh(ctx, first.RefreshToken, Client{})
+	require.NoError(t, err)
+
+	// 已轮换的令牌被再次使用，整个会话失效，包括合法持有者手中最新的刷新令牌和访问令牌
+	_, err = s.Refresh(ctx, first.RefreshToken, Client{IP: "203.0.113.9"})
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = s.Refresh(ctx, second.RefreshToken, Client{})
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	claims, _ := tokens.ValidateToken(second.AccessToken)
+	revoked, err := denylist.IsRevoked(ctx, claims.ID, claims.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestService_Logout(t *testing.T) {
+	s, denylist, tokens, user := setupService(t)
+	ctx := context.Background()
+
+	pair, err := s.Issue(ctx, user, Client{}, nil)
+	require.NoError(t, err)
+	other, err := s.Issue(ctx, user, Client{}, nil)
+	require.NoError(t, err)
+
+	claims, _ := tokens.ValidateToken(pair.AccessToken)
+	require.NoError(t, s.Logout(ctx, claims))
+
+	revoked, _ := denylist.IsRevoked(ctx, claims.ID, claims.SessionID)
+	assert.True(t, revoked)
+	_, err = s.Refresh(ctx, pair.RefreshToken, Client{})
+	assert.Error(t, err)
+
+	// 其他会话不受影响
+	otherClaims, _ := tokens.ValidateToken(other.AccessToken)
+	revoked, _ = denylist.IsRevoked(ctx, otherClaims.ID, otherClaims.SessionID)
+	assert.False(t, revoked)
+	_, err = s.Refresh(ctx, other.RefreshToken, Client{})
+	assert.NoError(t, err)
+}
+
+func TestService_RevokeUser(t *testing.T) {
+	s, denylist, tokens, user := setupService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, user, Client{}, nil)
+	require.NoError(t, err)
+	second, err := s.Issue(ctx, user, Client{}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.RevokeUser(ctx, user.ID))
+	for _, pair := range []Pair{first, second} {
+		claims, _ := tokens.ValidateToken(pair.AccessToken)
+		revoked, _ := denylist.IsRevoked(ctx, claims.ID, claims.SessionID)
+		assert.True(t, revoked)
+		_, err = s.Refresh(ctx, pair.RefreshToken, Client{})
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,49 @@
+package shortcode
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// AliasCharset 是自定义短码（别名）允许使用的字符集，在 DefaultCharset 的基础上增加了 '-' 和 '_'
+	AliasCharset = DefaultCharset + "-_"
+	// AliasMinLength 是别名的最小长度
+	AliasMinLength = 3
+	// AliasMaxLength 是别名的最大长度，需与 model.ShortLink.ShortCode 的列宽保持一致
+	AliasMaxLength = 32
+)
+
+var (
+	// ErrAliasLength 表示别名长度不在允许范围内
+	ErrAliasLength = errors.New("别名长度必须在 3 到 32 个字符之间")
+	// ErrAliasCharset 表示别名包含不允许的字符
+	ErrAliasCharset = errors.New("别名只能包含字母、数字、'-' 和 '_'")
+	// ErrAliasReserved 表示别名是系统保留字
+	ErrAliasReserved = errors.New("别名是系统保留字，不能使用")
+)
+
+// reservedAliases 是与系统路由冲突、不能作为别名的保留字（不区分大小写）
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"auth":    {},
+	"swagger": {},
+	"static":  {},
+	"health":  {},
+}
+
+// ValidateAlias 校验用户自定义的别名是否合法
+func ValidateAlias(alias string) error {
+	if len(alias) < AliasMinLength || len(alias) > AliasMaxLength {
+		return ErrAliasLength
+	}
+	for i := 0; i < len(alias); i++ {
+		if strings.IndexByte(AliasCharset, alias[i]) < 0 {
+			return ErrAliasCharset
+		}
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return ErrAliasReserved
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package shortcode
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestValidateAlias(t *testing.T) {
+	assert.NoError(t, ValidateAlias("spring-sale"))
+	assert.NoError(t, ValidateAlias("Promo_2026"))
+	assert.ErrorIs(t, ValidateAlias("ab"), ErrAliasLength)
+	assert.ErrorIs(t, ValidateAlias("a-very-long-alias-that-exceeds-the-limit"), ErrAliasLength)
+	assert.ErrorIs(t, ValidateAlias("café"), ErrAliasCharset)
+	assert.ErrorIs(t, ValidateAlias("Swagger"), ErrAliasReserved)
+}
+
+func TestGenerator_ClaimedCodeIsSkipped(t *testing.T) {
+	g := NewGenerator(NewRandomSource(nil, DefaultCodeLength, DefaultCharset), nil, zap.NewNop().Sugar())
+	g.enqueue("abcdefg")
+	g.enqueue("hijklmn")
+
+	g.Claim("abcdefg")
+	code, err := g.GetCode(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "hijklmn", code, "被别名占用的短码不应被分发")
+
+	// 不在通道中的短码不会被记录，记录的数量不超过通道容量
+	g.Claim("opqrstu")
+	assert.Empty(t, g.queued)
+}
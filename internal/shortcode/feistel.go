@@ -0,0 +1,122 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// feistelRounds 是 Feistel 网络的轮数
+const feistelRounds = 4
+
+// FeistelSource 把计数器编号经过以密钥为参数的 Feistel 置换打乱后，编码为定长短码。
+// 置换是 [0, len(charset)^length) 上的双射，不同的编号一定得到不同的短码，生成时不需要查重
+type FeistelSource struct {
+	counter Counter
+	length  int
+	charset string
+	perm    *feistel
+}
+
+// NewFeistelSource 创建 Feistel 短码来源，短码空间 len(charset)^length 不能超过 2^62
+func NewFeistelSource(counter Counter, length int, charset, secret string) (*FeistelSource, error) {
+	space := codeSpace(length, charset)
+	if space > 1<<62 {
+		return nil, errors.New("短码空间过大，请缩短短码长度或减少字符集")
+	}
+	return &FeistelSource{counter: counter, length: length, charset: charset, perm: newFeistel(space, secret)}, nil
+}
+
+// Next 分配一个编号并返回对应的短码
+func (s *FeistelSource) Next(ctx context.Context) (string, error) {
+	n, err := s.counter.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	if n >= s.perm.space {
+		return "", errSpaceExhausted
+	}
+	return encodeFixed(s.perm.permute(n), s.length, s.charset), nil
+}
+
+// Generatable 判断 code 是否为该来源可能生成的定长短码
+func (s *FeistelSource) Generatable(code string) bool {
+	return len(code) == s.length && matchesCharset(code, s.charset)
+}
+
+// encodeFixed 将 n 编码为 length 位的定长字符串，高位不足时用 charset[0] 补齐
+func encodeFixed(n uint64, length int, charset string) string {
+	b := make([]byte, length)
+	base := uint64(len(charset))
+	for i := length - 1; i >= 0; i-- {
+		b[i] = charset[n%base]
+		n /= base
+	}
+	return string(b)
+}
+
+// feistel 是 [0, space) 上的伪随机置换：在覆盖 space 的最小偶数位宽上做平衡 Feistel 置换，
+// 结果超出范围时继续置换（cycle walking），直到落回 [0, space)
+type feistel struct {
+	space    uint64
+	halfBits uint
+	mask     uint64
+	key      []byte
+}
+
+func newFeistel(space uint64, secret string) *feistel {
+	width := uint(bits.Len64(space - 1))
+	if width%2 == 1 {
+		width++
+	}
+	if width < 2 {
+		width = 2
+	}
+	return &feistel{space: space, halfBits: width / 2, mask: 1<<(width/2) - 1, key: []byte(secret)}
+}
+
+// permute 返回 n 的置换结果，n 必须小于 space
+func (f *feistel) permute(n uint64) uint64 {
+	for {
+		n = f.round(n)
+		if n < f.space {
+			return n
+		}
+	}
+}
+
+// round 对 n 做一次完整的 Feistel 置换
+func (f *feistel) round(n uint64) uint64 {
+	left, right := n>>f.halfBits, n&f.mask
+	for i := 0; i < feistelRounds; i++ {
+		left, right = right, left^f.roundFunc(i, right)
+	}
+	return left<<f.halfBits | right
+}
+
+// roundFunc 是第 i 轮的轮函数：SHA-256(密钥 || 轮次 || x) 的前 8 字节
+func (f *feistel) roundFunc(i int, x uint64) uint64 {
+	h := sha256.New()
+	h.Write(f.key)
+	var buf [9]byte
+	buf[0] = byte(i)
+	binary.BigEndian.PutUint64(buf[1:], x)
+	h.Write(buf[:])
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8]) & f.mask
+}
+
+// codeSpace 返回 len(charset)^length，溢出时返回 math.MaxUint64
+func codeSpace(length int, charset string) uint64 {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(space, uint64(len(charset)))
+		if hi != 0 {
+			return math.MaxUint64
+		}
+		space = lo
+	}
+	return space
+}
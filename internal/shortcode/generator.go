@@ -1,43 +1,57 @@
 package shortcode
 
 import (
-	"crypto/rand"
-	"math/big"
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 const (
-	// Charset 包含用于生成短码的所有字符
-	Charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	// CodeLength 是生成的短码的长度
-	CodeLength = 7
+	// DefaultCharset 是默认的短码字符集 (base62)
+	DefaultCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// DefaultCodeLength 是默认的短码长度
+	DefaultCodeLength = 7
+	// MinCodeLength 是允许配置的最小短码长度
+	MinCodeLength = 4
 	// ChannelBufferSize 是短码通道的缓冲区大小
 	ChannelBufferSize = 1000
 	// MinFillThreshold 是触发补充的最小阈值
 	MinFillThreshold = 100
+	// maxTakenCodes 是连续跳过已被使用的短码的上限，超过后本次生成失败
+	maxTakenCodes = 10
 )
 
+// ErrGeneratorStopped 表示生成器已经停止，不再提供短码
+var ErrGeneratorStopped = errors.New("短码生成器已停止")
+
 // Generator 负责生成和提供唯一的短码
 type Generator struct {
-	db        *gorm.DB
+	source    CodeSource
+	registry  *Registry
 	codeChan  chan string
 	mu        sync.Mutex
 	isFilling bool
 	stopChan  chan struct{}
+	stopOnce  sync.Once
 	logger    *zap.SugaredLogger
+
+	queueMu sync.Mutex
+	queued  map[string]bool // 通道中的短码，值为 true 表示已被别名占用，取出时跳过
 }
 
-// NewGenerator 创建一个新的短码生成器实例
-func NewGenerator(db *gorm.DB, logger *zap.SugaredLogger) *Generator {
+// NewGenerator 创建一个新的短码生成器实例，短码由 source 生成，registry 负责别名查重和记录已插入的短码
+func NewGenerator(source CodeSource, registry *Registry, logger *zap.SugaredLogger) *Generator {
 	return &Generator{
-		db:       db,
+		source:   source,
+		registry: registry,
 		codeChan: make(chan string, ChannelBufferSize),
 		stopChan: make(chan struct{}),
 		logger:   logger.Named("shortcode_generator"),
+		queued:   make(map[string]bool),
 	}
 }
 
@@ -48,15 +62,123 @@ func (g *Generator) Start() {
 	go g.monitorAndRefill()
 }
 
-// Stop 停止短码生成器
+// Stop 停止短码生成器，之后的 GetCode 返回 ErrGeneratorStopped，重复调用无效
 func (g *Generator) Stop() {
-	g.logger.Info("正在停止短码生成器...")
-	close(g.stopChan)
+	g.stopOnce.Do(func() {
+		g.logger.Info("正在停止短码生成器...")
+		close(g.stopChan)
+	})
 }
 
-// GetCode 从通道中获取一个唯一的短码
-func (g *Generator) GetCode() string {
-	return <-g.codeChan
+// GetCode 获取一个唯一的短码：优先从预生成通道中取，通道为空时同步生成并触发后台补充。
+// 生成器已停止时返回 ErrGeneratorStopped，无法生成时返回包装了 ErrExhausted 的错误，
+// ctx 结束时返回 ctx.Err()
+func (g *Generator) GetCode(ctx context.Context) (string, error) {
+	for {
+		select {
+		case <-g.stopChan:
+			return "", ErrGeneratorStopped
+		case <-ctx.Done():
+			return "", ctx.Err()
+		default:
+		}
+
+		select {
+		case code := <-g.codeChan:
+			if !g.dequeue(code) {
+				return code, nil
+			}
+			g.logger.Infof("短码 %s 已被别名占用，跳过。", code)
+		default:
+			go g.fillChannel()
+			return g.generate(ctx)
+		}
+	}
+}
+
+// next 从来源获取一个未被使用的短码。基于计数器的来源不会重复生成同一个短码，
+// 但生成的短码可能已被别名、旧版本的随机短码或切换策略前的短码占用，这里通过 registry 查重后跳过；
+// 随机来源在生成时已经查重，不需要重复检查
+func (g *Generator) next(ctx context.Context) (string, error) {
+	if _, checked := g.source.(*RandomSource); checked || g.registry == nil {
+		return g.source.Next(ctx)
+	}
+	for i := 0; i < maxTakenCodes; i++ {
+		code, err := g.source.Next(ctx)
+		if err != nil {
+			return "", err
+		}
+		exists, err := g.registry.Exists(ctx, code)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return code, nil
+		}
+		g.logger.Infof("短码 %s 已被使用，跳过。", code)
+	}
+	return "", fmt.Errorf("连续 %d 个短码都已被使用", maxTakenCodes)
+}
+
+// generate 在通道为空时同步生成一个短码
+func (g *Generator) generate(ctx context.Context) (string, error) {
+	code, err := g.next(ctx)
+	switch {
+	case err == nil:
+		return code, nil
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case errors.Is(err, ErrExhausted):
+		return "", err
+	default:
+		g.logger.Errorf("短码通道为空，同步生成短码失败: %v", err)
+		return "", fmt.Errorf("%w: %v", ErrExhausted, err)
+	}
+}
+
+// Claim 在别名创建后调用。通道中的短码是预先生成的，可能在别名创建之前就已通过了唯一性检查，
+// 这类短码在取出时跳过。只记录当前在通道中的短码，其他情况下插入时由唯一索引拒绝并换一个短码重试
+func (g *Generator) Claim(code string) {
+	if !g.source.Generatable(code) {
+		return
+	}
+	g.queueMu.Lock()
+	if _, ok := g.queued[code]; ok {
+		g.queued[code] = true
+	}
+	g.queueMu.Unlock()
+}
+
+// Exists 判断短码是否已被使用
+func (g *Generator) Exists(ctx context.Context, code string) (bool, error) {
+	return g.registry.Exists(ctx, code)
+}
+
+// Record 在短链接插入数据库后记录其短码，之后的查重可以通过过滤器判断
+func (g *Generator) Record(ctx context.Context, code string) {
+	g.registry.Add(ctx, code)
+}
+
+// Stats 返回短码查重的统计信息
+func (g *Generator) Stats(ctx context.Context) RegistryStats {
+	return g.registry.Stats(ctx)
+}
+
+// enqueue 将短码放入通道
+func (g *Generator) enqueue(code string) {
+	g.queueMu.Lock()
+	g.queued[code] = false
+	g.queueMu.Unlock()
+	g.codeChan <- code
+}
+
+// dequeue 记录短码已从通道中取出，返回它是否已被别名占用
+func (g *Generator) dequeue(code string) bool {
+	g.queueMu.Lock()
+	defer g.queueMu.Unlock()
+	claimed := g.queued[code]
+	delete(g.queued, code)
+	return claimed
 }
 
 // monitorAndRefill 监视通道的填充水平并根据需要进行补充
@@ -100,56 +222,14 @@ func (g *Generator) fillChannel() {
 			g.logger.Info("填充任务已中断。")
 			return
 		default:
-			code, err := g.generateUniqueCode()
+			code, err := g.next(context.Background())
 			if err != nil {
 				g.logger.Errorf("生成唯一短码时出错: %v", err)
 				time.Sleep(100 * time.Millisecond) // 避免在错误情况下快速循环
 				continue
 			}
-			if code != "" {
-				g.codeChan <- code
-			}
+			g.enqueue(code)
 		}
 	}
 	g.logger.Infof("短码通道已填满，现有 %d 个。", len(g.codeChan))
 }
-
-// generateUniqueCode 生成一个在数据库中唯一的短码
-func (g *Generator) generateUniqueCode() (string, error) {
-	for i := 0; i < 10; i++ { // 尝试最多10次
-		code, err := g.generateRandomString(CodeLength)
-		if err != nil {
-			return "", err
-		}
-		if !g.isCodeExist(code) {
-			return code, nil
-		}
-	}
-	g.logger.Warn("已尝试10次生成短码，但均存在冲突。")
-	return "", nil // 返回空字符串表示需要重试
-}
-
-// generateRandomString 使用加密安全的随机数生成器生成一个给定长度的字符串
-func (g *Generator) generateRandomString(length int) (string, error) {
-	b := make([]byte, length)
-	for i := range b {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(Charset))))
-		if err != nil {
-			return "", err
-		}
-		b[i] = Charset[num.Int64()]
-	}
-	return string(b), nil
-}
-
-// isCodeExist 检查给定的短码是否已在数据库中存在
-func (g *Generator) isCodeExist(code string) bool {
-	var count int64
-	// 使用 unscoped 可以在包含软删除的表上进行查询
-	if err := g.db.Unscoped().Table("short_links").Where("short_code = ?", code).Count(&count).Error; err != nil {
-		g.logger.Errorf("查询数据库时出错: %v", err)
-		// 在不确定的情况下，保守地认为它存在以避免冲突
-		return true
-	}
-	return count > 0
-}
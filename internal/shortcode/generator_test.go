@@ -0,0 +1,105 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+	"shorturl-platform/internal/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// stubSource 是测试用的短码来源，next 决定每次 Next 的结果
+type stubSource struct {
+	next func(ctx context.Context) (string, error)
+}
+
+func (s stubSource) Next(ctx context.Context) (string, error) { return s.next(ctx) }
+func (s stubSource) Generatable(string) bool                  { return true }
+
+func TestGenerator_GetCode(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	t.Run("通道为空时同步生成", func(t *testing.T) {
+		source, err := NewFeistelSource(&memCounter{}, DefaultCodeLength, DefaultCharset, "secret")
+		require.NoError(t, err)
+		g := NewGenerator(source, nil, logger)
+		defer g.Stop()
+
+		code, err := g.GetCode(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, code, DefaultCodeLength)
+	})
+
+	t.Run("停止后返回 ErrGeneratorStopped", func(t *testing.T) {
+		g := NewGenerator(stubSource{next: func(context.Context) (string, error) { return "abcdefg", nil }}, nil, logger)
+		g.enqueue("hijklmn")
+		g.Stop()
+		g.Stop()
+
+		_, err := g.GetCode(context.Background())
+		assert.ErrorIs(t, err, ErrGeneratorStopped)
+	})
+
+	t.Run("无法生成时返回 ErrExhausted", func(t *testing.T) {
+		dbDown := errors.New("数据库不可用")
+		g := NewGenerator(stubSource{next: func(context.Context) (string, error) { return "", dbDown }}, nil, logger)
+		defer g.Stop()
+
+		_, err := g.GetCode(context.Background())
+		assert.ErrorIs(t, err, ErrExhausted)
+
+		// 定长短码空间用完
+		source, err := NewFeistelSource(&memCounter{n: 16}, 4, "ab", "secret")
+		require.NoError(t, err)
+		g = NewGenerator(source, nil, logger)
+		defer g.Stop()
+		_, err = g.GetCode(context.Background())
+		assert.ErrorIs(t, err, ErrExhausted)
+	})
+
+	t.Run("遵守请求的截止时间", func(t *testing.T) {
+		g := NewGenerator(stubSource{next: func(ctx context.Context) (string, error) {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(time.Second):
+				return "abcdefg", nil
+			}
+		}}, nil, logger)
+		defer g.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := g.GetCode(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+// TestGenerator_SkipsTakenCounterCodes 测试基于计数器的来源生成的短码已被别名占用时跳过
+func TestGenerator_SkipsTakenCounterCodes(t *testing.T) {
+	db := openRegistryDB(t)
+	require.NoError(t, db.Create(&model.ShortLink{ShortCode: "alias01", OriginalURL: "https://example.com"}).Error)
+	registry := NewRegistry(db, nil, zap.NewNop().Sugar())
+
+	codes := []string{"alias01", "fresh01"}
+	g := NewGenerator(stubSource{next: func(context.Context) (string, error) {
+		code := codes[0]
+		codes = codes[1:]
+		return code, nil
+	}}, registry, zap.NewNop().Sugar())
+	defer g.Stop()
+
+	code, err := g.generate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "fresh01", code)
+
+	// 一直生成已被使用的短码时在有限次数后失败
+	g = NewGenerator(stubSource{next: func(context.Context) (string, error) { return "alias01", nil }}, registry, zap.NewNop().Sugar())
+	defer g.Stop()
+	_, err = g.generate(context.Background())
+	assert.ErrorIs(t, err, ErrExhausted)
+}
@@ -0,0 +1,208 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+)
+
+// hashids 算法的参数，与 hashids.org 的各语言实现保持一致
+const (
+	hashidsSeparators = "cfhistuCFHISTU"
+	hashidsSepDiv     = 3.5
+	hashidsGuardDiv   = 12
+	hashidsMinAlpha   = 16
+)
+
+// HashidsSource 使用 hashids 算法编码计数器编号。编码可逆，不同的编号一定得到不同的短码，
+// 生成时不需要查重；短码长度至少为 length，编号超出该长度能表示的范围后短码会变长
+type HashidsSource struct {
+	counter Counter
+	hashids *Hashids
+	charset string
+}
+
+// NewHashidsSource 创建 hashids 短码来源，secret 作为 hashids 的 salt
+func NewHashidsSource(counter Counter, length int, charset, secret string) (*HashidsSource, error) {
+	h, err := NewHashids(secret, length, charset)
+	if err != nil {
+		return nil, err
+	}
+	return &HashidsSource{counter: counter, hashids: h, charset: charset}, nil
+}
+
+// Next 分配一个编号并返回对应的短码
+func (s *HashidsSource) Next(ctx context.Context) (string, error) {
+	n, err := s.counter.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return s.hashids.Encode(n), nil
+}
+
+// Generatable 判断 code 是否可能由该来源生成
+func (s *HashidsSource) Generatable(code string) bool {
+	return len(code) >= s.hashids.minLength && matchesCharset(code, s.charset)
+}
+
+// Hashids 实现 hashids 算法（https://hashids.org）对单个整数的编码和解码
+type Hashids struct {
+	salt      string
+	minLength int
+	alphabet  string
+	seps      string
+	guards    string
+}
+
+// NewHashids 创建 hashids 编码器，alphabet 至少需要 16 个不重复的字符
+func NewHashids(salt string, minLength int, alphabet string) (*Hashids, error) {
+	if len(alphabet) < hashidsMinAlpha {
+		return nil, errors.New("hashids 策略的字符集至少需要 16 个字符")
+	}
+
+	// 分隔符只保留字符集中存在的字符，并从字符集中移除
+	var seps, alpha []byte
+	for i := 0; i < len(hashidsSeparators); i++ {
+		if strings.IndexByte(alphabet, hashidsSeparators[i]) >= 0 {
+			seps = append(seps, hashidsSeparators[i])
+		}
+	}
+	for i := 0; i < len(alphabet); i++ {
+		if strings.IndexByte(hashidsSeparators, alphabet[i]) < 0 {
+			alpha = append(alpha, alphabet[i])
+		}
+	}
+	shuffle(seps, salt)
+
+	if len(seps) == 0 || float64(len(alpha))/float64(len(seps)) > hashidsSepDiv {
+		sepsLength := int(math.Ceil(float64(len(alpha)) / hashidsSepDiv))
+		if sepsLength == 1 {
+			sepsLength++
+		}
+		if sepsLength > len(seps) {
+			diff := sepsLength - len(seps)
+			seps = append(seps, alpha[:diff]...)
+			alpha = alpha[diff:]
+		} else {
+			seps = seps[:sepsLength]
+		}
+	}
+	shuffle(alpha, salt)
+
+	guardCount := int(math.Ceil(float64(len(alpha)) / hashidsGuardDiv))
+	var guards []byte
+	if len(alpha) < 3 {
+		guards, seps = seps[:guardCount], seps[guardCount:]
+	} else {
+		guards, alpha = alpha[:guardCount], alpha[guardCount:]
+	}
+
+	return &Hashids{salt: salt, minLength: minLength, alphabet: string(alpha), seps: string(seps), guards: string(guards)}, nil
+}
+
+// Encode 编码一个整数
+func (h *Hashids) Encode(n uint64) string {
+	alphabet := []byte(h.alphabet)
+	id := int(n % 100)
+	lottery := alphabet[id%len(alphabet)]
+
+	buffer := append([]byte{lottery}, h.salt...)
+	buffer = append(buffer, alphabet...)
+	shuffle(alphabet, string(buffer[:len(alphabet)]))
+	result := append([]byte{lottery}, toAlphabet(n, alphabet)...)
+
+	if len(result) < h.minLength {
+		guard := h.guards[(id+int(result[0]))%len(h.guards)]
+		result = append([]byte{guard}, result...)
+		if len(result) < h.minLength {
+			guard = h.guards[(id+int(result[2]))%len(h.guards)]
+			result = append(result, guard)
+		}
+	}
+
+	half := len(alphabet) / 2
+	for len(result) < h.minLength {
+		shuffle(alphabet, string(alphabet))
+		padded := make([]byte, 0, len(result)+len(alphabet))
+		padded = append(padded, alphabet[half:]...)
+		padded = append(padded, result...)
+		padded = append(padded, alphabet[:half]...)
+		result = padded
+		if excess := len(result) - h.minLength; excess > 0 {
+			result = result[excess/2 : excess/2+h.minLength]
+		}
+	}
+	return string(result)
+}
+
+// Decode 解码由 Encode 生成的字符串
+func (h *Hashids) Decode(code string) (uint64, error) {
+	invalid := errors.New("无效的 hashids 编码")
+	parts := strings.Split(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(h.guards, r) {
+			return ' '
+		}
+		return r
+	}, code), " ")
+	// 补齐时加入的守卫字符把编码分成两段或三段，有效部分在中间
+	core := parts[0]
+	if len(parts) == 2 || len(parts) == 3 {
+		core = parts[1]
+	}
+	if len(core) < 2 || strings.ContainsAny(core, h.seps) {
+		return 0, invalid
+	}
+
+	alphabet := []byte(h.alphabet)
+	lottery := core[0]
+	buffer := append([]byte{lottery}, h.salt...)
+	buffer = append(buffer, alphabet...)
+	shuffle(alphabet, string(buffer[:len(alphabet)]))
+	n, ok := fromAlphabet(core[1:], alphabet)
+	if !ok || h.Encode(n) != code {
+		return 0, invalid
+	}
+	return n, nil
+}
+
+// shuffle 按 salt 对 alphabet 做确定性的洗牌
+func shuffle(alphabet []byte, salt string) {
+	if salt == "" {
+		return
+	}
+	for i, v, p := len(alphabet)-1, 0, 0; i > 0; i, v = i-1, v+1 {
+		v %= len(salt)
+		c := int(salt[v])
+		p += c
+		j := (c + v + p) % i
+		alphabet[i], alphabet[j] = alphabet[j], alphabet[i]
+	}
+}
+
+// toAlphabet 将 n 表示为以 alphabet 为数字的字符串
+func toAlphabet(n uint64, alphabet []byte) []byte {
+	base := uint64(len(alphabet))
+	var out []byte
+	for {
+		out = append([]byte{alphabet[n%base]}, out...)
+		n /= base
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+// fromAlphabet 是 toAlphabet 的逆运算
+func fromAlphabet(s string, alphabet []byte) (uint64, bool) {
+	base := uint64(len(alphabet))
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(string(alphabet), s[i])
+		if d < 0 || n > (math.MaxUint64-uint64(d))/base {
+			return 0, false
+		}
+		n = n*base + uint64(d)
+	}
+	return n, true
+}
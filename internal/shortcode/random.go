@@ -0,0 +1,65 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// randomAttempts 是随机策略生成一个短码时最多尝试的次数
+const randomAttempts = 10
+
+// errRandomCollision 表示连续多次随机生成的短码都已被使用
+var errRandomCollision = errors.New("已尝试 10 次生成短码，但均存在冲突")
+
+// RandomSource 随机生成短码并通过 Registry 查重
+type RandomSource struct {
+	registry *Registry
+	length   int
+	charset  string
+}
+
+// NewRandomSource 创建随机短码来源
+func NewRandomSource(registry *Registry, length int, charset string) *RandomSource {
+	return &RandomSource{registry: registry, length: length, charset: charset}
+}
+
+// Next 生成一个未被使用的短码
+func (s *RandomSource) Next(ctx context.Context) (string, error) {
+	for i := 0; i < randomAttempts; i++ {
+		code, err := s.randomString()
+		if err != nil {
+			return "", err
+		}
+		exists, err := s.registry.Exists(ctx, code)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return code, nil
+		}
+	}
+	return "", errRandomCollision
+}
+
+// Generatable 判断 code 是否为该来源可能生成的定长短码
+func (s *RandomSource) Generatable(code string) bool {
+	return len(code) == s.length && matchesCharset(code, s.charset)
+}
+
+// randomString 使用加密安全的随机数生成器生成短码
+func (s *RandomSource) randomString() (string, error) {
+	var b strings.Builder
+	b.Grow(s.length)
+	limit := big.NewInt(int64(len(s.charset)))
+	for i := 0; i < s.length; i++ {
+		num, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(s.charset[num.Int64()])
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,269 @@
+package shortcode
+
+import (
+	"context"
+	"fmt"
+	"shorturl-platform/pkg/bloom"
+	"strings"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 短码过滤器存储
+const (
+	FilterStoreMemory = "memory"
+	FilterStoreRedis  = "redis"
+)
+
+// filterLoadBatch 是启动时从 short_links 加载短码的批大小
+const filterLoadBatch = 5000
+
+// filterKey 是 RedisBloom 过滤器的键
+const filterKey = "shortcode:filter"
+
+// CodeFilter 是已使用短码的近似集合：Test 返回 false 时短码一定没有被添加过，返回 true 时可能误判
+type CodeFilter interface {
+	Add(ctx context.Context, codes ...string) error
+	Test(ctx context.Context, code string) (bool, error)
+	Stats(ctx context.Context) (bloom.Stats, error)
+}
+
+// MemoryFilter 是进程内的可扩展布隆过滤器。每个实例只知道自己插入和启动时加载的短码，
+// 多实例部署时其他实例新插入的短码可能被判断为不存在，此时由 short_code 的唯一索引拒绝插入
+type MemoryFilter struct {
+	filter *bloom.Scalable
+}
+
+// NewMemoryFilter 创建进程内过滤器，capacity 为第一层容量，p 为目标误判率
+func NewMemoryFilter(capacity uint64, p float64) *MemoryFilter {
+	return &MemoryFilter{filter: bloom.New(capacity, p)}
+}
+
+// Add 添加短码
+func (f *MemoryFilter) Add(_ context.Context, codes ...string) error {
+	for _, code := range codes {
+		f.filter.Add([]byte(code))
+	}
+	return nil
+}
+
+// Test 判断短码是否可能已被使用
+func (f *MemoryFilter) Test(_ context.Context, code string) (bool, error) {
+	return f.filter.Test([]byte(code)), nil
+}
+
+// Stats 返回过滤器的运行状态
+func (f *MemoryFilter) Stats(context.Context) (bloom.Stats, error) {
+	return f.filter.Stats(), nil
+}
+
+// RedisFilter 使用 RedisBloom 的 BF.* 命令，多个实例共享同一个过滤器
+type RedisFilter struct {
+	rdb *redis.Client
+	key string
+}
+
+// NewRedisFilter 创建 RedisBloom 过滤器，键不存在时按 capacity 和 p 预留；
+// Redis 未加载 RedisBloom 模块时返回错误
+func NewRedisFilter(ctx context.Context, rdb *redis.Client, capacity uint64, p float64) (*RedisFilter, error) {
+	if capacity == 0 {
+		capacity = bloom.DefaultCapacity
+	}
+	if p <= 0 || p >= 1 {
+		p = bloom.DefaultFalsePositiveRate
+	}
+	err := rdb.BFReserveWithArgs(ctx, filterKey, &redis.BFReserveOptions{
+		Capacity: int64(capacity), Error: p, Expansion: 2,
+	}).Err()
+	// 其他实例已经创建过过滤器时 RedisBloom 返回 "item exists"
+	if err != nil && !strings.Contains(err.Error(), "exists") {
+		return nil, err
+	}
+	return &RedisFilter{rdb: rdb, key: filterKey}, nil
+}
+
+// Add 批量添加短码
+func (f *RedisFilter) Add(ctx context.Context, codes ...string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+	return f.rdb.BFMAdd(ctx, f.key, args...).Err()
+}
+
+// Test 判断短码是否可能已被使用
+func (f *RedisFilter) Test(ctx context.Context, code string) (bool, error) {
+	return f.rdb.BFExists(ctx, f.key, code).Result()
+}
+
+// Stats 返回过滤器的运行状态。BF.INFO 不提供置位数量，填充率按已插入数量与总容量之比估算，
+// 估算误判率为 0，以 Registry 统计的实际误判率为准
+func (f *RedisFilter) Stats(ctx context.Context) (bloom.Stats, error) {
+	info, err := f.rdb.BFInfo(ctx, f.key).Result()
+	if err != nil {
+		return bloom.Stats{}, err
+	}
+	stats := bloom.Stats{
+		Items:    uint64(info.ItemsInserted),
+		Capacity: uint64(info.Capacity),
+		Layers:   int(info.Filters),
+		Bits:     uint64(info.Size) * 8,
+	}
+	if info.Capacity > 0 {
+		stats.FillRatio = float64(info.ItemsInserted) / float64(info.Capacity)
+	}
+	return stats, nil
+}
+
+// NewFilter 根据配置创建短码过滤器：store 为 redis 且 Redis 已加载 RedisBloom 时使用 RedisFilter，
+// 否则使用进程内过滤器
+func NewFilter(ctx context.Context, rdb *redis.Client, store string, capacity uint64, p float64, logger *zap.SugaredLogger) (CodeFilter, error) {
+	switch store {
+	case "", FilterStoreMemory:
+	case FilterStoreRedis:
+		if rdb == nil {
+			logger.Warn("Redis 不可用，短码过滤器改为使用进程内实现")
+			break
+		}
+		filter, err := NewRedisFilter(ctx, rdb, capacity, p)
+		if err == nil {
+			return filter, nil
+		}
+		logger.Warnw("创建 RedisBloom 过滤器失败，改为使用进程内实现", "error", err)
+	default:
+		return nil, fmt.Errorf("未知的短码过滤器存储: %s", store)
+	}
+	return NewMemoryFilter(capacity, p), nil
+}
+
+// RegistryStats 是短码查重的统计信息，用于判断过滤器是否需要重建
+type RegistryStats struct {
+	Filter *bloom.Stats `json:"filter,omitempty"`
+	Loaded bool         `json:"loaded"`
+	// Lookups 是查重次数，Skipped 是过滤器判断为不存在、没有访问数据库的次数
+	Lookups int64 `json:"lookups"`
+	Skipped int64 `json:"skipped"`
+	// FalsePositives 是过滤器判断可能存在、但数据库中不存在的次数
+	FalsePositives int64 `json:"false_positives"`
+	// ObservedFalsePositiveRate 是实际误判次数占过滤器判断为不存在与误判次数之和的比例
+	ObservedFalsePositiveRate float64 `json:"observed_false_positive_rate"`
+}
+
+// Registry 负责判断短码是否已被使用。配置了过滤器时先查询过滤器，过滤器判断为不存在时直接返回，
+// 不访问数据库；过滤器加载完成之前所有查询都访问数据库。布隆过滤器不支持删除，
+// 已删除链接的短码仍会命中过滤器，这类查询回落到数据库并计入误判次数
+type Registry struct {
+	db     *gorm.DB
+	filter CodeFilter
+	logger *zap.SugaredLogger
+
+	loaded         atomic.Bool
+	lookups        atomic.Int64
+	skipped        atomic.Int64
+	falsePositives atomic.Int64
+}
+
+// NewRegistry 创建短码查重器，filter 为 nil 时每次查重都访问数据库
+func NewRegistry(db *gorm.DB, filter CodeFilter, logger *zap.SugaredLogger) *Registry {
+	return &Registry{db: db, filter: filter, logger: logger.Named("code_registry")}
+}
+
+// Load 把 short_links 中的全部短码加载到过滤器中。加载期间插入的短码由 Add 写入过滤器，不会遗漏
+func (r *Registry) Load(ctx context.Context) error {
+	if r.filter == nil {
+		return nil
+	}
+	var codes []string
+	total := 0
+	var lastID uint
+	for {
+		// 按主键分页，避免加载期间的插入导致偏移量分页漏读
+		var rows []struct {
+			ID        uint
+			ShortCode string
+		}
+		err := r.db.WithContext(ctx).Unscoped().Table("short_links").Select("id", "short_code").
+			Where("id > ?", lastID).Order("id").Limit(filterLoadBatch).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		codes = codes[:0]
+		for _, row := range rows {
+			codes = append(codes, row.ShortCode)
+		}
+		if err := r.filter.Add(ctx, codes...); err != nil {
+			return err
+		}
+		total += len(rows)
+		lastID = rows[len(rows)-1].ID
+	}
+	r.loaded.Store(true)
+	r.logger.Infof("已加载 %d 个短码到过滤器", total)
+	return nil
+}
+
+// Exists 判断短码是否已被使用，数据库查询失败时返回错误
+func (r *Registry) Exists(ctx context.Context, code string) (bool, error) {
+	r.lookups.Add(1)
+	maybe := false
+	if r.filter != nil && r.loaded.Load() {
+		var err error
+		maybe, err = r.filter.Test(ctx, code)
+		if err != nil {
+			r.logger.Warnw("查询短码过滤器失败，改为查询数据库", "error", err)
+		} else if !maybe {
+			r.skipped.Add(1)
+			return false, nil
+		}
+	}
+
+	var count int64
+	if err := r.db.WithContext(ctx).Unscoped().Table("short_links").Where("short_code = ?", code).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if maybe && count == 0 {
+		r.falsePositives.Add(1)
+	}
+	return count > 0, nil
+}
+
+// Add 在短码插入数据库后将其加入过滤器
+func (r *Registry) Add(ctx context.Context, code string) {
+	if r.filter == nil {
+		return
+	}
+	if err := r.filter.Add(ctx, code); err != nil {
+		r.logger.Warnw("短码写入过滤器失败", "code", code, "error", err)
+	}
+}
+
+// Stats 返回查重统计和过滤器状态
+func (r *Registry) Stats(ctx context.Context) RegistryStats {
+	stats := RegistryStats{
+		Loaded:         r.loaded.Load(),
+		Lookups:        r.lookups.Load(),
+		Skipped:        r.skipped.Load(),
+		FalsePositives: r.falsePositives.Load(),
+	}
+	if negatives := stats.Skipped + stats.FalsePositives; negatives > 0 {
+		stats.ObservedFalsePositiveRate = float64(stats.FalsePositives) / float64(negatives)
+	}
+	if r.filter != nil {
+		filterStats, err := r.filter.Stats(ctx)
+		if err != nil {
+			r.logger.Warnw("获取短码过滤器状态失败", "error", err)
+		} else {
+			stats.Filter = &filterStats
+		}
+	}
+	return stats
+}
@@ -0,0 +1,102 @@
+package shortcode
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openRegistryDB 为每个测试打开独立的内存库，测试结束时关闭，重复运行测试时不会读到上一次的数据
+func openRegistryDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ShortLink{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestRegistry(t *testing.T) {
+	db := openRegistryDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&model.ShortLink{ShortCode: "loaded1", OriginalURL: "https://example.com"}).Error)
+	deleted := model.ShortLink{ShortCode: "deleted", OriginalURL: "https://example.com"}
+	require.NoError(t, db.Create(&deleted).Error)
+
+	registry := NewRegistry(db, NewMemoryFilter(100, 0.01), zap.NewNop().Sugar())
+
+	// 加载之前过滤器为空，查重必须访问数据库
+	exists, err := registry.Exists(ctx, "loaded1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, registry.Load(ctx))
+	// 删除链接后短码仍留在过滤器中，查重回落到数据库并记为一次误判
+	require.NoError(t, db.Delete(&deleted).Error)
+	for code, want := range map[string]bool{"loaded1": true, "deleted": false} {
+		exists, err := registry.Exists(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, want, exists, code)
+	}
+
+	// 过滤器判断为不存在的短码直接返回
+	exists, err = registry.Exists(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, db.Create(&model.ShortLink{ShortCode: "inserted", OriginalURL: "https://example.com"}).Error)
+	registry.Add(ctx, "inserted")
+	exists, err = registry.Exists(ctx, "inserted")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	stats := registry.Stats(ctx)
+	assert.True(t, stats.Loaded)
+	assert.Equal(t, int64(5), stats.Lookups)
+	assert.Equal(t, int64(1), stats.Skipped)
+	assert.Equal(t, int64(1), stats.FalsePositives)
+	assert.InDelta(t, 0.5, stats.ObservedFalsePositiveRate, 1e-9)
+	require.NotNil(t, stats.Filter)
+	assert.Equal(t, uint64(3), stats.Filter.Items)
+	assert.Greater(t, stats.Filter.FillRatio, 0.0)
+}
+
+func TestRegistry_NegativeLookupSkipsDatabase(t *testing.T) {
+	db := openRegistryDB(t)
+	ctx := context.Background()
+
+	registry := NewRegistry(db, NewMemoryFilter(100, 0.01), zap.NewNop().Sugar())
+	require.NoError(t, registry.Load(ctx))
+	registry.Add(ctx, "present")
+
+	// 数据库不可用时，过滤器判断为不存在的短码仍能得到结果，可能存在的短码返回错误而不是“已存在”
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	exists, err := registry.Exists(ctx, "absent")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = registry.Exists(ctx, "present")
+	assert.Error(t, err)
+}
+
+func TestNewFilter(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	filter, err := NewFilter(context.Background(), nil, FilterStoreRedis, 0, 0, logger)
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryFilter{}, filter, "Redis 不可用时应使用进程内过滤器")
+
+	_, err = NewFilter(context.Background(), nil, "unknown", 0, 0, logger)
+	assert.Error(t, err)
+}
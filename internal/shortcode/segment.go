@@ -0,0 +1,186 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// 号段存储
+const (
+	SegmentStoreDB    = "db"
+	SegmentStoreRedis = "redis"
+)
+
+// DefaultSegmentStep 是默认每次预留的编号数量
+const DefaultSegmentStep = 1000
+
+// segmentPreloadRatio 当前号段剩余的编号少于该比例时在后台预留下一个号段
+const segmentPreloadRatio = 0.2
+
+// segmentLoadTimeout 是后台预留号段的超时时间
+const segmentLoadTimeout = 5 * time.Second
+
+// SegmentStore 原子地预留一段编号，返回预留后的最大编号 end，预留到的编号为 (end-n, end]。
+// 多个实例共享同一个存储，预留到的号段互不重叠
+type SegmentStore interface {
+	Reserve(ctx context.Context, n uint64) (uint64, error)
+}
+
+// segment 是一段已预留的编号 [next, end]
+type segment struct {
+	next, end uint64
+}
+
+func (s segment) remaining() uint64 {
+	if s.next > s.end {
+		return 0
+	}
+	return s.end - s.next + 1
+}
+
+// SegmentAllocator 按号段分配编号（Leaf-segment 模式）：每次从存储中预留 step 个编号在内存中分配，
+// 当前号段用掉 80% 后在后台预留下一个号段，号段用完时直接切换，分配编号通常不需要访问存储。
+// 实例重启时未用完的编号会被跳过，编号不连续但不会重复
+type SegmentAllocator struct {
+	store  SegmentStore
+	step   uint64
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	current segment
+	buffer  *segment      // 预留好的下一个号段
+	loading chan struct{} // 后台预留进行中时不为 nil，完成后关闭
+}
+
+// NewSegmentAllocator 创建号段分配器，step 为 0 时使用 DefaultSegmentStep
+func NewSegmentAllocator(store SegmentStore, step int, logger *zap.SugaredLogger) *SegmentAllocator {
+	if step <= 0 {
+		step = DefaultSegmentStep
+	}
+	return &SegmentAllocator{store: store, step: uint64(step), logger: logger.Named("segment"), current: segment{next: 1}}
+}
+
+// Next 返回下一个编号
+func (a *SegmentAllocator) Next(ctx context.Context) (uint64, error) {
+	a.mu.Lock()
+	for {
+		if a.current.remaining() > 0 {
+			id := a.current.next
+			a.current.next++
+			if a.current.remaining() < uint64(float64(a.step)*segmentPreloadRatio) && a.buffer == nil && a.loading == nil {
+				a.preload()
+			}
+			a.mu.Unlock()
+			return id, nil
+		}
+		if a.buffer != nil {
+			a.current, a.buffer = *a.buffer, nil
+			continue
+		}
+		if loading := a.loading; loading != nil {
+			// 等待后台预留完成，失败时由下一轮循环同步预留
+			a.mu.Unlock()
+			select {
+			case <-loading:
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+			a.mu.Lock()
+			continue
+		}
+
+		seg, err := a.load(ctx)
+		if err != nil {
+			a.mu.Unlock()
+			return 0, err
+		}
+		a.current = seg
+	}
+}
+
+// preload 在后台预留下一个号段，调用时必须持有 a.mu
+func (a *SegmentAllocator) preload() {
+	done := make(chan struct{})
+	a.loading = done
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), segmentLoadTimeout)
+		defer cancel()
+		seg, err := a.load(ctx)
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if err != nil {
+			a.logger.Warnw("预留号段失败，当前号段用完时将重试", "error", err)
+		} else {
+			a.buffer = &seg
+		}
+		a.loading = nil
+		close(done)
+	}()
+}
+
+// load 从存储中预留一个号段
+func (a *SegmentAllocator) load(ctx context.Context) (segment, error) {
+	end, err := a.store.Reserve(ctx, a.step)
+	if err != nil {
+		return segment{}, err
+	}
+	if end < a.step {
+		return segment{}, errors.New("号段存储返回了无效的编号")
+	}
+	a.logger.Debugw("已预留号段", "start", end-a.step+1, "end", end)
+	return segment{next: end - a.step + 1, end: end}, nil
+}
+
+// reserveScript 原子地预留编号；键不存在时先设置为 ARGV[2]，从数据库切换到 Redis 时从数据库中的值继续
+var reserveScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  redis.call('SET', KEYS[1], ARGV[2])
+end
+return redis.call('INCRBY', KEYS[1], ARGV[1])
+`)
+
+// RedisSegmentStore 使用 Redis INCRBY 预留号段。Redis 需要开启持久化（AOF），
+// 否则数据丢失后编号会从数据库中记录的值重新开始，可能与之后分配过的编号重复
+type RedisSegmentStore struct {
+	rdb  *redis.Client
+	key  string
+	seed *DBCounter // 键不存在时的初始值来源
+
+	mu     sync.Mutex
+	seeded bool
+	floor  uint64
+}
+
+// NewRedisSegmentStore 创建 Redis 号段存储，seed 提供键不存在时的初始值
+func NewRedisSegmentStore(rdb *redis.Client, name string, seed *DBCounter) *RedisSegmentStore {
+	return &RedisSegmentStore{rdb: rdb, key: "shortcode:sequence:" + name, seed: seed}
+}
+
+// Reserve 预留 n 个编号
+func (s *RedisSegmentStore) Reserve(ctx context.Context, n uint64) (uint64, error) {
+	floor, err := s.initialValue(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return reserveScript.Run(ctx, s.rdb, []string{s.key}, n, floor).Uint64()
+}
+
+// initialValue 返回键不存在时使用的初始值，只在第一次成功时查询数据库
+func (s *RedisSegmentStore) initialValue(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.seeded {
+		floor, err := s.seed.Current(ctx)
+		if err != nil {
+			return 0, err
+		}
+		s.floor, s.seeded = floor, true
+	}
+	return s.floor, nil
+}
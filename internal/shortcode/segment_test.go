@@ -0,0 +1,95 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+	"shorturl-platform/internal/model"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memStore 是测试用的号段存储，记录预留的次数
+type memStore struct {
+	mu       sync.Mutex
+	value    uint64
+	reserves int
+	err      error
+}
+
+func (s *memStore) Reserve(_ context.Context, n uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.reserves++
+	s.value += n
+	return s.value, nil
+}
+
+func TestSegmentAllocator(t *testing.T) {
+	store := &memStore{}
+	a := NewSegmentAllocator(store, 10, zap.NewNop().Sugar())
+
+	for want := uint64(1); want <= 25; want++ {
+		id, err := a.Next(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, want, id)
+	}
+	store.mu.Lock()
+	assert.LessOrEqual(t, store.reserves, 4, "每 10 个编号只预留一次号段")
+	store.mu.Unlock()
+
+	// 存储故障时，已预留的号段仍然可以继续分配，用完后返回错误
+	store.mu.Lock()
+	store.err = errors.New("db down")
+	store.mu.Unlock()
+	var err error
+	for i := 0; i < 30 && err == nil; i++ {
+		_, err = a.Next(t.Context())
+	}
+	assert.Error(t, err)
+}
+
+func TestSegmentAllocator_MultipleInstances(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:shortcode_segment_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.CodeSequence{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	// 多个实例共享同一个数据库计数器，分配到的编号互不重复
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		a := NewSegmentAllocator(NewDBCounter(db, "test"), 50, zap.NewNop().Sugar())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				id, err := a.Next(context.Background())
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				assert.False(t, seen[id], "编号重复: %d", id)
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, seen, 600)
+}
@@ -0,0 +1,194 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"shorturl-platform/internal/model"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 短码生成策略
+const (
+	// StrategyRandom 随机生成短码并在数据库中查重
+	StrategyRandom = "random"
+	// StrategyFeistel 将计数器编号经 Feistel 置换打乱后编码为定长短码，短码不连续且保证不重复
+	StrategyFeistel = "feistel"
+	// StrategyHashids 使用 hashids 算法编码计数器编号，短码长度至少为 Length，编号变大后会变长
+	StrategyHashids = "hashids"
+)
+
+// ErrExhausted 表示暂时没有可用的短码：预生成通道为空且同步生成失败，或定长短码的编号空间已经用完
+var ErrExhausted = errors.New("没有可用的短码")
+
+// errSpaceExhausted 表示定长短码的编号空间已经用完
+var errSpaceExhausted = fmt.Errorf("%w：短码空间已用完，请增加短码长度", ErrExhausted)
+
+// CodeSource 是短码的来源，Generator 从中获取短码填充预生成通道
+type CodeSource interface {
+	// Next 返回一个未被使用的短码
+	Next(ctx context.Context) (string, error)
+	// Generatable 判断 code 是否可能由该来源生成，不可能生成的别名不需要在预生成通道中排除
+	Generatable(code string) bool
+}
+
+// Options 短码生成配置，零值字段使用默认值
+type Options struct {
+	Strategy string // random（默认）、feistel 或 hashids
+	Length   int    // 短码长度，默认 DefaultCodeLength
+	Charset  string // 短码字符集，默认 DefaultCharset
+	Secret   string // feistel 和 hashids 打乱编号使用的密钥
+
+	SegmentStore string // 基于计数器的策略预留号段的存储：db（默认）或 redis
+	SegmentStep  int    // 每次预留的编号数量，默认 DefaultSegmentStep
+
+	Registry *Registry // 随机策略查重使用的 Registry，为 nil 时直接查询数据库
+}
+
+// NewSource 根据配置创建短码来源。基于计数器的策略按号段从 code_sequences 表或 Redis 预留编号，
+// rdb 为 nil 时即使配置了 redis 也使用数据库
+func NewSource(db *gorm.DB, rdb *redis.Client, opts Options, logger *zap.SugaredLogger) (CodeSource, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyRandom
+	}
+	if opts.Length == 0 {
+		opts.Length = DefaultCodeLength
+	}
+	if opts.Charset == "" {
+		opts.Charset = DefaultCharset
+	}
+	if err := validateCharset(opts.Charset); err != nil {
+		return nil, err
+	}
+	if opts.Length < MinCodeLength || opts.Length > AliasMaxLength {
+		return nil, fmt.Errorf("短码长度必须在 %d 到 %d 之间", MinCodeLength, AliasMaxLength)
+	}
+	if opts.SegmentStore != "" && opts.SegmentStore != SegmentStoreDB && opts.SegmentStore != SegmentStoreRedis {
+		return nil, fmt.Errorf("未知的号段存储: %s", opts.SegmentStore)
+	}
+
+	switch opts.Strategy {
+	case StrategyRandom:
+		if opts.Registry == nil {
+			opts.Registry = NewRegistry(db, nil, logger)
+		}
+		return NewRandomSource(opts.Registry, opts.Length, opts.Charset), nil
+	case StrategyFeistel:
+		return NewFeistelSource(newSegmentCounter(db, rdb, opts, logger), opts.Length, opts.Charset, opts.Secret)
+	case StrategyHashids:
+		return NewHashidsSource(newSegmentCounter(db, rdb, opts, logger), opts.Length, opts.Charset, opts.Secret)
+	default:
+		return nil, fmt.Errorf("未知的短码生成策略: %s", opts.Strategy)
+	}
+}
+
+// secretLabel 是从 auth.secret 派生短码密钥时使用的 HKDF info，与其他用途的派生密钥区分开
+const secretLabel = "shorturl-platform shortcode secret"
+
+// DeriveSecret 未配置 shortcode.secret 时用 HKDF 从 authSecret 派生短码密钥，
+// 短码密钥泄露不会暴露签名令牌的密钥
+func DeriveSecret(authSecret string) (string, error) {
+	key, err := hkdf.Key(sha256.New, []byte(authSecret), nil, secretLabel, 32)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// newSegmentCounter 创建按号段分配编号的计数器，每种策略使用独立的计数器
+func newSegmentCounter(db *gorm.DB, rdb *redis.Client, opts Options, logger *zap.SugaredLogger) Counter {
+	dbCounter := NewDBCounter(db, opts.Strategy)
+	var store SegmentStore = dbCounter
+	if opts.SegmentStore == SegmentStoreRedis {
+		if rdb != nil {
+			store = NewRedisSegmentStore(rdb, opts.Strategy, dbCounter)
+		} else {
+			logger.Warn("Redis 不可用，短码号段改为从数据库预留")
+		}
+	}
+	return NewSegmentAllocator(store, opts.SegmentStep, logger)
+}
+
+// validateCharset 校验字符集：至少两个字符、没有重复，且只包含别名允许的字符，保证生成的短码可以直接放在 URL 路径中
+func validateCharset(charset string) error {
+	if len(charset) < 2 {
+		return errors.New("短码字符集至少需要两个字符")
+	}
+	for i := 0; i < len(charset); i++ {
+		if strings.IndexByte(AliasCharset, charset[i]) < 0 {
+			return fmt.Errorf("短码字符集包含不允许的字符 %q", charset[i])
+		}
+		if strings.IndexByte(charset[i+1:], charset[i]) >= 0 {
+			return fmt.Errorf("短码字符集包含重复的字符 %q", charset[i])
+		}
+	}
+	return nil
+}
+
+// matchesCharset 判断 code 的每个字符都在 charset 中
+func matchesCharset(code, charset string) bool {
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(charset, code[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Counter 分配全局递增、不重复的编号
+type Counter interface {
+	Next(ctx context.Context) (uint64, error)
+}
+
+// DBCounter 使用 code_sequences 表中的一行作为计数器，多个实例共享同一个计数器。
+// 单独使用时每个编号都要访问一次数据库，通常作为 SegmentAllocator 的存储按号段预留
+type DBCounter struct {
+	db   *gorm.DB
+	name string
+}
+
+// NewDBCounter 创建名为 name 的数据库计数器，对应的行在第一次分配时创建
+func NewDBCounter(db *gorm.DB, name string) *DBCounter {
+	return &DBCounter{db: db, name: name}
+}
+
+// Next 原子地将计数器加一并返回新的值，编号从 1 开始
+func (c *DBCounter) Next(ctx context.Context) (uint64, error) {
+	return c.Reserve(ctx, 1)
+}
+
+// Reserve 原子地将计数器增加 n，返回增加后的值，预留到的编号为 (end-n, end]
+func (c *DBCounter) Reserve(ctx context.Context, n uint64) (uint64, error) {
+	var end uint64
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.CodeSequence{}).Where("name = ?", c.name).
+			UpdateColumn("value", gorm.Expr("value + ?", n))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 多个实例同时创建时只有一个能成功，失败的一方由调用方稍后重试
+			end = n
+			return tx.Create(&model.CodeSequence{Name: c.name, Value: end}).Error
+		}
+		return tx.Model(&model.CodeSequence{}).Where("name = ?", c.name).Pluck("value", &end).Error
+	})
+	return end, err
+}
+
+// Current 返回计数器当前的值，计数器还不存在时返回 0
+func (c *DBCounter) Current(ctx context.Context) (uint64, error) {
+	var values []uint64
+	err := c.db.WithContext(ctx).Model(&model.CodeSequence{}).Where("name = ?", c.name).Pluck("value", &values).Error
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+	return values[0], nil
+}
@@ -0,0 +1,155 @@
+package shortcode
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memCounter 是测试用的进程内计数器
+type memCounter struct {
+	mu sync.Mutex
+	n  uint64
+}
+
+func (c *memCounter) Next(context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return c.n, nil
+}
+
+func TestFeistel_IsPermutation(t *testing.T) {
+	// 在较小的空间上穷举，每个编号都映射到空间内不同的值
+	for _, space := range []uint64{2, 62, 1000, 62 * 62 * 62} {
+		f := newFeistel(space, "secret")
+		seen := make(map[uint64]bool, space)
+		for n := uint64(0); n < space; n++ {
+			p := f.permute(n)
+			require.Less(t, p, space)
+			require.False(t, seen[p], "space=%d n=%d", space, n)
+			seen[p] = true
+		}
+	}
+}
+
+func TestFeistelSource(t *testing.T) {
+	s, err := NewFeistelSource(&memCounter{}, 4, "0123456789", "secret")
+	require.NoError(t, err)
+
+	codes := make(map[string]bool)
+	var sequential int
+	prev := ""
+	for i := 0; i < 9999; i++ {
+		code, err := s.Next(t.Context())
+		require.NoError(t, err)
+		require.Len(t, code, 4)
+		require.False(t, codes[code], "短码重复: %s", code)
+		codes[code] = true
+		if prev != "" && code > prev {
+			sequential++
+		}
+		prev = code
+	}
+	assert.Less(t, sequential, 9000, "短码不应按顺序递增")
+	assert.True(t, s.Generatable("0042"))
+	assert.False(t, s.Generatable("00a2"))
+
+	// 编号用完后返回 ErrExhausted
+	_, err = s.Next(t.Context())
+	assert.ErrorIs(t, err, ErrExhausted)
+
+	// 不同的密钥得到不同的排列
+	other, err := NewFeistelSource(&memCounter{}, 4, "0123456789", "other")
+	require.NoError(t, err)
+	first, _ := other.Next(t.Context())
+	s2, _ := NewFeistelSource(&memCounter{}, 4, "0123456789", "secret")
+	again, _ := s2.Next(t.Context())
+	assert.NotEqual(t, first, again)
+
+	_, err = NewFeistelSource(&memCounter{}, 32, DefaultCharset, "secret")
+	assert.Error(t, err, "短码空间超过 2^62")
+}
+
+func TestHashids(t *testing.T) {
+	// hashids.org 文档中的示例
+	h, err := NewHashids("this is my salt", 0, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	require.NoError(t, err)
+	assert.Equal(t, "NkK9", h.Encode(12345))
+
+	h, err = NewHashids("this is my salt", 8, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	require.NoError(t, err)
+	assert.Equal(t, "gB0NV05e", h.Encode(1))
+
+	h, err = NewHashids("secret", DefaultCodeLength, DefaultCharset)
+	require.NoError(t, err)
+	seen := make(map[string]bool)
+	for _, n := range []uint64{0, 1, 2, 99, 100, 12345, 1 << 40, 1<<64 - 1} {
+		code := h.Encode(n)
+		assert.GreaterOrEqual(t, len(code), DefaultCodeLength)
+		assert.False(t, seen[code])
+		seen[code] = true
+		decoded, err := h.Decode(code)
+		require.NoError(t, err, code)
+		assert.Equal(t, n, decoded)
+	}
+	_, err = h.Decode("!!!!!!!")
+	assert.Error(t, err)
+
+	_, err = NewHashids("secret", 7, "0123456789")
+	assert.Error(t, err, "字符集少于 16 个字符")
+}
+
+func TestNewSource(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:shortcode_source_test?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ShortLink{}, &model.CodeSequence{}))
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	for _, strategy := range []string{"", StrategyRandom, StrategyFeistel, StrategyHashids} {
+		source, err := NewSource(db, nil, Options{Strategy: strategy, Secret: "secret", SegmentStep: 100}, zap.NewNop().Sugar())
+		require.NoError(t, err, strategy)
+		code, err := source.Next(t.Context())
+		require.NoError(t, err, strategy)
+		assert.Len(t, code, DefaultCodeLength, strategy)
+		assert.True(t, source.Generatable(code), strategy)
+	}
+
+	// 号段预留记录在数据库中，之后预留的号段从上次的位置继续
+	counter := NewDBCounter(db, StrategyFeistel)
+	n, err := counter.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(101), n)
+
+	for _, opts := range []Options{
+		{Strategy: "uuid"},
+		{Charset: "aab"}, // 重复的字符
+		{Charset: "ab/"}, // 不允许的字符
+		{Length: 3},
+		{Strategy: StrategyFeistel, SegmentStore: "etcd"},
+	} {
+		_, err = NewSource(db, nil, opts, zap.NewNop().Sugar())
+		assert.Error(t, err, "%+v", opts)
+	}
+}
+
+func TestDeriveSecret(t *testing.T) {
+	secret, err := DeriveSecret("jwt-secret")
+	require.NoError(t, err)
+	again, _ := DeriveSecret("jwt-secret")
+	other, _ := DeriveSecret("another-secret")
+	assert.Equal(t, secret, again, "同一个 auth.secret 派生的密钥不变，短码映射才能保持稳定")
+	assert.NotEqual(t, secret, other)
+	assert.NotContains(t, secret, "jwt-secret")
+	assert.Len(t, secret, 64)
+}
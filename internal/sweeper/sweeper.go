@@ -0,0 +1,113 @@
+package sweeper
+
+import (
+	"context"
+	"shorturl-platform/internal/model"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultInterval 是未配置时的默认清理间隔
+	DefaultInterval = time.Minute
+	// batchSize 是每次清理处理的最大链接数
+	batchSize = 500
+)
+
+// Sweeper 定期停用已过期或点击预算已用完的短链接
+type Sweeper struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	interval time.Duration
+	stopChan chan struct{}
+	logger   *zap.SugaredLogger
+}
+
+// NewSweeper 创建一个新的过期链接清理器实例
+func NewSweeper(db *gorm.DB, redisClient *redis.Client, interval time.Duration, logger *zap.SugaredLogger) *Sweeper {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Sweeper{
+		db:       db,
+		redis:    redisClient,
+		interval: interval,
+		stopChan: make(chan struct{}),
+		logger:   logger.Named("link_sweeper"),
+	}
+}
+
+// Start 启动后台清理任务
+func (s *Sweeper) Start() {
+	s.logger.Infof("启动过期链接清理器，间隔 %s", s.interval)
+	go s.run()
+}
+
+// Stop 停止清理任务
+func (s *Sweeper) Stop() {
+	s.logger.Info("正在停止过期链接清理器...")
+	close(s.stopChan)
+}
+
+func (s *Sweeper) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.Sweep()
+	for {
+		select {
+		case <-ticker.C:
+			s.Sweep()
+		case <-s.stopChan:
+			s.logger.Info("已停止过期链接清理任务。")
+			return
+		}
+	}
+}
+
+// Sweep 执行一次清理，返回被停用的链接数量
+func (s *Sweeper) Sweep() int {
+	total := 0
+	for {
+		var links []model.ShortLink
+		err := s.db.Select("id", "short_code").
+			Where("is_active = ?", true).
+			Where("(expires_at IS NOT NULL AND expires_at <= ?) OR (max_clicks > 0 AND budget_used >= max_clicks)", time.Now()).
+			Limit(batchSize).
+			Find(&links).Error
+		if err != nil {
+			s.logger.Errorf("查询过期链接失败: %v", err)
+			return total
+		}
+		if len(links) == 0 {
+			break
+		}
+
+		ids := make([]uint, 0, len(links))
+		keys := make([]string, 0, len(links))
+		for _, link := range links {
+			ids = append(ids, link.ID)
+			keys = append(keys, "shortlink:"+link.ShortCode)
+		}
+		if err := s.db.Model(&model.ShortLink{}).Where("id IN ?", ids).Update("is_active", false).Error; err != nil {
+			s.logger.Errorf("停用过期链接失败: %v", err)
+			return total
+		}
+		if s.redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			s.redis.Del(ctx, keys...)
+			cancel()
+		}
+		total += len(links)
+		if len(links) < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		s.logger.Infof("已停用 %d 个过期链接。", total)
+	}
+	return total
+}
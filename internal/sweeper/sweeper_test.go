@@ -0,0 +1,70 @@
+package sweeper
+
+import (
+	"fmt"
+	"shorturl-platform/internal/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.ShortLink{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestSweeper_Sweep(t *testing.T) {
+	db := setupDB(t)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	links := map[string]model.ShortLink{
+		"expired":   {ExpiresAt: &past},
+		"exhausted": {MaxClicks: 3, BudgetUsed: 3, ClickCount: 1},
+		"future":    {ExpiresAt: &future},
+		"budget":    {MaxClicks: 3, BudgetUsed: 2, ClickCount: 5},
+		"forever":   {},
+	}
+	for code, link := range links {
+		link.ShortCode, link.OriginalURL, link.IsActive = code, "https://example.com/"+code, true
+		require.NoError(t, db.Create(&link).Error)
+	}
+
+	s := NewSweeper(db, nil, 0, zap.NewNop().Sugar())
+	assert.Equal(t, 2, s.Sweep())
+	for code := range links {
+		var link model.ShortLink
+		require.NoError(t, db.Where("short_code = ?", code).First(&link).Error)
+		want := code != "expired" && code != "exhausted"
+		assert.Equal(t, want, link.IsActive, code)
+	}
+
+	// 已停用的链接不会被重复处理
+	assert.Equal(t, 0, s.Sweep())
+}
+
+func TestSweeper_SweepInBatches(t *testing.T) {
+	db := setupDB(t)
+	past := time.Now().Add(-time.Minute)
+	links := make([]model.ShortLink, batchSize+10)
+	for i := range links {
+		links[i] = model.ShortLink{
+			ShortCode: fmt.Sprintf("code%d", i), OriginalURL: "https://example.com", IsActive: true, ExpiresAt: &past,
+		}
+	}
+	require.NoError(t, db.CreateInBatches(links, 100).Error)
+
+	assert.Equal(t, len(links), NewSweeper(db, nil, 0, zap.NewNop().Sugar()).Sweep())
+	var active int64
+	db.Model(&model.ShortLink{}).Where("is_active = ?", true).Count(&active)
+	assert.Zero(t, active)
+}
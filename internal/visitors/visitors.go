@@ -0,0 +1,297 @@
+package visitors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"shorturl-platform/pkg/hll"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DailyRetention 是按天统计的独立访客数据的保留时间
+const DailyRetention = 400 * 24 * time.Hour
+
+// Visit 是一次需要计入独立访客的访问
+type Visit struct {
+	LinkID      uint
+	Fingerprint string
+	Time        time.Time
+}
+
+// Counter 统计每个链接（总计和按天）的近似独立访客数
+type Counter interface {
+	// Add 批量记录访问
+	Add(ctx context.Context, visits []Visit) error
+	// Totals 返回每个链接自创建以来的独立访客数
+	Totals(ctx context.Context, linkIDs []uint) (map[uint]int64, error)
+	// Unions 返回链接在每组天数内的独立访客数（组内各天的并集），结果与 periods 一一对应
+	Unions(ctx context.Context, linkID uint, periods [][]time.Time) ([]int64, error)
+}
+
+// New 在 Redis 可用时返回基于 PFADD/PFCOUNT 的实现，否则返回进程内实现
+func New(rdb *redis.Client) Counter {
+	if rdb != nil {
+		return &RedisCounter{rdb: rdb}
+	}
+	return NewMemoryCounter()
+}
+
+// Fingerprint 根据 IP 和 User-Agent 计算访客指纹，只保存哈希值而不保存原始信息
+func Fingerprint(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "|" + userAgent))
+	return hex.EncodeToString(sum[:16])
+}
+
+// dayKey 返回某天（UTC）的键后缀
+func dayKey(t time.Time) string {
+	return t.UTC().Format("20060102")
+}
+
+func totalKey(linkID uint) string {
+	return fmt.Sprintf("uv:%d", linkID)
+}
+
+func dailyKey(linkID uint, day time.Time) string {
+	return fmt.Sprintf("uv:%d:%s", linkID, dayKey(day))
+}
+
+// RedisCounter 使用 Redis HyperLogLog 统计独立访客，多个实例共享同一份数据
+type RedisCounter struct {
+	rdb *redis.Client
+}
+
+// Add 使用管道批量执行 PFADD，按天的键会设置过期时间
+func (r *RedisCounter) Add(ctx context.Context, visits []Visit) error {
+	if len(visits) == 0 {
+		return nil
+	}
+	elements := make(map[string][]interface{})
+	daily := make(map[string]struct{})
+	for _, v := range visits {
+		tk, dk := totalKey(v.LinkID), dailyKey(v.LinkID, v.Time)
+		elements[tk] = append(elements[tk], v.Fingerprint)
+		elements[dk] = append(elements[dk], v.Fingerprint)
+		daily[dk] = struct{}{}
+	}
+
+	pipe := r.rdb.Pipeline()
+	for key, els := range elements {
+		pipe.PFAdd(ctx, key, els...)
+	}
+	for key := range daily {
+		pipe.Expire(ctx, key, DailyRetention)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Totals 使用管道批量执行 PFCOUNT
+func (r *RedisCounter) Totals(ctx context.Context, linkIDs []uint) (map[uint]int64, error) {
+	result := make(map[uint]int64, len(linkIDs))
+	if len(linkIDs) == 0 {
+		return result, nil
+	}
+	pipe := r.rdb.Pipeline()
+	cmds := make(map[uint]*redis.IntCmd, len(linkIDs))
+	for _, id := range linkIDs {
+		cmds[id] = pipe.PFCount(ctx, totalKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for id, cmd := range cmds {
+		result[id] = cmd.Val()
+	}
+	return result, nil
+}
+
+// Unions 使用管道批量执行 PFCOUNT，每组按天的键执行一次，Redis 会返回它们并集的基数
+func (r *RedisCounter) Unions(ctx context.Context, linkID uint, periods [][]time.Time) ([]int64, error) {
+	result := make([]int64, len(periods))
+	pipe := r.rdb.Pipeline()
+	cmds := make(map[int]*redis.IntCmd, len(periods))
+	for i, days := range periods {
+		if len(days) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(days))
+		for _, d := range days {
+			keys = append(keys, dailyKey(linkID, d))
+		}
+		cmds[i] = pipe.PFCount(ctx, keys...)
+	}
+	if len(cmds) == 0 {
+		return result, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		result[i] = cmd.Val()
+	}
+	return result, nil
+}
+
+// 进程内实现的内存上限：每个 Sketch 约 16KB，超过上限时淘汰最早过期的 Sketch
+const (
+	MaxMemorySketches   = 8192
+	memorySweepInterval = time.Hour
+)
+
+// MemoryCounter 是 Redis 不可用时的进程内实现，数据不会在实例之间共享，重启后丢失。
+// 按天的数据保留 DailyRetention，链接的总计在 DailyRetention 内没有新访问时清除；
+// Sketch 总数不超过 MaxMemorySketches，Start 后定期清理过期数据
+type MemoryCounter struct {
+	mu       sync.Mutex
+	sketches map[string]*hll.Sketch
+	expires  map[string]time.Time
+	now      func() time.Time
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemoryCounter 创建一个进程内的独立访客计数器
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{
+		sketches: make(map[string]*hll.Sketch),
+		expires:  make(map[string]time.Time),
+		now:      time.Now,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动后台清理，每 memorySweepInterval 删除一次过期数据
+func (m *MemoryCounter) Start() {
+	go func() {
+		ticker := time.NewTicker(memorySweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sweep()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理
+func (m *MemoryCounter) Stop() {
+	m.stopOnce.Do(func() { close(m.stopChan) })
+}
+
+// Add 记录访问，链接的总计在每次访问后重新计算过期时间
+func (m *MemoryCounter) Add(_ context.Context, visits []Visit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for _, v := range visits {
+		tk, dk := totalKey(v.LinkID), dailyKey(v.LinkID, v.Time)
+		m.sketch(tk, now.Add(DailyRetention)).Add([]byte(v.Fingerprint))
+		m.sketch(dk, v.Time.Add(DailyRetention)).Add([]byte(v.Fingerprint))
+	}
+	return nil
+}
+
+// sweep 删除已过期的数据
+func (m *MemoryCounter) sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for key, expireAt := range m.expires {
+		if now.After(expireAt) {
+			delete(m.sketches, key)
+			delete(m.expires, key)
+		}
+	}
+}
+
+// Totals 返回每个链接的独立访客数
+func (m *MemoryCounter) Totals(_ context.Context, linkIDs []uint) (map[uint]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(map[uint]int64, len(linkIDs))
+	for _, id := range linkIDs {
+		if s, ok := m.sketches[totalKey(id)]; ok {
+			result[id] = int64(s.Count())
+		} else {
+			result[id] = 0
+		}
+	}
+	return result, nil
+}
+
+// Unions 对每组天数合并各天的 Sketch 后计数
+func (m *MemoryCounter) Unions(_ context.Context, linkID uint, periods [][]time.Time) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]int64, len(periods))
+	for i, days := range periods {
+		n, err := m.union(linkID, days)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = n
+	}
+	return result, nil
+}
+
+// union 合并各天的 Sketch 后计数，调用方需持有锁
+func (m *MemoryCounter) union(linkID uint, days []time.Time) (int64, error) {
+	var union *hll.Sketch
+	for _, d := range days {
+		s, ok := m.sketches[dailyKey(linkID, d)]
+		if !ok {
+			continue
+		}
+		if union == nil {
+			union = s.Clone()
+		} else if err := union.Merge(s); err != nil {
+			return 0, err
+		}
+	}
+	if union == nil {
+		return 0, nil
+	}
+	return int64(union.Count()), nil
+}
+
+// sketch 返回 key 对应的 Sketch，不存在时创建，并把过期时间延后到 expireAt。
+// Sketch 数量达到上限时先淘汰最早过期的一个，调用方需持有锁
+func (m *MemoryCounter) sketch(key string, expireAt time.Time) *hll.Sketch {
+	s, ok := m.sketches[key]
+	if !ok {
+		if len(m.sketches) >= MaxMemorySketches {
+			m.evictOldest()
+		}
+		s = hll.New(hll.DefaultPrecision)
+		m.sketches[key] = s
+	}
+	if expireAt.After(m.expires[key]) {
+		m.expires[key] = expireAt
+	}
+	return s
+}
+
+// evictOldest 删除最早过期的 Sketch，调用方需持有锁
+func (m *MemoryCounter) evictOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for key, expireAt := range m.expires {
+		if oldest == "" || expireAt.Before(oldestAt) {
+			oldest, oldestAt = key, expireAt
+		}
+	}
+	delete(m.sketches, oldest)
+	delete(m.expires, oldest)
+}
@@ -0,0 +1,104 @@
+package visitors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// visitsOn 返回 n 个不同访客在 day 当天对 linkID 的访问，offset 用于区分不同批次的访客
+func visitsOn(linkID uint, day time.Time, offset, n int) []Visit {
+	visits := make([]Visit, n)
+	for i := range visits {
+		visits[i] = Visit{LinkID: linkID, Fingerprint: Fingerprint(fmt.Sprintf("10.0.0.%d", offset+i), "test"), Time: day}
+	}
+	return visits
+}
+
+// testCounter 检查 Counter 的通用行为，HyperLogLog 在小基数下是精确的
+func testCounter(t *testing.T, counter Counter, linkID uint) {
+	ctx := context.Background()
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2, day3 := day1.AddDate(0, 0, 1), day1.AddDate(0, 0, 2)
+
+	// 第一天 10 个访客，第二天其中 5 个再次访问并新增 5 个
+	require.NoError(t, counter.Add(ctx, visitsOn(linkID, day1, 0, 10)))
+	require.NoError(t, counter.Add(ctx, visitsOn(linkID, day2, 5, 10)))
+	require.NoError(t, counter.Add(ctx, nil))
+
+	totals, err := counter.Totals(ctx, []uint{linkID, linkID + 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[uint]int64{linkID: 15, linkID + 1: 0}, totals)
+
+	unions, err := counter.Unions(ctx, linkID, [][]time.Time{{day1}, {day2}, {day1, day2}, {day3}, nil})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 10, 15, 0, 0}, unions)
+}
+
+func TestMemoryCounter(t *testing.T) {
+	testCounter(t, NewMemoryCounter(), 1)
+}
+
+func TestMemoryCounter_Expiry(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCounter()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	old, recent := now.Add(-DailyRetention-time.Hour), now.Add(-time.Hour)
+	require.NoError(t, m.Add(ctx, visitsOn(1, old, 0, 3)))
+	require.NoError(t, m.Add(ctx, visitsOn(1, recent, 0, 3)))
+	require.NoError(t, m.Add(ctx, visitsOn(2, recent, 0, 2)))
+
+	// 超过保留时间的按天数据被清理，总计在有新访问时保留
+	m.sweep()
+	unions, err := m.Unions(ctx, 1, [][]time.Time{{old}, {recent}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 3}, unions)
+
+	// 链接在保留时间内没有新访问时总计也被清理
+	now = now.Add(DailyRetention + time.Minute)
+	require.NoError(t, m.Add(ctx, visitsOn(2, now, 10, 1)))
+	m.sweep()
+	totals, err := m.Totals(ctx, []uint{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, map[uint]int64{1: 0, 2: 3}, totals)
+}
+
+func TestMemoryCounter_MaxSketches(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryCounter()
+	day := time.Now()
+	for id := uint(1); id <= MaxMemorySketches; id++ {
+		require.NoError(t, m.Add(ctx, visitsOn(id, day, 0, 1)))
+	}
+	assert.Len(t, m.sketches, MaxMemorySketches)
+	assert.Len(t, m.expires, MaxMemorySketches)
+}
+
+// TestRedisCounter 需要一个可以清空的 Redis，通过 SHORTURL_TEST_REDIS 指定地址（例如 127.0.0.1:6379/15），未设置时跳过
+func TestRedisCounter(t *testing.T) {
+	url := os.Getenv("SHORTURL_TEST_REDIS")
+	if url == "" {
+		t.Skip("未设置 SHORTURL_TEST_REDIS，跳过 Redis 测试")
+	}
+	opts, err := redis.ParseURL("redis://" + url)
+	require.NoError(t, err)
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+	require.NoError(t, rdb.FlushDB(context.Background()).Err())
+
+	counter := New(rdb)
+	require.IsType(t, &RedisCounter{}, counter)
+	testCounter(t, counter, 1)
+
+	ttl, err := rdb.TTL(context.Background(), dailyKey(1, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0), "按天的键应设置过期时间")
+}
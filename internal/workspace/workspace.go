@@ -0,0 +1,297 @@
+// Package workspace 管理工作区及其成员。工作区中的短链接由成员共享，成员的角色决定可以执行的操作：
+// viewer 可以查看链接和统计，editor 还可以创建、修改和删除链接，owner 还可以管理成员和工作区本身。
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shorturl-platform/internal/model"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 成员角色
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Roles 所有成员角色，按权限从低到高排列
+var Roles = []string{RoleViewer, RoleEditor, RoleOwner}
+
+var (
+	// ErrNotFound 工作区不存在或当前用户不是成员
+	ErrNotFound = errors.New("工作区不存在")
+	// ErrMemberNotFound 成员不存在
+	ErrMemberNotFound = errors.New("成员不存在")
+	// ErrUserNotFound 要添加的用户不存在
+	ErrUserNotFound = errors.New("用户不存在")
+	// ErrAlreadyMember 用户已经是工作区成员
+	ErrAlreadyMember = errors.New("用户已经是工作区成员")
+	// ErrLastOwner 工作区至少需要保留一个所有者
+	ErrLastOwner = errors.New("工作区至少需要保留一个所有者")
+	// ErrNotEmpty 工作区中还有链接
+	ErrNotEmpty = errors.New("工作区中还有链接，请先删除或移走这些链接")
+)
+
+// SoleOwnerError 用户是这些工作区唯一的所有者，需要先转让所有权或删除工作区才能删除该用户
+type SoleOwnerError struct {
+	Workspaces []model.Workspace
+}
+
+func (e *SoleOwnerError) Error() string {
+	names := make([]string, 0, len(e.Workspaces))
+	for _, ws := range e.Workspaces {
+		names = append(names, ws.Name)
+	}
+	return fmt.Sprintf("用户是工作区 %s 唯一的所有者，请先转让所有权或删除工作区", strings.Join(names, "、"))
+}
+
+func (e *SoleOwnerError) Unwrap() error { return ErrLastOwner }
+
+// Allows 判断 role 是否具有 required 角色的权限
+func Allows(role, required string) bool {
+	have, need := slices.Index(Roles, role), slices.Index(Roles, required)
+	return have >= 0 && need >= 0 && have >= need
+}
+
+// Summary 是用户所在的工作区及其在其中的角色
+type Summary struct {
+	model.Workspace
+	Role string `json:"role"`
+}
+
+// Member 是工作区成员及其用户信息。不包含邮箱，避免所有者通过添加成员探测邮箱是否注册
+type Member struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Service 工作区服务
+type Service struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+// NewService 创建工作区服务
+func NewService(db *gorm.DB, logger *zap.SugaredLogger) *Service {
+	return &Service{db: db, logger: logger.Named("workspace")}
+}
+
+// Create 创建工作区，创建者成为所有者
+func (s *Service) Create(ctx context.Context, userID uint, name string) (*Summary, error) {
+	ws := model.Workspace{Name: name, CreatedBy: userID}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ws).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.WorkspaceMember{WorkspaceID: ws.ID, UserID: userID, Role: RoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infow("工作区已创建", "workspace_id", ws.ID, "name", name, "user_id", userID)
+	return &Summary{Workspace: ws, Role: RoleOwner}, nil
+}
+
+// List 返回用户所在的全部工作区
+func (s *Service) List(ctx context.Context, userID uint) ([]Summary, error) {
+	var result []Summary
+	err := s.db.WithContext(ctx).Model(&model.Workspace{}).
+		Select("workspaces.*, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.id").Scan(&result).Error
+	return result, err
+}
+
+// Role 返回用户在工作区中的角色，工作区不存在或用户不是成员时返回 ErrNotFound
+func (s *Service) Role(ctx context.Context, workspaceID, userID uint) (string, error) {
+	var member model.WorkspaceMember
+	err := s.db.WithContext(ctx).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// Exists 判断工作区是否存在
+func (s *Service) Exists(ctx context.Context, workspaceID uint) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&model.Workspace{}).Where("id = ?", workspaceID).Count(&count).Error
+	return count > 0, err
+}
+
+// Rename 修改工作区名称
+func (s *Service) Rename(ctx context.Context, workspaceID uint, name string) (*model.Workspace, error) {
+	var ws model.Workspace
+	if err := s.db.WithContext(ctx).First(&ws, workspaceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(&ws).Update("name", name).Error; err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// Delete 删除工作区及其成员关系，工作区中还有链接时返回 ErrNotEmpty
+func (s *Service) Delete(ctx context.Context, workspaceID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var links int64
+		if err := tx.Model(&model.ShortLink{}).Where("workspace_id = ?", workspaceID).Count(&links).Error; err != nil {
+			return err
+		}
+		if links > 0 {
+			return ErrNotEmpty
+		}
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(&model.WorkspaceMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&model.Workspace{}, workspaceID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// Members 返回工作区的成员列表
+func (s *Service) Members(ctx context.Context, workspaceID uint) ([]Member, error) {
+	var members []Member
+	err := s.db.WithContext(ctx).Model(&model.WorkspaceMember{}).
+		Select("workspace_members.user_id, users.username, workspace_members.role, workspace_members.created_at").
+		Joins("JOIN users ON users.id = workspace_members.user_id AND users.deleted_at IS NULL").
+		Where("workspace_members.workspace_id = ?", workspaceID).
+		Order("workspace_members.id").Scan(&members).Error
+	return members, err
+}
+
+// AddMember 按用户名或邮箱添加成员
+func (s *Service) AddMember(ctx context.Context, workspaceID uint, login, role string) (*Member, error) {
+	var user model.User
+	err := s.db.WithContext(ctx).Where("username = ? OR email = ?", login, login).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Role(ctx, workspaceID, user.ID); err == nil {
+		return nil, ErrAlreadyMember
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	member := model.WorkspaceMember{WorkspaceID: workspaceID, UserID: user.ID, Role: role}
+	if err := s.db.WithContext(ctx).Create(&member).Error; err != nil {
+		return nil, err
+	}
+	return &Member{UserID: user.ID, Username: user.Username, Role: role, CreatedAt: member.CreatedAt}, nil
+}
+
+// UpdateMember 修改成员角色，不能把最后一个所有者降级
+func (s *Service) UpdateMember(ctx context.Context, workspaceID, userID uint, role string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		member, err := findMember(tx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == RoleOwner && role != RoleOwner {
+			if err := ensureAnotherOwner(tx, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(member).Update("role", role).Error
+	})
+}
+
+// RemoveMember 移除成员，不能移除最后一个所有者
+func (s *Service) RemoveMember(ctx context.Context, workspaceID, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		member, err := findMember(tx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == RoleOwner {
+			if err := ensureAnotherOwner(tx, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(member).Error
+	})
+}
+
+func findMember(tx *gorm.DB, workspaceID, userID uint) (*model.WorkspaceMember, error) {
+	var member model.WorkspaceMember
+	err := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMemberNotFound
+	}
+	return &member, err
+}
+
+// RemoveUser 在删除用户的事务中调用，删除用户在所有工作区中的成员关系。
+// 用户是某个工作区唯一的所有者时返回 *SoleOwnerError，不做任何修改
+func RemoveUser(tx *gorm.DB, userID uint) error {
+	// 锁定用户担任所有者的工作区中全部所有者的成员关系，避免其他所有者同时被降级或移除
+	err := lockOwners(tx, tx.Model(&model.WorkspaceMember{}).Select("workspace_id").
+		Where("user_id = ? AND role = ?", userID, RoleOwner))
+	if err != nil {
+		return err
+	}
+
+	var owned []model.Workspace
+	err = tx.Model(&model.Workspace{}).
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ? AND workspace_members.role = ?", userID, RoleOwner).
+		Where("NOT EXISTS (?)", tx.Table("workspace_members AS others").Select("1").
+			Where("others.workspace_id = workspaces.id AND others.role = ? AND others.user_id <> ?", RoleOwner, userID)).
+		Order("workspaces.id").Find(&owned).Error
+	if err != nil {
+		return err
+	}
+	if len(owned) > 0 {
+		return &SoleOwnerError{Workspaces: owned}
+	}
+	return tx.Where("user_id = ?", userID).Delete(&model.WorkspaceMember{}).Error
+}
+
+// ensureAnotherOwner 确认除 userID 之外还有其他所有者。
+// 工作区的所有者行在事务结束前保持锁定，两个所有者同时降级对方时后提交的一方会看到只剩一个所有者
+func ensureAnotherOwner(tx *gorm.DB, workspaceID, userID uint) error {
+	var owners []model.WorkspaceMember
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("workspace_id = ? AND role = ?", workspaceID, RoleOwner).Find(&owners).Error
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(owners, func(m model.WorkspaceMember) bool { return m.UserID != userID }) {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// lockOwners 锁定 workspaceIDs 子查询中各工作区所有者的成员关系，直到事务结束
+func lockOwners(tx *gorm.DB, workspaceIDs *gorm.DB) error {
+	var owners []model.WorkspaceMember
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("workspace_id IN (?) AND role = ?", workspaceIDs, RoleOwner).Find(&owners).Error
+}
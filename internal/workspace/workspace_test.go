@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"shorturl-platform/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.ShortLink{}, &model.Workspace{}, &model.WorkspaceMember{}))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return NewService(db, zap.NewNop().Sugar()), db
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, Allows(RoleOwner, RoleEditor))
+	assert.True(t, Allows(RoleEditor, RoleEditor))
+	assert.True(t, Allows(RoleViewer, RoleViewer))
+	assert.False(t, Allows(RoleViewer, RoleEditor))
+	assert.False(t, Allows(RoleEditor, RoleOwner))
+	assert.False(t, Allows("", RoleViewer))
+	assert.False(t, Allows("admin", RoleViewer))
+}
+
+func TestService_Members(t *testing.T) {
+	s, db := newTestService(t)
+	ctx := t.Context()
+	alice := model.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	bob := model.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+
+	ws, err := s.Create(ctx, alice.ID, "市场部")
+	require.NoError(t, err)
+	assert.Equal(t, RoleOwner, ws.Role)
+
+	// 按邮箱添加成员，重复添加被拒绝
+	_, err = s.AddMember(ctx, ws.ID, "bob@example.com", RoleViewer)
+	require.NoError(t, err)
+	_, err = s.AddMember(ctx, ws.ID, "bob", RoleEditor)
+	assert.ErrorIs(t, err, ErrAlreadyMember)
+	_, err = s.AddMember(ctx, ws.ID, "nobody", RoleEditor)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	role, err := s.Role(ctx, ws.ID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RoleViewer, role)
+	_, err = s.Role(ctx, ws.ID+1, bob.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	list, err := s.List(ctx, bob.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "市场部", list[0].Name)
+	assert.Equal(t, RoleViewer, list[0].Role)
+
+	members, err := s.Members(ctx, ws.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, "alice", members[0].Username)
+	assert.Equal(t, RoleOwner, members[0].Role)
+
+	// 最后一个所有者不能被降级或移除
+	assert.ErrorIs(t, s.UpdateMember(ctx, ws.ID, alice.ID, RoleEditor), ErrLastOwner)
+	assert.ErrorIs(t, s.RemoveMember(ctx, ws.ID, alice.ID), ErrLastOwner)
+	require.NoError(t, s.UpdateMember(ctx, ws.ID, bob.ID, RoleOwner))
+	require.NoError(t, s.RemoveMember(ctx, ws.ID, alice.ID))
+	assert.ErrorIs(t, s.RemoveMember(ctx, ws.ID, alice.ID), ErrMemberNotFound)
+
+	// 工作区中还有链接时不能删除
+	link := model.ShortLink{UserID: bob.ID, WorkspaceID: ws.ID, ShortCode: "abc", OriginalURL: "https://example.com"}
+	require.NoError(t, db.Create(&link).Error)
+	assert.ErrorIs(t, s.Delete(ctx, ws.ID), ErrNotEmpty)
+	require.NoError(t, db.Delete(&link).Error)
+	require.NoError(t, s.Delete(ctx, ws.ID))
+	assert.ErrorIs(t, s.Delete(ctx, ws.ID), ErrNotFound)
+	list, err = s.List(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
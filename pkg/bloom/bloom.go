@@ -0,0 +1,165 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+const (
+	// DefaultCapacity 是第一层预期容纳的元素数量
+	DefaultCapacity = 100000
+	// DefaultFalsePositiveRate 是整体的目标误判率
+	DefaultFalsePositiveRate = 0.001
+
+	// growth 是每新增一层时容量的放大倍数
+	growth = 2
+	// tightening 是每新增一层时误判率的收紧比例，各层误判率之和收敛于目标误判率
+	tightening = 0.5
+)
+
+// layer 是一个容量固定的布隆过滤器
+type layer struct {
+	words    []uint64
+	m        uint64 // 位数
+	k        uint64 // 哈希函数个数
+	capacity uint64
+	count    uint64
+	set      uint64 // 已置位的位数
+}
+
+// newLayer 按容量 n 和误判率 p 计算位数 m = -n·ln(p)/ln²2 和哈希函数个数 k = m/n·ln2
+func newLayer(n uint64, p float64) *layer {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &layer{words: make([]uint64, (m+63)/64), m: m, k: k, capacity: n}
+}
+
+// add 置位元素对应的 k 个位置
+func (l *layer) add(h1, h2 uint64) {
+	for i := uint64(0); i < l.k; i++ {
+		pos := (h1 + i*h2) % l.m
+		word, mask := pos/64, uint64(1)<<(pos%64)
+		if l.words[word]&mask == 0 {
+			l.words[word] |= mask
+			l.set++
+		}
+	}
+	l.count++
+}
+
+// test 判断元素对应的 k 个位置是否都已置位
+func (l *layer) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < l.k; i++ {
+		pos := (h1 + i*h2) % l.m
+		if l.words[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// falsePositiveRate 根据实际置位比例估算当前的误判率
+func (l *layer) falsePositiveRate() float64 {
+	return math.Pow(float64(l.set)/float64(l.m), float64(l.k))
+}
+
+// Stats 是过滤器的运行状态
+type Stats struct {
+	Items             uint64  `json:"items"`               // 已添加的元素数量（重复添加只计一次，误判为已存在的元素不计入）
+	Capacity          uint64  `json:"capacity"`            // 各层容量之和
+	Layers            int     `json:"layers"`              // 层数
+	Bits              uint64  `json:"bits"`                // 各层位数之和
+	FillRatio         float64 `json:"fill_ratio"`          // 已置位的比例
+	FalsePositiveRate float64 `json:"false_positive_rate"` // 按置位比例估算的误判率
+}
+
+// Scalable 是可扩展的布隆过滤器（Scalable Bloom Filter）：当前层装满后新增一层，
+// 新层容量翻倍、误判率减半，元素数量超出预期时整体误判率仍然有上界。Scalable 是并发安全的
+type Scalable struct {
+	mu     sync.RWMutex
+	layers []*layer
+	p      float64 // 最新一层的误判率
+}
+
+// New 创建可扩展布隆过滤器，capacity 为第一层的容量，p 为整体的目标误判率，参数无效时使用默认值
+func New(capacity uint64, p float64) *Scalable {
+	if capacity == 0 {
+		capacity = DefaultCapacity
+	}
+	if p <= 0 || p >= 1 {
+		p = DefaultFalsePositiveRate
+	}
+	first := p * (1 - tightening)
+	return &Scalable{layers: []*layer{newLayer(capacity, first)}, p: first}
+}
+
+// Add 添加一个元素，元素可能已存在时不会重复添加，返回是否为新元素
+func (s *Scalable) Add(data []byte) bool {
+	h1, h2 := hash128(data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.test(h1, h2) {
+		return false
+	}
+	current := s.layers[len(s.layers)-1]
+	if current.count >= current.capacity {
+		s.p *= tightening
+		current = newLayer(current.capacity*growth, s.p)
+		s.layers = append(s.layers, current)
+	}
+	current.add(h1, h2)
+	return true
+}
+
+// Test 判断元素是否可能存在，返回 false 时元素一定没有被添加过
+func (s *Scalable) Test(data []byte) bool {
+	h1, h2 := hash128(data)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.test(h1, h2)
+}
+
+func (s *Scalable) test(h1, h2 uint64) bool {
+	for _, l := range s.layers {
+		if l.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats 返回过滤器的运行状态
+func (s *Scalable) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := Stats{Layers: len(s.layers)}
+	var set uint64
+	miss := 1.0
+	for _, l := range s.layers {
+		stats.Items += l.count
+		stats.Capacity += l.capacity
+		stats.Bits += l.m
+		set += l.set
+		miss *= 1 - l.falsePositiveRate()
+	}
+	stats.FillRatio = float64(set) / float64(stats.Bits)
+	stats.FalsePositiveRate = 1 - miss
+	return stats
+}
+
+// hash128 计算 FNV-1a 128 位哈希，拆成两个 64 位值用于双重哈希
+func hash128(data []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write(data)
+	sum := h.Sum(nil)
+	// 第二个哈希取奇数，避免步长为 0 时 k 个位置重合
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
@@ -0,0 +1,51 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScalable_AddTest(t *testing.T) {
+	s := New(1000, 0.01)
+	assert.False(t, s.Test([]byte("code-0")))
+
+	// 元素数量远超第一层容量，过滤器应自动扩展且不漏判
+	const n = 20000
+	for i := 0; i < n; i++ {
+		s.Add([]byte("code-" + strconv.Itoa(i)))
+	}
+	for i := 0; i < n; i++ {
+		assert.True(t, s.Test([]byte("code-"+strconv.Itoa(i))))
+	}
+	assert.False(t, s.Add([]byte("code-1")), "重复添加应返回 false")
+
+	stats := s.Stats()
+	assert.Greater(t, stats.Layers, 1)
+	assert.GreaterOrEqual(t, stats.Capacity, stats.Items)
+	assert.InDelta(t, n, stats.Items, n*0.01)
+	assert.Greater(t, stats.FillRatio, 0.0)
+	assert.Less(t, stats.FillRatio, 1.0)
+
+	// 实际误判率应接近目标误判率
+	falsePositives := 0
+	const probes = 100000
+	for i := 0; i < probes; i++ {
+		if s.Test([]byte("other-" + strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+	rate := float64(falsePositives) / probes
+	assert.Less(t, rate, 0.02, "实际误判率 %.4f 过高", rate)
+	assert.Less(t, stats.FalsePositiveRate, 0.02)
+}
+
+func TestNew_Defaults(t *testing.T) {
+	s := New(0, 2)
+	stats := s.Stats()
+	assert.Equal(t, uint64(DefaultCapacity), stats.Capacity)
+	assert.Equal(t, 1, stats.Layers)
+	assert.Equal(t, 0.0, stats.FillRatio)
+	assert.Equal(t, 0.0, stats.FalsePositiveRate)
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// IsUniqueViolation 判断 err 是否为唯一约束冲突。错误码由方言翻译：MySQL 为 1062，SQLite 为 UNIQUE/PRIMARY KEY 约束失败，
+// 不需要在打开数据库时开启 TranslateError
+func IsUniqueViolation(db *gorm.DB, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		return errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+	}
+	return false
+}
@@ -18,14 +18,33 @@ func InitMySQL(host string, port int, user, password, dbName string) (*gorm.DB,
 		return nil, fmt.Errorf("数据库连接失败: %v", err)
 	}
 
+	// 旧版本用 click_count 扣减点击预算，新增 budget_used 列时从 click_count 继承已使用的预算
+	backfillBudget := connection.Migrator().HasTable(&model.ShortLink{}) &&
+		!connection.Migrator().HasColumn(&model.ShortLink{}, "BudgetUsed")
+
 	// 自动迁移表
 	err = connection.AutoMigrate(
 		&model.ShortLink{},
 		&model.User{},
+		&model.ClickRecord{},
+		&model.RefreshToken{},
+		&model.APIKey{},
+		&model.UserIdentity{},
+		&model.RecoveryCode{},
+		&model.Workspace{},
+		&model.WorkspaceMember{},
+		&model.CodeSequence{},
 	)
 	if err != nil {
 		return nil, fmt.Errorf("数据库迁移失败: %v", err)
 	}
+	if backfillBudget {
+		err = connection.Model(&model.ShortLink{}).Where("max_clicks > 0").
+			Update("budget_used", gorm.Expr("click_count")).Error
+		if err != nil {
+			return nil, fmt.Errorf("迁移点击预算失败: %v", err)
+		}
+	}
 
 	return connection, nil
 }
@@ -0,0 +1,145 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultReloadInterval 是检查数据库文件是否变更的默认间隔
+const DefaultReloadInterval = time.Minute
+
+// Location 是 IP 地址对应的地理位置
+type Location struct {
+	Country string // ISO 3166-1 国家代码，例如 CN、US
+	City    string
+}
+
+// Locator 将 IP 地址解析为地理位置
+type Locator interface {
+	Lookup(ip string) Location
+}
+
+// NopLocator 是未配置 GeoIP 数据库时使用的空实现
+type NopLocator struct{}
+
+// Lookup 总是返回空位置
+func (NopLocator) Lookup(string) Location {
+	return Location{}
+}
+
+// FileLocator 从本地 MMDB 文件解析地理位置，并在文件变更时自动重新加载
+type FileLocator struct {
+	path     string
+	language string
+	interval time.Duration
+	reader   atomic.Pointer[Reader]
+	modTime  time.Time
+	stopChan chan struct{}
+	logger   *zap.SugaredLogger
+}
+
+// NewFileLocator 加载 MMDB 文件并创建 FileLocator；language 用于选择城市名称的语言，默认 en
+func NewFileLocator(path, language string, interval time.Duration, logger *zap.SugaredLogger) (*FileLocator, error) {
+	if language == "" {
+		language = "en"
+	}
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	l := &FileLocator{
+		path:     path,
+		language: language,
+		interval: interval,
+		stopChan: make(chan struct{}),
+		logger:   logger.Named("geoip"),
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Start 启动后台任务，定期检查数据库文件是否变更
+func (l *FileLocator) Start() {
+	go l.watch()
+}
+
+// Stop 停止后台检查任务
+func (l *FileLocator) Stop() {
+	close(l.stopChan)
+}
+
+// Lookup 解析 IP 地址，无法解析时返回空位置
+func (l *FileLocator) Lookup(ip string) Location {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Location{}
+	}
+	record, err := l.reader.Load().Lookup(parsed)
+	if err != nil || record == nil {
+		return Location{}
+	}
+
+	var loc Location
+	country, ok := record["country"].(map[string]interface{})
+	if !ok {
+		country, _ = record["registered_country"].(map[string]interface{})
+	}
+	loc.Country, _ = country["iso_code"].(string)
+	if city, ok := record["city"].(map[string]interface{}); ok {
+		if names, ok := city["names"].(map[string]interface{}); ok {
+			if name, ok := names[l.language].(string); ok {
+				loc.City = name
+			} else {
+				loc.City, _ = names["en"].(string)
+			}
+		}
+	}
+	return loc
+}
+
+// load 读取数据库文件并原子地替换当前的 Reader
+func (l *FileLocator) load() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	reader, err := Open(l.path)
+	if err != nil {
+		return err
+	}
+	l.reader.Store(reader)
+	l.modTime = info.ModTime()
+	meta := reader.Metadata()
+	l.logger.Infof("已加载 GeoIP 数据库 %s (%s, %d 个节点)", l.path, meta.DatabaseType, meta.NodeCount)
+	return nil
+}
+
+func (l *FileLocator) watch() {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(l.path)
+			if err != nil {
+				l.logger.Warnf("检查 GeoIP 数据库失败: %v", err)
+				continue
+			}
+			if info.ModTime().Equal(l.modTime) {
+				continue
+			}
+			// 加载失败时继续使用旧的数据库
+			if err := l.load(); err != nil {
+				l.logger.Errorf("重新加载 GeoIP 数据库失败: %v", err)
+			}
+		case <-l.stopChan:
+			return
+		}
+	}
+}
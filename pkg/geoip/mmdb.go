@@ -0,0 +1,381 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataStartMarker 标记 MaxMind DB 文件中元数据段的起始位置
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparatorSize 是搜索树与数据段之间的分隔字节数
+const dataSectionSeparatorSize = 16
+
+// maxDecodeDepth 是 map 和数组的最大嵌套层数，与 libmaxminddb 一致。
+// 指针可以指向包含自身的 map，没有层数限制时构造的文件会导致无限递归
+const maxDecodeDepth = 512
+
+// 数据段中的字段类型，参见 MaxMind DB 文件格式规范
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// ErrInvalidDatabase 表示文件不是合法的 MaxMind DB 格式
+var ErrInvalidDatabase = errors.New("无效的 MaxMind DB 文件")
+
+// Metadata 是 MaxMind DB 文件的元数据
+type Metadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+	BuildEpoch   uint
+}
+
+// Reader 是一个只读的 MaxMind DB (MMDB) 文件解析器，整个文件会被读入内存
+type Reader struct {
+	buf          []byte
+	metadata     Metadata
+	nodeByteSize uint
+	treeSize     uint
+	ipv4Start    uint
+}
+
+// Open 读取并解析一个 MMDB 文件
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes 从内存中的数据创建 Reader
+func FromBytes(buf []byte) (*Reader, error) {
+	markerIndex := bytes.LastIndex(buf, metadataStartMarker)
+	if markerIndex < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaDecoder := decoder{buf: buf[markerIndex+len(metadataStartMarker):]}
+	raw, _, err := metaDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("解析元数据失败: %w", err)
+	}
+	meta, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	r := &Reader{buf: buf}
+	r.metadata.NodeCount = toUint(meta["node_count"])
+	r.metadata.RecordSize = toUint(meta["record_size"])
+	r.metadata.IPVersion = toUint(meta["ip_version"])
+	r.metadata.BuildEpoch = toUint(meta["build_epoch"])
+	r.metadata.DatabaseType, _ = meta["database_type"].(string)
+
+	switch r.metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的记录大小 %d", ErrInvalidDatabase, r.metadata.RecordSize)
+	}
+	if r.metadata.IPVersion != 4 && r.metadata.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: 不支持的 IP 版本 %d", ErrInvalidDatabase, r.metadata.IPVersion)
+	}
+
+	r.nodeByteSize = r.metadata.RecordSize / 4
+	r.treeSize = r.metadata.NodeCount * r.nodeByteSize
+	if r.treeSize+dataSectionSeparatorSize > uint(markerIndex) {
+		return nil, fmt.Errorf("%w: 搜索树超出文件范围", ErrInvalidDatabase)
+	}
+
+	// IPv6 数据库中，IPv4 地址位于 ::/96 子树下
+	if r.metadata.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.metadata.NodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Metadata 返回数据库元数据
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup 查找 IP 对应的记录，未找到时返回 nil
+func (r *Reader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	offset, err := r.lookupOffset(ip)
+	if err != nil || offset == 0 {
+		return nil, err
+	}
+	d := decoder{buf: r.buf[r.treeSize+dataSectionSeparatorSize:]}
+	value, _, err := d.decode(offset-r.metadata.NodeCount-dataSectionSeparatorSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// lookupOffset 遍历搜索树，返回数据记录指针，未找到时返回 0
+func (r *Reader) lookupOffset(ip net.IP) (uint, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if r.metadata.IPVersion == 4 {
+		return 0, fmt.Errorf("IPv4 数据库无法查询 IPv6 地址 %s", ip)
+	}
+	if ip == nil {
+		return 0, errors.New("无效的 IP 地址")
+	}
+
+	node := uint(0)
+	if len(ip) == net.IPv4len && r.metadata.IPVersion == 6 {
+		node = r.ipv4Start
+	}
+	bitCount := uint(len(ip) * 8)
+	for i := uint(0); i < bitCount && node < r.metadata.NodeCount; i++ {
+		bit := (ip[i>>3] >> (7 - (i & 7))) & 1
+		node = r.readNode(node, uint(bit))
+	}
+
+	switch {
+	case node == r.metadata.NodeCount:
+		return 0, nil
+	case node > r.metadata.NodeCount:
+		return node, nil
+	default:
+		return 0, fmt.Errorf("%w: 搜索树无效", ErrInvalidDatabase)
+	}
+}
+
+// readNode 读取节点的左 (bit=0) 或右 (bit=1) 记录
+func (r *Reader) readNode(node, bit uint) uint {
+	b := r.buf[node*r.nodeByteSize : (node+1)*r.nodeByteSize]
+	switch r.metadata.RecordSize {
+	case 24:
+		off := bit * 3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := bit * 4
+		return uint(binary.BigEndian.Uint32(b[off : off+4]))
+	}
+}
+
+// decoder 解析 MMDB 数据段中的值
+type decoder struct {
+	buf []byte
+}
+
+// decode 解析 offset 处的值，返回该值以及其后的偏移量，depth 是当前所在的 map 和数组层数
+func (d *decoder) decode(offset, depth uint) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("%w: 数据嵌套层数超过 %d", ErrInvalidDatabase, maxDecodeDepth)
+	}
+	typeNum, size, offset, err := d.decodeCtrl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typeNum == typePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// 规范不允许指针指向指针，拒绝指针链可以避免指针之间互相引用形成的循环
+		targetType, targetSize, targetOffset, err := d.decodeCtrl(pointer)
+		if err != nil {
+			return nil, 0, err
+		}
+		if targetType == typePointer {
+			return nil, 0, fmt.Errorf("%w: 指针指向了另一个指针", ErrInvalidDatabase)
+		}
+		value, _, err := d.decodeValue(targetType, targetSize, targetOffset, depth)
+		return value, next, err
+	}
+	return d.decodeValue(typeNum, size, offset, depth)
+}
+
+// decodeCtrl 解析控制字节，返回字段类型、大小以及数据起始偏移
+func (d *decoder) decodeCtrl(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typeNum := int(ctrl >> 5)
+	if typeNum == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, ErrInvalidDatabase
+		}
+		typeNum = int(d.buf[offset]) + 7
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if typeNum == typePointer || size < 29 {
+		return typeNum, size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > uint(len(d.buf)) {
+		return 0, 0, 0, ErrInvalidDatabase
+	}
+	n := uint(0)
+	for _, b := range d.buf[offset : offset+extra] {
+		n = n<<8 | uint(b)
+	}
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return typeNum, size, offset + extra, nil
+}
+
+// decodePointer 解析指针，返回指向的数据段偏移以及指针之后的偏移
+func (d *decoder) decodePointer(size, offset uint) (uint, uint, error) {
+	pointerSize := ((size >> 3) & 0x3) + 1
+	if offset+pointerSize > uint(len(d.buf)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	prefix := uint(0)
+	if pointerSize != 4 {
+		prefix = size & 0x7
+	}
+	n := prefix
+	for _, b := range d.buf[offset : offset+pointerSize] {
+		n = n<<8 | uint(b)
+	}
+	switch pointerSize {
+	case 2:
+		n += 2048
+	case 3:
+		n += 526336
+	}
+	return n, offset + pointerSize, nil
+}
+
+// decodeValue 解析控制字节之后的值。map 和数组的元素数量来自文件，分配内存前先确认剩余数据足以容纳这些元素
+func (d *decoder) decodeValue(typeNum int, size, offset, depth uint) (interface{}, uint, error) {
+	remaining := uint(0)
+	if offset < uint(len(d.buf)) {
+		remaining = uint(len(d.buf)) - offset
+	}
+	switch typeNum {
+	case typeMap:
+		// 每个键值对至少占两个控制字节
+		if size > remaining/2 {
+			return nil, 0, fmt.Errorf("%w: map 大小超出数据范围", ErrInvalidDatabase)
+		}
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map 的键不是字符串", ErrInvalidDatabase)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		// 每个元素至少占一个控制字节
+		if size > remaining {
+			return nil, 0, fmt.Errorf("%w: 数组大小超出数据范围", ErrInvalidDatabase)
+		}
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if size > remaining {
+		return nil, 0, ErrInvalidDatabase
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+	switch typeNum {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		n := uint64(0)
+		for _, v := range b {
+			n = n<<8 | uint64(v)
+		}
+		return n, next, nil
+	case typeInt32:
+		n := int32(0)
+		for _, v := range b {
+			n = n<<8 | int32(v)
+		}
+		return n, next, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: 未知的字段类型 %d", ErrInvalidDatabase, typeNum)
+	}
+}
+
+// toUint 将元数据中的无符号整数转换为 uint
+func toUint(v interface{}) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
@@ -0,0 +1,156 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// encodeValue 按 MMDB 格式编码测试所需的字符串、无符号整数和 map
+func encodeValue(v interface{}) []byte {
+	ctrl := func(typeNum, size int) []byte {
+		return []byte{byte(typeNum<<5 | size)}
+	}
+	switch val := v.(type) {
+	case string:
+		return append(ctrl(typeString, len(val)), val...)
+	case uint32:
+		b := []byte{byte(val >> 24), byte(val >> 16), byte(val >> 8), byte(val)}
+		return append(ctrl(typeUint32, 4), b...)
+	case uint16:
+		return append(ctrl(typeUint16, 2), byte(val>>8), byte(val))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := ctrl(typeMap, len(val))
+		for _, k := range keys {
+			out = append(out, encodeValue(k)...)
+			out = append(out, encodeValue(val[k])...)
+		}
+		return out
+	}
+	panic("不支持的类型")
+}
+
+// buildIPv4Database 构建一个 24 位记录的 IPv4 数据库，只包含一个 /24 网段
+func buildIPv4Database(prefix net.IP, record map[string]interface{}) []byte {
+	return buildIPv4DatabaseRaw(prefix, encodeValue(record))
+}
+
+// buildIPv4DatabaseRaw 与 buildIPv4Database 相同，数据段直接使用 data，用于构造损坏的记录
+func buildIPv4DatabaseRaw(prefix net.IP, data []byte) []byte {
+	const nodeCount = 24
+	ip := prefix.To4()
+	dataPointer := uint32(nodeCount + dataSectionSeparatorSize) // 数据段偏移 0
+
+	var tree []byte
+	for i := 0; i < nodeCount; i++ {
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			next = dataPointer
+		}
+		left, right := uint32(nodeCount), uint32(nodeCount)
+		if bit == 0 {
+			left = next
+		} else {
+			right = next
+		}
+		tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+	}
+
+	buf := append(tree, make([]byte, dataSectionSeparatorSize)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataStartMarker...)
+	buf = append(buf, encodeValue(map[string]interface{}{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(4),
+		"database_type": "Test-City",
+	})...)
+	return buf
+}
+
+func TestReader_Lookup(t *testing.T) {
+	db := buildIPv4Database(net.ParseIP("1.2.3.0"), map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "CN"},
+		"city":    map[string]interface{}{"names": map[string]interface{}{"en": "Beijing"}},
+	})
+	r, err := FromBytes(db)
+	require.NoError(t, err)
+	assert.Equal(t, "Test-City", r.Metadata().DatabaseType)
+
+	record, err := r.Lookup(net.ParseIP("1.2.3.200"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"iso_code": "CN"}, record["country"])
+
+	record, err = r.Lookup(net.ParseIP("1.2.4.1"))
+	require.NoError(t, err)
+	assert.Nil(t, record, "不在网段内的地址应查不到记录")
+}
+
+func TestReader_LookupMalformedRecord(t *testing.T) {
+	nested := bytes.Repeat([]byte{0x01, typeArray - 7}, maxDecodeDepth+1) // 一层套一层的单元素数组
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// 偏移 0 的指针指向偏移 2 的指针，后者又指回偏移 0
+		{"指针指向指针", []byte{0x20, 0x02, 0x20, 0x00}},
+		// map 唯一的值是指向该 map 自身的指针
+		{"指针循环", []byte{0xE1, 0x41, 'a', 0x20, 0x00}},
+		{"嵌套过深", append(nested, encodeValue("x")...)},
+		// 声明约 1600 万个键值对，实际没有数据
+		{"map 大小超出范围", []byte{0xFF, 0xFF, 0xFF, 0xFF}},
+		{"数组大小超出范围", []byte{0x1F, typeArray - 7, 0xFF, 0xFF, 0xFF}},
+		{"字符串超出范围", []byte{0x5F, 0xFF, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := FromBytes(buildIPv4DatabaseRaw(net.ParseIP("1.2.3.0"), tt.data))
+			require.NoError(t, err)
+			_, err = r.Lookup(net.ParseIP("1.2.3.4"))
+			assert.ErrorIs(t, err, ErrInvalidDatabase)
+		})
+	}
+}
+
+func TestFileLocator_LookupAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	write := func(city string, modTime time.Time) {
+		db := buildIPv4Database(net.ParseIP("1.2.3.0"), map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "CN"},
+			"city":    map[string]interface{}{"names": map[string]interface{}{"en": city}},
+		})
+		require.NoError(t, os.WriteFile(path, db, 0o644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("Beijing", start)
+	l, err := NewFileLocator(path, "", 10*time.Millisecond, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	l.Start()
+	defer l.Stop()
+
+	assert.Equal(t, Location{Country: "CN", City: "Beijing"}, l.Lookup("1.2.3.4"))
+	assert.Equal(t, Location{}, l.Lookup("8.8.8.8"))
+	assert.Equal(t, Location{}, l.Lookup("not-an-ip"))
+
+	// 文件变更后自动重新加载
+	write("Shanghai", start.Add(time.Minute))
+	assert.Eventually(t, func() bool {
+		return l.Lookup("1.2.3.4").City == "Shanghai"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,112 @@
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// MinPrecision 和 MaxPrecision 是允许的精度范围，寄存器数量为 2^precision
+	MinPrecision = 4
+	MaxPrecision = 16
+	// DefaultPrecision 对应 4096 个寄存器，标准误差约 1.6%
+	DefaultPrecision = 12
+)
+
+// ErrPrecisionMismatch 表示合并了精度不同的两个 Sketch
+var ErrPrecisionMismatch = errors.New("hll: 精度不一致，无法合并")
+
+// Sketch 是一个 HyperLogLog 基数估计器，用于在固定内存内估算不重复元素的数量。
+// Sketch 不是并发安全的，调用方需要自行加锁。
+type Sketch struct {
+	precision uint8
+	registers []uint8
+}
+
+// New 创建一个指定精度的 Sketch，精度超出范围时使用 DefaultPrecision
+func New(precision uint8) *Sketch {
+	if precision < MinPrecision || precision > MaxPrecision {
+		precision = DefaultPrecision
+	}
+	return &Sketch{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+// Add 添加一个元素
+func (s *Sketch) Add(data []byte) {
+	h := hash64(data)
+	idx := h >> (64 - s.precision)
+	// 在剩余位的末尾补 1，保证 rho 不会超过 64-precision+1
+	w := h<<s.precision | 1<<(s.precision-1)
+	rho := uint8(bits.LeadingZeros64(w)) + 1
+	if rho > s.registers[idx] {
+		s.registers[idx] = rho
+	}
+}
+
+// Count 返回不重复元素数量的估计值
+func (s *Sketch) Count() uint64 {
+	m := float64(len(s.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += 1.0 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(s.registers)) * m * m / sum
+	// 小基数时使用线性计数修正
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge 将另一个 Sketch 合并进来，合并后的估计值为两者并集的基数
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.precision != other.precision {
+		return ErrPrecisionMismatch
+	}
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Clone 返回 Sketch 的副本
+func (s *Sketch) Clone() *Sketch {
+	c := &Sketch{precision: s.precision, registers: make([]uint8, len(s.registers))}
+	copy(c.registers, s.registers)
+	return c
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// hash64 使用 FNV-1a 计算哈希，并用 MurmurHash3 的 fmix64 打散低熵输入
+func hash64(data []byte) uint64 {
+	f := fnv.New64a()
+	f.Write(data)
+	h := f.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
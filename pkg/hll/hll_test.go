@@ -0,0 +1,42 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch_Count(t *testing.T) {
+	s := New(DefaultPrecision)
+	assert.Equal(t, uint64(0), s.Count())
+
+	const n = 50000
+	for i := 0; i < n; i++ {
+		s.Add([]byte("visitor-" + strconv.Itoa(i)))
+	}
+	// 重复添加不应改变估计值
+	before := s.Count()
+	for i := 0; i < 1000; i++ {
+		s.Add([]byte("visitor-" + strconv.Itoa(i)))
+	}
+	assert.Equal(t, before, s.Count())
+
+	errRate := math.Abs(float64(before)-n) / n
+	assert.Less(t, errRate, 0.05, "估计值 %d 与实际值 %d 的误差过大", before, n)
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b := New(DefaultPrecision), New(DefaultPrecision)
+	for i := 0; i < 100; i++ {
+		a.Add([]byte("a-" + strconv.Itoa(i)))
+		b.Add([]byte("b-" + strconv.Itoa(i)))
+	}
+	union := a.Clone()
+	assert.NoError(t, union.Merge(b))
+	assert.InDelta(t, 200, float64(union.Count()), 5)
+	assert.InDelta(t, 100, float64(a.Count()), 3, "Clone 后合并不应修改原 Sketch")
+
+	assert.ErrorIs(t, a.Merge(New(10)), ErrPrecisionMismatch)
+}
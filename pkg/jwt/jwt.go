@@ -1,56 +1,120 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenManager 签发和验证访问令牌。配置了非对称密钥时使用 RS256/EdDSA 签名并在头部写入 kid，
+// 否则使用 auth.secret 进行 HS256 签名
 type TokenManager struct {
 	secretKey  string
 	issuer     string
 	expiration time.Duration
+	keys       *KeySet
+	now        func() time.Time
 }
 
+// 登录方式 (amr 声明)，取值参考 RFC 8176
+const (
+	AMRPassword = "pwd"  // 用户名和密码
+	AMROTP      = "otp"  // TOTP 一次性验证码
+	AMRMFA      = "mfa"  // 通过了多因素认证
+	AMROIDC     = "oidc" // 外部身份提供方登录
+)
+
+// Claims 访问令牌携带的声明，jti (RegisteredClaims.ID) 用于单独撤销某个令牌，
+// sid 是签发该令牌的登录会话（即刷新令牌家族），用于撤销整个会话，amr 是该会话的登录方式，
+// pwd_change 表示用户必须先修改密码，此时令牌只能用于修改密码
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID         uint     `json:"user_id"`
+	Username       string   `json:"username"`
+	Role           string   `json:"role"`
+	SessionID      string   `json:"sid,omitempty"`
+	AMR            []string `json:"amr,omitempty"`
+	PasswordChange bool     `json:"pwd_change,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewManager(secret, issuer string, expirationHours int) *TokenManager {
+// HasMFA 判断令牌所属的会话是否通过了多因素认证
+func (c *Claims) HasMFA() bool {
+	return slices.Contains(c.AMR, AMRMFA)
+}
+
+func NewManager(secret, issuer string, expiration time.Duration) *TokenManager {
 	return &TokenManager{
 		secretKey:  secret,
 		issuer:     issuer,
-		expiration: time.Duration(expirationHours) * time.Hour,
+		expiration: expiration,
+		now:        time.Now,
+	}
+}
+
+// NewKeyManager 创建使用非对称密钥签名的 TokenManager
+func NewKeyManager(issuer string, expiration time.Duration, keys []*SigningKey) (*TokenManager, error) {
+	set, err := NewKeySet(keys)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := set.Signing(time.Now(), expiration); err != nil {
+		return nil, err
 	}
+	return &TokenManager{issuer: issuer, expiration: expiration, keys: set, now: time.Now}, nil
 }
 
-func (m *TokenManager) GenerateToken(userID uint, username, role string) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    m.issuer,
-		},
+// JWKS 返回可用于验证令牌的公钥集合，使用 HS256 时为空
+func (m *TokenManager) JWKS() JWKS {
+	if m.keys == nil {
+		return JWKS{Keys: []JWK{}}
 	}
+	return m.keys.JWKS(m.now())
+}
+
+// Expiration 返回访问令牌的有效期
+func (m *TokenManager) Expiration() time.Duration {
+	return m.expiration
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+func (m *TokenManager) GenerateToken(userID uint, username, role, sessionID string, amr []string) (string, error) {
+	return m.Sign(Claims{UserID: userID, Username: username, Role: role, SessionID: sessionID, AMR: amr})
+}
+
+// Sign 签发访问令牌，jti、签发时间、过期时间和签发者由 TokenManager 填写
+func (m *TokenManager) Sign(c Claims) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := m.now()
+	claims := &c
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		ExpiresAt: jwt.NewNumericDate(now.Add(m.expiration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Issuer:    m.issuer,
+	}
+
+	if m.keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(m.secretKey))
+	}
+
+	key, err := m.keys.Signing(now, m.expiration)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
 func (m *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(m.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, m.keyFunc, jwt.WithTimeFunc(m.now))
 
 	if err != nil {
 		return nil, err
@@ -62,3 +126,32 @@ func (m *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// keyFunc 按签名方式和 kid 选择验证密钥，拒绝与密钥类型不匹配的算法
+func (m *TokenManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	if m.keys == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(m.secretKey), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, err := m.keys.Verification(kid, m.now())
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Private.Public(), nil
+}
+
+// newTokenID 生成随机的令牌 ID
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
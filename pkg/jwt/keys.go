@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey 一个非对称签名密钥，通过 kid 标识。
+// NotBefore 之后才会用于签名（之前只公开公钥，便于验证方提前缓存），
+// ExpiresAt 之后不再用于验证，为零值时永不过期。
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
+
+// LoadSigningKey 从 PEM 文件加载私钥，支持 RSA (RS256) 和 Ed25519 (EdDSA)
+func LoadSigningKey(kid, path string, notBefore, expiresAt time.Time) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseSigningKey(kid, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key.NotBefore = notBefore
+	key.ExpiresAt = expiresAt
+	return key, nil
+}
+
+// ParseSigningKey 解析 PEM 格式的私钥（PKCS#8，RSA 也支持 PKCS#1）
+func ParseSigningKey(kid string, pemBytes []byte) (*SigningKey, error) {
+	if kid == "" {
+		return nil, errors.New("签名密钥缺少 kid")
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("不是有效的 PEM 文件")
+	}
+
+	var parsed any
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, errors.New("无法解析私钥，仅支持 PKCS#8 或 PKCS#1 格式")
+		}
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA 密钥长度不能小于 2048 位")
+		}
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, Private: k}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: k}, nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型 %T，仅支持 RSA 和 Ed25519", parsed)
+	}
+}
+
+// verifies 判断密钥在指定时间是否仍可用于验证
+func (k *SigningKey) verifies(now time.Time) bool {
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// KeySet 按轮换计划管理多个签名密钥
+type KeySet struct {
+	keys []*SigningKey
+}
+
+// NewKeySet 创建密钥集合，kid 不能重复
+func NewKeySet(keys []*SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("至少需要一个签名密钥")
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if seen[k.ID] {
+			return nil, fmt.Errorf("签名密钥 kid 重复: %s", k.ID)
+		}
+		seen[k.ID] = true
+	}
+	sorted := append([]*SigningKey(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].NotBefore.Before(sorted[j].NotBefore) })
+	return &KeySet{keys: sorted}, nil
+}
+
+// Signing 返回当前用于签名的密钥：已生效且在令牌过期前不会失效的密钥中最新的一个
+func (s *KeySet) Signing(now time.Time, ttl time.Duration) (*SigningKey, error) {
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		k := s.keys[i]
+		if k.NotBefore.After(now) {
+			continue
+		}
+		if k.ExpiresAt.IsZero() || !now.Add(ttl).After(k.ExpiresAt) {
+			return k, nil
+		}
+	}
+	return nil, errors.New("没有可用的签名密钥，请检查密钥的生效和过期时间")
+}
+
+// Verification 返回用于验证的密钥
+func (s *KeySet) Verification(kid string, now time.Time) (*SigningKey, error) {
+	for _, k := range s.keys {
+		if k.ID == kid {
+			if !k.verifies(now) {
+				return nil, fmt.Errorf("签名密钥已过期: %s", kid)
+			}
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+// JWK 单个公钥的 JSON Web Key 表示 (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS 公钥集合
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 返回所有仍可用于验证的公钥，包括尚未开始签名的下一个密钥
+func (s *KeySet) JWKS(now time.Time) JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range s.keys {
+		if !k.verifies(now) {
+			continue
+		}
+		jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+		switch pub := k.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
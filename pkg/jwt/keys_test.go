@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pemKey(t *testing.T, key any) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestKeyManager_RotationAndJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	start := time.Now()
+	oldKey, err := ParseSigningKey("old", pemKey(t, rsaKey))
+	require.NoError(t, err)
+	oldKey.NotBefore = start.Add(-time.Hour)
+	oldKey.ExpiresAt = start.Add(2 * time.Hour)
+
+	newKey, err := ParseSigningKey("new", pemKey(t, edKey))
+	require.NoError(t, err)
+	newKey.NotBefore = start.Add(time.Hour)
+
+	m, err := NewKeyManager("test", 15*time.Minute, []*SigningKey{newKey, oldKey})
+	require.NoError(t, err)
+	now := start
+	m.now = func() time.Time { return now }
+
+	// 新密钥生效前使用旧密钥签名，但新密钥的公钥已经公开
+	oldToken, err := m.GenerateToken(1, "alice", "user", "", nil)
+	require.NoError(t, err)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(oldToken, &Claims{})
+	assert.Equal(t, "old", parsed.Header["kid"])
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+
+	jwks := m.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+
+	// 新密钥生效后用新密钥签名，旧密钥签发的令牌在旧密钥过期前仍然有效
+	now = start.Add(time.Hour + time.Minute)
+	newToken, err := m.GenerateToken(1, "alice", "user", "", nil)
+	require.NoError(t, err)
+	parsed, _, _ = jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	now = start.Add(10 * time.Minute)
+	claims, err := m.ValidateToken(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Username)
+
+	// 旧密钥过期后不再公开，也不再用于验证
+	now = start.Add(2*time.Hour + time.Second)
+	assert.Len(t, m.JWKS().Keys, 1)
+	_, err = m.ValidateToken(oldToken)
+	assert.Error(t, err)
+}
+
+func TestKeyManager_RejectsForeignTokens(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ParseSigningKey("k1", pemKey(t, edKey))
+	require.NoError(t, err)
+	m, err := NewKeyManager("test", time.Minute, []*SigningKey{key})
+	require.NoError(t, err)
+
+	// 用 HS256 和共享密钥签发的令牌不能通过验证
+	hs := NewManager("secret", "test", time.Minute)
+	token, err := hs.GenerateToken(1, "alice", "admin", "", nil)
+	require.NoError(t, err)
+	_, err = m.ValidateToken(token)
+	assert.Error(t, err)
+
+	// 未知的 kid
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &Claims{UserID: 1})
+	forged.Header["kid"] = "k2"
+	signed, err := forged.SignedString(otherKey)
+	require.NoError(t, err)
+	_, err = m.ValidateToken(signed)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+// Package mailer 发送系统邮件。生产环境使用 SMTPMailer，开发和测试环境可以使用
+// LogMailer 把邮件写入日志，或使用 FileMailer 把邮件保存为 .eml 文件。
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message 是一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 发送邮件
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer 只把邮件内容写入日志，适用于本地开发
+type LogMailer struct {
+	logger *zap.SugaredLogger
+}
+
+// NewLogMailer 创建 LogMailer
+func NewLogMailer(logger *zap.SugaredLogger) *LogMailer {
+	return &LogMailer{logger: logger.Named("mailer")}
+}
+
+// Send 把邮件写入日志
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	m.logger.Infow("邮件未实际发送", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer 把每封邮件保存为目录中的一个 .eml 文件，可以用邮件客户端直接打开
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Uint64
+}
+
+// NewFileMailer 创建 FileMailer，目录不存在时自动创建
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send 把邮件写入文件，文件名由时间和序号组成，按名称排序即为发送顺序
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	if err := validAddress(msg.To); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%06d.eml", now.UTC().Format("20060102T150405.000000000"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.dir, name), Format(m.from, msg, now), 0o600)
+}
+
+// Format 按 RFC 5322 生成邮件原文，主题按 RFC 2047 编码，正文使用 UTF-8 纯文本
+func Format(from string, msg Message, date time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="UTF-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// validAddress 拒绝包含换行的地址，避免邮件头注入
+func validAddress(addr string) error {
+	if addr == "" || strings.ContainsAny(addr, "\r\n") {
+		return fmt.Errorf("无效的邮件地址: %q", addr)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFileMailer(dir, "noreply@example.com")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, m.Send(ctx, Message{To: "alice@example.com", Subject: "重置密码", Body: "第一行\n第二行"}))
+	require.NoError(t, m.Send(ctx, Message{To: "bob@example.com", Subject: "Verify", Body: "hi"}))
+	assert.Error(t, m.Send(ctx, Message{To: "eve@example.com\r\nBcc: x@example.com", Subject: "x"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	raw, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "重置密码", subject)
+	date, err := msg.Header.Date()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), date, time.Minute)
+	assert.Contains(t, string(raw), "第一行\r\n第二行")
+}
@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig 是 SMTP 服务器的连接信息
+type SMTPConfig struct {
+	Host     string
+	Port     int // 465 使用隐式 TLS，其他端口在服务器支持时使用 STARTTLS
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer 创建 SMTPMailer，Username 为空时不进行认证
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send 连接 SMTP 服务器发送一封邮件，ctx 的截止时间同时作为连接的读写超时
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := validAddress(msg.To); err != nil {
+		return err
+	}
+	if err := validAddress(m.cfg.From); err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	var conn net.Conn
+	var err error
+	if m.cfg.Port == 465 {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.cfg.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		// PlainAuth 只允许在 TLS 连接或本机上发送密码
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.cfg.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(Format(m.cfg.From, msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
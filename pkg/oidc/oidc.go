@@ -0,0 +1,310 @@
+// Package oidc 实现 OpenID Connect 授权码流程的客户端部分：
+// 服务发现、PKCE、授权码换取令牌，以及使用提供方 JWKS 验证 ID Token。
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config 客户端配置
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // 为空时使用 openid profile email
+}
+
+// Metadata 提供方的发现文档中本客户端用到的字段
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Token 授权码换取到的令牌
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// IDToken 验证通过的 ID Token
+type IDToken struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Claims            map[string]any // 全部声明，用于角色映射等
+}
+
+// ErrInvalidIDToken ID Token 验证失败
+var ErrInvalidIDToken = errors.New("无效的 ID Token")
+
+// jwksRefreshInterval 遇到未知 kid 时重新拉取 JWKS 的最小间隔，避免被伪造的令牌放大请求
+const jwksRefreshInterval = time.Minute
+
+// Provider 一个 OIDC 提供方。发现文档在首次使用时获取并缓存，提供方暂时不可用不会影响服务启动。
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        map[string]any
+	keysFetched time.Time
+	now         func() time.Time
+}
+
+// NewProvider 创建提供方，client 为 nil 时使用带超时的默认客户端
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	} else if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{cfg: cfg, client: client, now: time.Now}
+}
+
+// Metadata 返回发现文档，首次调用时从 {issuer}/.well-known/openid-configuration 获取
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var m Metadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: %w", err)
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("OIDC issuer 不匹配，期望 %q，实际 %q", p.cfg.Issuer, m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("OIDC 发现文档缺少必要的端点")
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// AuthCodeURL 返回跳转到提供方登录页的地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange 使用授权码和 PKCE verifier 换取令牌
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic 是规范要求提供方必须支持的认证方式
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &e)
+		return nil, fmt.Errorf("令牌端点返回 %d: %s %s", resp.StatusCode, e.Error, e.Description)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("无法解析令牌响应: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("令牌响应中没有 id_token")
+	}
+	return &token, nil
+}
+
+// idTokenClaims ID Token 中需要校验的声明
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce"`
+	AZP   string `json:"azp"`
+}
+
+// Verify 验证 ID Token 的签名、issuer、audience、有效期和 nonce
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	if _, err := p.Metadata(ctx); err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	token, err := jwt.ParseWithClaims(rawIDToken, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if len(claims.Audience) > 1 && claims.AZP != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp 不匹配", ErrInvalidIDToken)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce 不匹配", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: 缺少 sub", ErrInvalidIDToken)
+	}
+
+	// 再解析一次得到全部声明，用于角色映射
+	all := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(rawIDToken, all); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	id := &IDToken{Subject: claims.Subject, Claims: all}
+	id.Email, _ = all["email"].(string)
+	id.Name, _ = all["name"].(string)
+	id.PreferredUsername, _ = all["preferred_username"].(string)
+	switch v := all["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		// 部分提供方以字符串返回
+		id.EmailVerified = v == "true"
+	}
+	return id, nil
+}
+
+// key 返回 kid 对应的公钥，缓存中没有时按间隔重新拉取 JWKS 以支持提供方轮换密钥
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.lookupKey(kid); ok {
+		return k, nil
+	}
+	if p.keys != nil && p.now().Sub(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("未知的签名密钥: %q", kid)
+	}
+
+	var set jwkSet
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("获取 JWKS 失败: %w", err)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetched = p.now()
+
+	if k, ok := p.lookupKey(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %q", kid)
+}
+
+// lookupKey 在缓存中查找公钥。令牌没有 kid 且提供方只有一个密钥时使用该密钥，调用方需持有锁
+func (p *Provider) lookupKey(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+// getJSON 请求并解析 JSON
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// RandomString 生成用于 state、nonce 和 PKCE verifier 的随机字符串
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge 计算 PKCE S256 challenge
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
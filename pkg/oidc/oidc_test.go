@@ -0,0 +1,93 @@
+package oidc_test
+
+import (
+	"context"
+	"shorturl-platform/pkg/oidc"
+	"shorturl-platform/pkg/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_AuthorizationCodeFlowWithPKCE(t *testing.T) {
+	issuer := oidctest.NewIssuer("shorturl", "s3cret")
+	defer issuer.Close()
+	issuer.SetClaims(map[string]any{
+		"sub": "emp-42", "email": "alice@corp.example", "email_verified": true,
+		"preferred_username": "alice", "groups": []string{"shorturl-admins"},
+	})
+
+	p := oidc.NewProvider(oidc.Config{
+		Issuer:       issuer.URL() + "/",
+		ClientID:     "shorturl",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+	}, nil)
+	ctx := context.Background()
+
+	state, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	verifier, _ := oidc.RandomString()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	require.NoError(t, err)
+
+	callback, err := issuer.Authorize(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, state, callback.Query().Get("state"))
+	code := callback.Query().Get("code")
+
+	// PKCE verifier 不匹配时提供方拒绝换取令牌
+	_, err = p.Exchange(ctx, code, "wrong-verifier")
+	assert.Error(t, err)
+
+	callback, _ = issuer.Authorize(authURL)
+	token, err := p.Exchange(ctx, callback.Query().Get("code"), verifier)
+	require.NoError(t, err)
+
+	id, err := p.Verify(ctx, token.IDToken, nonce)
+	require.NoError(t, err)
+	assert.Equal(t, "emp-42", id.Subject)
+	assert.Equal(t, "alice@corp.example", id.Email)
+	assert.True(t, id.EmailVerified)
+	assert.Equal(t, "alice", id.PreferredUsername)
+	assert.Equal(t, []any{"shorturl-admins"}, id.Claims["groups"])
+
+	_, err = p.Verify(ctx, token.IDToken, "other-nonce")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestProvider_RejectsInvalidIDTokens(t *testing.T) {
+	issuer := oidctest.NewIssuer("shorturl", "s3cret")
+	defer issuer.Close()
+	p := oidc.NewProvider(oidc.Config{Issuer: issuer.URL(), ClientID: "shorturl"}, nil)
+	ctx := context.Background()
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": issuer.URL(), "aud": "shorturl", "sub": "emp-1", "nonce": "n",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	cases := map[string]func(jwt.MapClaims){
+		"audience": func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no exp":   func(c jwt.MapClaims) { delete(c, "exp") },
+		"azp":      func(c jwt.MapClaims) { c["aud"] = []string{"shorturl", "other"} },
+	}
+	for name, mutate := range cases {
+		claims := valid()
+		mutate(claims)
+		raw, err := issuer.SignIDToken(claims)
+		require.NoError(t, err)
+		_, err = p.Verify(ctx, raw, "n")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken, name)
+	}
+
+	raw, _ := issuer.SignIDToken(valid())
+	_, err := p.Verify(ctx, raw, "n")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量，密钥为 ASCII "12345678901234567890"
+func TestCode_RFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := Code(secret, Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "t=%d", unix)
+	}
+}
+
+func TestValidate_Skew(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	previous, _ := Code(secret, Step(now)-1)
+	step, ok := Validate(secret, previous, now)
+	assert.True(t, ok, "允许前一个时间步的验证码")
+	assert.Equal(t, Step(now)-1, step)
+
+	tooOld, _ := Code(secret, Step(now)-2)
+	_, ok = Validate(secret, tooOld, now)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", "123456", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Short URL", "alice@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Short URL:alice@example.com", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "Short URL", u.Query().Get("issuer"))
+}
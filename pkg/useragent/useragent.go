@@ -0,0 +1,156 @@
+package useragent
+
+import "strings"
+
+// 设备类型
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = ""
+)
+
+// Info 是从 User-Agent 中解析出的客户端信息
+type Info struct {
+	Browser string // 浏览器家族，例如 Chrome、Safari；爬虫为其名称
+	OS      string // 操作系统，例如 Windows、iOS
+	Device  string // 设备类型: desktop, mobile, tablet, bot
+	IsBot   bool
+}
+
+// botSignatures 是常见爬虫、链接预览和脚本客户端的特征（小写），按顺序匹配，
+// 具体名称排在通用关键字之前，以便报表中能看到是哪个爬虫
+var botSignatures = []struct {
+	token string
+	name  string
+}{
+	{"googlebot", "Googlebot"},
+	{"bingbot", "Bingbot"},
+	{"baiduspider", "Baiduspider"},
+	{"yandexbot", "YandexBot"},
+	{"duckduckbot", "DuckDuckBot"},
+	{"slackbot", "Slackbot"},
+	{"slack-imgproxy", "Slackbot"},
+	{"twitterbot", "Twitterbot"},
+	{"facebookexternalhit", "Facebook"},
+	{"linkedinbot", "LinkedInBot"},
+	{"discordbot", "Discordbot"},
+	{"telegrambot", "TelegramBot"},
+	{"whatsapp", "WhatsApp"},
+	{"applebot", "Applebot"},
+	{"bytespider", "Bytespider"},
+	{"headlesschrome", "HeadlessChrome"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"python-requests", "python-requests"},
+	{"go-http-client", "Go-http-client"},
+	{"okhttp", "okhttp"},
+	{genericBot, "Other Bot"},
+	{"crawler", "Other Bot"},
+	{"spider", "Other Bot"},
+	{"slurp", "Other Bot"},
+	{"preview", "Other Bot"},
+}
+
+// genericBot 是通用的爬虫关键字，只在作为名称的结尾时匹配（见 containsBotWord），
+// 避免把型号中恰好包含 bot 的设备（例如 CUBOT 手机）当成爬虫
+const genericBot = "bot"
+
+// containsBotWord 判断 lower 中是否有以 bot 结尾的名称：bot 后面是 '/'、';'、')' 或字符串结尾，
+// 例如 "AhrefsBot/7.0"、"(compatible; MJ12bot)"，或者前面是 '-'，例如 "my-bot 1.0"
+func containsBotWord(lower string) bool {
+	for i := 0; ; {
+		j := strings.Index(lower[i:], genericBot)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(genericBot)
+		if end == len(lower) || strings.IndexByte("/;)", lower[end]) >= 0 || (start > 0 && lower[start-1] == '-') {
+			return true
+		}
+		i = end
+	}
+}
+
+// browserSignatures 按顺序匹配，基于 Chromium 的浏览器需排在 Chrome 之前
+var browserSignatures = []struct {
+	token string
+	name  string
+}{
+	{"MicroMessenger/", "WeChat"},
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"UCBrowser/", "UC Browser"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"MSIE ", "IE"},
+	{"Trident/", "IE"},
+	{"Safari/", "Safari"},
+}
+
+// osSignatures 按顺序匹配，iOS 需排在 macOS 之前（iPhone 的 UA 中包含 "like Mac OS X"）
+var osSignatures = []struct {
+	token string
+	name  string
+}{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"HarmonyOS", "HarmonyOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Parse 解析 User-Agent 字符串；无法识别的字段保持为空
+func Parse(ua string) Info {
+	if ua == "" {
+		return Info{}
+	}
+
+	lower := strings.ToLower(ua)
+	for _, sig := range botSignatures {
+		matched := strings.Contains(lower, sig.token)
+		if sig.token == genericBot {
+			matched = containsBotWord(lower)
+		}
+		if matched {
+			return Info{Browser: sig.name, Device: DeviceBot, IsBot: true}
+		}
+	}
+
+	var info Info
+	for _, sig := range browserSignatures {
+		if strings.Contains(ua, sig.token) {
+			info.Browser = sig.name
+			break
+		}
+	}
+	for _, sig := range osSignatures {
+		if strings.Contains(ua, sig.token) {
+			info.OS = sig.name
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(lower, "tablet") ||
+		(info.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		info.Device = DeviceMobile
+	case info.Browser != "" || info.OS != "":
+		info.Device = DeviceDesktop
+	}
+	return info
+}
@@ -0,0 +1,87 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "Windows Chrome",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name: "Windows Edge",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0",
+			want: Info{Browser: "Edge", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name: "iPhone Safari",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name: "iPad Safari",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", OS: "iOS", Device: DeviceTablet},
+		},
+		{
+			name: "Android Chrome",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name: "macOS Firefox",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.5; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want: Info{Browser: "Firefox", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			name: "Googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Browser: "Googlebot", Device: DeviceBot, IsBot: true},
+		},
+		{
+			name: "Slackbot",
+			ua:   "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want: Info{Browser: "Slackbot", Device: DeviceBot, IsBot: true},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.5.0",
+			want: Info{Browser: "curl", Device: DeviceBot, IsBot: true},
+		},
+		{
+			name: "generic bot",
+			ua:   "Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)",
+			want: Info{Browser: "Other Bot", Device: DeviceBot, IsBot: true},
+		},
+		{
+			name: "CUBOT phone is not a bot",
+			ua:   "Mozilla/5.0 (Linux; Android 10; CUBOT_X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name: "CUBOT NOTE phone is not a bot",
+			ua:   "Mozilla/5.0 (Linux; Android 9; CUBOT NOTE 7 Build/PPR1.180610.011) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+			want: Info{Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name: "empty",
+			ua:   "",
+			want: Info{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.ua))
+		})
+	}
+}